@@ -0,0 +1,142 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// roles a caller can hold, read from the "role" attribute of their certificate
+const (
+	RoleVendor    = "vendor"
+	RoleCustomer  = "customer"
+	RoleBanker    = "banker"
+	RoleAuditor   = "auditor"
+	RoleAdmin     = "admin"
+	RoleFinancier = "financier" //buys invoices listed for sale
+)
+
+// certificate attributes the membership service issues to our users
+var roleAttribute = "role"
+var idAttribute = "id" //the Account.ID the user acts for
+
+// Identity is who is calling and in which role
+type Identity struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+}
+
+// ============================================================================================================================
+// Get Identity - read the caller's id and role from the attributes of their certificate
+// ============================================================================================================================
+func getIdentity(stub shim.ChaincodeStubInterface) (Identity, error) {
+	var caller Identity
+
+	role, err := stub.ReadCertAttribute(roleAttribute)
+	if err != nil || len(role) == 0 {
+		return caller, newError(CodePermissionDenied, "", "Caller certificate has no \""+roleAttribute+"\" attribute")
+	}
+	caller.Role = strings.ToLower(string(role))
+	switch caller.Role {
+	case RoleVendor, RoleCustomer, RoleBanker, RoleAuditor, RoleAdmin, RoleFinancier:
+	default:
+		return caller, newError(CodePermissionDenied, "", "Caller has an unknown role \""+caller.Role+"\"")
+	}
+
+	id, err := stub.ReadCertAttribute(idAttribute)
+	if err == nil && len(id) > 0 {
+		caller.ID = string(id)
+	} else {
+		caller.ID = certCommonName(stub) //fall back to the name on the certificate
+	}
+	if caller.ID == "" {
+		return caller, newError(CodePermissionDenied, "", "Caller certificate has no \""+idAttribute+"\" attribute")
+	}
+	return caller, nil
+}
+
+// ============================================================================================================================
+// certCommonName - the common name on the caller's certificate, empty if there is none
+// ============================================================================================================================
+func certCommonName(stub shim.ChaincodeStubInterface) string {
+	certAsBytes, err := stub.GetCallerCertificate()
+	if err != nil || len(certAsBytes) == 0 {
+		return ""
+	}
+	if block, _ := pem.Decode(certAsBytes); block != nil {
+		certAsBytes = block.Bytes
+	}
+	cert, err := x509.ParseCertificate(certAsBytes)
+	if err != nil {
+		return ""
+	}
+	return cert.Subject.CommonName
+}
+
+// ============================================================================================================================
+// Get Caller - name of the user invoking, for audit records
+// ============================================================================================================================
+func getCaller(stub shim.ChaincodeStubInterface) string {
+	caller, err := getIdentity(stub)
+	if err == nil {
+		return caller.ID
+	}
+	if name := certCommonName(stub); name != "" {
+		return name
+	}
+	return "anonymous" //security is disabled on this network
+}
+
+// ============================================================================================================================
+// Require Role - the caller's identity, or an error if they hold none of the given roles
+// ============================================================================================================================
+func requireRole(stub shim.ChaincodeStubInterface, roles ...string) (Identity, error) {
+	caller, err := getIdentity(stub)
+	if err != nil {
+		return caller, err
+	}
+	for _, role := range roles {
+		if caller.Role == role {
+			return caller, nil
+		}
+	}
+	return caller, newError(CodePermissionDenied, "", "Caller "+caller.ID+" with role \""+caller.Role+"\" is not allowed to do this")
+}
+
+// ============================================================================================================================
+// Check Party - vendors and customers may only act on invoices they are named on
+// ============================================================================================================================
+func checkParty(stub shim.ChaincodeStubInterface, inv Invoice) error {
+	caller, err := getIdentity(stub)
+	if err != nil {
+		return err
+	}
+	if caller.Role == RoleVendor && caller.ID != inv.VendorID {
+		return newError(CodePermissionDenied, "", "Vendor "+caller.ID+" is not the vendor on invoice "+inv.InvoiceNumber)
+	}
+	if caller.Role == RoleCustomer && caller.ID != inv.CustomerID {
+		return newError(CodePermissionDenied, "", "Customer "+caller.ID+" is not the customer on invoice "+inv.InvoiceNumber)
+	}
+	return nil
+}
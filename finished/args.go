@@ -0,0 +1,349 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Every function also takes its arguments as one JSON object, e.g. {"invoiceid": "invoice~V1~INV-001", "reason": "late"}.
+// The object is checked field by field and flattened into the positional arguments the function reads,
+// so the positional form keeps working unchanged for old clients.
+
+// kinds of value a parameter holds, checked before the function runs
+const (
+	kindText     = ""         //any string, may be empty
+	kindID       = "id"       //non-empty string
+	kindInt      = "int"      //whole number
+	kindDecimal  = "decimal"  //decimal amount or rate
+	kindDate     = "date"     //YYYY-MM-DD
+	kindCurrency = "currency" //ISO 4217 code
+)
+
+// param is one named argument of a function
+type param struct {
+	Name     string
+	Kind     string
+	Optional bool    //may be left out, it is then passed as ""
+	Omit     bool    //may be left out, it is then not passed at all, only as the last param
+	Fields   []param //an object whose fields are passed in this order
+	List     bool    //a list of Fields objects, passed one after another, only as the last param
+}
+
+func required(name string, kind string) param { return param{Name: name, Kind: kind} }
+func optional(name string, kind string) param { return param{Name: name, Kind: kind, Optional: true} }
+func omitted(name string, kind string) param  { return param{Name: name, Kind: kind, Omit: true} }
+
+// parameters for each function, in positional order, named after the fields of the record they fill
+var invokeParams = map[string][]param{
+	"init":  {required("value", kindInt)},
+	"write": {required("name", kindID), required("value", kindText)},
+	"create_invoice": {
+		required("vendorid", kindID), required("customerid", kindID), required("invoicenumber", kindID),
+		required("invoiceamount", kindDecimal), required("currency", kindCurrency), required("material", kindID),
+		required("quantity", kindInt), required("tradeid", kindID), required("paymentdate", kindDate),
+		required("status", kindID), required("newpaymentdate", kindDate),
+	},
+	"issue_invoice":       lifecycleParams,
+	"acknowledge_invoice": lifecycleParams,
+	"close_invoice":       lifecycleParams,
+	"dispute_invoice":     lifecycleParams,
+	"resolve_dispute":     lifecycleParams,
+	"cancel_invoice":      lifecycleParams,
+	"create_account": {
+		required("id", kindID), required("accountname", kindText), required("accounttype", kindText),
+		required("address", kindText), required("bankaccountnumber", kindInt), required("phone", kindText),
+		required("bankerid", kindID),
+	},
+	"create_payment": {
+		required("paymentId", kindID), required("vendorid", kindID), required("customerid", kindID),
+		required("invoiceid", kindID), required("amount", kindDecimal), required("currency", kindCurrency),
+		required("bankerid", kindID), optional("paymentdate", kindDate), optional("tradeid", kindText),
+		optional("newpaymentdate", kindText),
+	},
+	"create_payment_multi": {
+		required("paymentId", kindID), required("vendorid", kindID), required("customerid", kindID),
+		required("amount", kindDecimal), required("currency", kindCurrency), required("bankerid", kindID),
+		optional("paymentdate", kindDate), optional("tradeid", kindText), optional("newpaymentdate", kindText),
+		{Name: "allocations", List: true, Fields: []param{required("invoiceid", kindID), required("amount", kindDecimal)}},
+	},
+	"confirm_payment": {required("paymentId", kindID)},
+	"set_fx_rate":     {required("from", kindID), required("to", kindID), required("rate", kindDecimal), required("effectivedate", kindDate)},
+	"set_gl_account":  {required("purpose", kindID), required("code", kindID), required("name", kindText)},
+	"post_adjustment": {
+		required("description", kindText),
+		{Name: "lines", List: true, Fields: []param{
+			required("entity", kindID), required("account", kindID), optional("counterparty", kindText),
+			required("currency", kindCurrency), optional("debit", kindText), optional("credit", kindText),
+		}},
+	},
+	"open_period":       periodParams,
+	"soft_close_period": periodParams,
+	"hard_close_period": periodParams,
+	"migrate_keys":      {},
+	"set_user":          {required("invoiceid", kindID), required("user", kindID)},
+	"transfer_share":    {required("invoiceid", kindID), required("from", kindID), required("to", kindID), omitted("percent", kindDecimal)},
+	"open_trade":        {required("invoiceid", kindID), required("discount", kindDecimal), omitted("expiry", kindText)},
+	"perform_trade":     {required("id", kindID), required("financier", kindID), omitted("facevalue", kindDecimal)},
+	"remove_trade":      {required("id", kindID)},
+	"expire_trades":     {},
+	"pledge_invoice":    {required("invoiceid", kindID), required("lender", kindID)},
+	"release_pledge":    {required("invoiceid", kindID)},
+	"place_bid": {
+		required("financier", kindID), required("currency", kindCurrency), required("facevalue", kindDecimal),
+		required("discount", kindDecimal), required("tenor", kindInt), omitted("expiry", kindText),
+	},
+}
+
+var periodParams = []param{required("period", kindID), omitted("reason", kindText)}
+var lifecycleParams = []param{required("invoiceid", kindID), omitted("reason", kindText)}
+
+// queries missing here take no JSON object, list_* already read one of their own
+var queryParams = map[string][]param{
+	"read":                 {required("name", kindID)},
+	"payments_for_invoice": {required("invoiceid", kindID)},
+	"invoices_for_payment": {required("paymentId", kindID)},
+	"invoices_by":          {required("index", kindID), required("value", kindID), omitted("end", kindID)},
+	"history":              {required("type", kindID), required("id", kindID)},
+	"get_fx_rate":          {required("from", kindID), required("to", kindID), required("date", kindDate)},
+	"invoice_report":       {required("currency", kindCurrency), required("date", kindDate)},
+	"journal":              {required("from", kindDate), required("to", kindDate), omitted("entity", kindID)},
+	"chart_of_accounts":    {},
+	"fiscal_periods":       {},
+	"trial_balance":        {required("asof", kindDate), optional("entity", kindID), omitted("format", kindID)},
+	"account_balance":      {required("entity", kindID), required("account", kindID), required("asof", kindDate), omitted("format", kindID)},
+	"encumbrance_status":   {required("invoiceid", kindID)},
+	"trade_depth":          {optional("currency", kindCurrency), omitted("asof", kindDate)},
+	"closed_trades":        {omitted("reason", kindID)},
+	"fingerprint_status": {
+		required("vendorid", kindID), required("customerid", kindID), required("invoicenumber", kindID),
+		required("amount", kindDecimal), required("currency", kindCurrency), required("date", kindDate),
+	},
+}
+
+// ============================================================================================================================
+// isJSONObject - true if the arguments are one JSON object rather than positional strings
+// ============================================================================================================================
+func isJSONObject(args []string) bool {
+	return len(args) == 1 && strings.HasPrefix(strings.TrimSpace(args[0]), "{")
+}
+
+// ============================================================================================================================
+// namedArgs - the positional arguments for a JSON object argument, and the field name of each position.
+// Positional arguments are returned as they are, with the names of the params they fill.
+// ============================================================================================================================
+func namedArgs(params []param, args []string) ([]string, []string, error) {
+	if params == nil || !isJSONObject(args) {
+		return args, positionNames(params, len(args)), nil
+	}
+	object := map[string]json.RawMessage{}
+	err := json.Unmarshal([]byte(args[0]), &object)
+	if err != nil {
+		return nil, nil, newError(CodeInvalidArgument, "", "Argument is not a valid JSON object: "+err.Error())
+	}
+	var positional, names []string
+	err = flattenParams(params, object, "", &positional, &names)
+	if err != nil {
+		return nil, nil, err
+	}
+	return positional, names, nil
+}
+
+// ============================================================================================================================
+// flattenParams - append the value of each param of an object to the positional arguments, checking each one
+// ============================================================================================================================
+func flattenParams(params []param, object map[string]json.RawMessage, prefix string, positional *[]string, names *[]string) error {
+	var unknown []string
+	for field := range object {
+		if !hasParam(params, field) {
+			unknown = append(unknown, field)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return newError(CodeInvalidArgument, prefix+unknown[0], "Unknown field \""+prefix+unknown[0]+"\"")
+	}
+
+	for _, p := range params {
+		name := prefix + p.Name
+		raw, present := object[p.Name]
+		if present && string(raw) == "null" {
+			present = false
+		}
+
+		switch {
+		case p.List:
+			var items []map[string]json.RawMessage
+			if present {
+				err := json.Unmarshal(raw, &items)
+				if err != nil {
+					return newError(CodeInvalidArgument, name, "Field \""+name+"\" must be a list of objects")
+				}
+			}
+			if len(items) == 0 {
+				return newError(CodeRequired, name, "Field \""+name+"\" must list at least one entry")
+			}
+			for i, item := range items {
+				err := flattenParams(p.Fields, item, name+"["+strconv.Itoa(i)+"].", positional, names)
+				if err != nil {
+					return err
+				}
+			}
+		case p.Fields != nil:
+			item := map[string]json.RawMessage{}
+			if present {
+				err := json.Unmarshal(raw, &item)
+				if err != nil {
+					return newError(CodeInvalidArgument, name, "Field \""+name+"\" must be an object")
+				}
+			}
+			err := flattenParams(p.Fields, item, name+".", positional, names)
+			if err != nil {
+				return err
+			}
+		case !present && p.Omit:
+		case !present && p.Optional:
+			*positional = append(*positional, "")
+			*names = append(*names, name)
+		case !present:
+			return newError(CodeRequired, name, "Field \""+name+"\" is required")
+		default:
+			value, err := scalarValue(raw)
+			if err != nil {
+				return newError(CodeInvalidArgument, name, "Field \""+name+"\" must be a string or a number")
+			}
+			err = checkKind(name, p.Kind, value)
+			if err != nil {
+				return err
+			}
+			*positional = append(*positional, value)
+			*names = append(*names, name)
+		}
+	}
+	return nil
+}
+
+func hasParam(params []param, name string) bool {
+	for _, p := range params {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// scalarValue - a JSON string, number or boolean as the string the positional form would pass
+func scalarValue(raw json.RawMessage) (string, error) {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s, nil
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String(), nil
+	}
+	var b bool
+	if json.Unmarshal(raw, &b) == nil {
+		return strconv.FormatBool(b), nil
+	}
+	return "", errors.New("not a scalar")
+}
+
+// ============================================================================================================================
+// checkKind - an error naming the field if its value is not of the kind the param holds
+// ============================================================================================================================
+func checkKind(name string, kind string, value string) error {
+	switch kind {
+	case kindID:
+		return checkRequired(name, value)
+	case kindInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return newError(CodeInvalidArgument, name, "Field \""+name+"\" must be a whole number")
+		}
+	case kindDecimal:
+		if _, err := parseDecimal(value); err != nil {
+			return newError(CodeInvalidArgument, name, "Field \""+name+"\" must be a decimal number")
+		}
+	case kindDate:
+		return checkDate(name, value)
+	case kindCurrency:
+		return checkCurrency(name, value)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// positionNames - the name of the param each of n positional arguments fills, a list param repeats to the end
+// ============================================================================================================================
+func positionNames(params []param, n int) []string {
+	var names []string
+	for _, p := range params {
+		switch {
+		case p.List:
+			for i := 0; len(names) < n; i++ {
+				for _, field := range p.Fields {
+					names = append(names, p.Name+"["+strconv.Itoa(i)+"]."+field.Name)
+				}
+			}
+		case p.Fields != nil:
+			for _, field := range p.Fields {
+				names = append(names, p.Name+"."+field.Name)
+			}
+		default:
+			names = append(names, p.Name)
+		}
+	}
+	if len(names) > n {
+		names = names[:n]
+	}
+	return names
+}
+
+// ============================================================================================================================
+// nameArguments - reword "4th argument" and "argument 11" in the message of an error from a function called with
+// a JSON object to the name of the field that filled that position
+// ============================================================================================================================
+func nameArguments(msg string, names []string) string {
+	for i := len(names) - 1; i >= 0; i-- { //longest numbers first, so "11th" is not read as "1st"
+		field := "Field \"" + names[i] + "\""
+		msg = strings.Replace(msg, ordinal(i+1)+" argument", field, -1)
+		msg = strings.Replace(msg, "argument "+strconv.Itoa(i+1)+" ", field+" ", -1)
+	}
+	return msg
+}
+
+// ordinal - 1st, 2nd, 3rd, 4th... 11th, 12th, 13th, 21st
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
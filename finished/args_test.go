@@ -0,0 +1,110 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+const invoiceObject = `{"vendorid": "V1", "customerid": "C1", "invoicenumber": "INV-7", "invoiceamount": "25.50",
+	"currency": "USD", "material": "tin", "quantity": 3, "tradeid": "T1", "paymentdate": "2026-11-01",
+	"status": "%s", "newpaymentdate": "2026-11-01"}`
+
+func TestNamedArguments(t *testing.T) {
+	runInvokeCases(t, "create_invoice", setupLedger, []invokeCase{
+		{"object", RoleVendor, "V1", []string{fmt.Sprintf(invoiceObject, StatusIssued)}, "", func(t *testing.T, stub *mockStub) {
+			inv := readInvoice(t, stub, "V1", "INV-7")
+			if inv.Quantity != 3 || inv.InvoiceAmount.String() != "25.50" || inv.Status != StatusIssued {
+				t.Errorf("invoice from object %+v", inv)
+			}
+		}},
+		{"field checked downstream", RoleVendor, "V1", []string{fmt.Sprintf(invoiceObject, StatusPaid)}, `Field "status" must be the initial status`, nil},
+		{"missing field", RoleVendor, "V1", []string{`{"vendorid": "V1"}`}, `Field "customerid" is required`, nil},
+		{"unknown field", RoleVendor, "V1", []string{`{"vendor": "V1"}`}, `Unknown field "vendor"`, nil},
+		{"wrong kind", RoleVendor, "V1", []string{`{"vendorid": "V1", "customerid": "C1", "invoicenumber": "INV-7", "invoiceamount": "lots"}`}, `Field "invoiceamount" must be a decimal number`, nil},
+		{"not a scalar", RoleVendor, "V1", []string{`{"vendorid": ["V1"]}`}, `Field "vendorid" must be a string or a number`, nil},
+		{"bad JSON", RoleVendor, "V1", []string{`{"vendorid": `}, "not a valid JSON object", nil},
+	})
+
+	runInvokeCases(t, "create_payment", setupLedger, []invokeCase{
+		{"optional fields left out", RoleCustomer, "C1", []string{`{"paymentId": "P1", "vendorid": "V1", "customerid": "C1",
+			"invoiceid": "invoice~V1~INV-1", "amount": "40.00", "currency": "USD", "bankerid": "B1"}`}, "", func(t *testing.T, stub *mockStub) {
+			payment := Payment{}
+			readJSON(t, stub, paymentKey("P1"), &payment)
+			if payment.PaymentDate != "2026-10-01" || payment.TradeID != "" {
+				t.Errorf("payment from object %+v", payment)
+			}
+		}},
+		{"null is left out", RoleCustomer, "C1", []string{`{"paymentId": "P1", "vendorid": "V1", "customerid": "C1",
+			"invoiceid": "invoice~V1~INV-1", "amount": "40.00", "currency": "USD", "bankerid": null}`}, `Field "bankerid" is required`, nil},
+	})
+
+	twoInvoices := func(t *testing.T, stub *mockStub) {
+		setupLedger(t, stub)
+		mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", invoiceArgs("V1", "C1", "INV-2", "50.00", "copper", "8")...)
+	}
+	runInvokeCases(t, "create_payment_multi", twoInvoices, []invokeCase{
+		{"allocations", RoleCustomer, "C1", []string{`{"paymentId": "P1", "vendorid": "V1", "customerid": "C1", "amount": "60.00",
+			"currency": "USD", "bankerid": "B1", "allocations": [{"invoiceid": "invoice~V1~INV-1", "amount": "40.00"},
+			{"invoiceid": "invoice~V1~INV-2", "amount": "20.00"}]}`}, "", func(t *testing.T, stub *mockStub) {
+			payment := Payment{}
+			readJSON(t, stub, paymentKey("P1"), &payment)
+			if len(payment.Allocations) != 2 || payment.Allocations[1].InvoiceID != invoiceKey("V1", "INV-2") {
+				t.Errorf("allocations %+v", payment.Allocations)
+			}
+		}},
+		{"allocation checked downstream", RoleCustomer, "C1", []string{`{"paymentId": "P1", "vendorid": "V1", "customerid": "C1", "amount": "40.00",
+			"currency": "USD", "bankerid": "B1", "allocations": [{"invoiceid": "invoice~V1~INV-1", "amount": "40.001"}]}`}, `Field "allocations[0].amount" must be a decimal amount`, nil},
+		{"no allocations", RoleCustomer, "C1", []string{`{"paymentId": "P1", "vendorid": "V1", "customerid": "C1", "amount": "40.00",
+			"currency": "USD", "bankerid": "B1", "allocations": []}`}, `Field "allocations" must list at least one entry`, nil},
+	})
+
+	runInvokeCases(t, "open_trade", setupLedger, []invokeCase{
+		{"discount as a number", RoleVendor, "V1", []string{`{"invoiceid": "invoice~V1~INV-1", "discount": 2.5}`}, "", func(t *testing.T, stub *mockStub) {
+			if trade := readTrades(t, stub).OpenTrades[0]; trade.Discount != "2.5" || trade.Price.String() != "97.50" {
+				t.Errorf("trade from object %+v", trade)
+			}
+		}},
+		{"discount not a number", RoleVendor, "V1", []string{`{"invoiceid": "invoice~V1~INV-1", "discount": "some"}`}, `Field "discount" must be a decimal number`, nil},
+		{"unknown field", RoleVendor, "V1", []string{`{"invoiceid": "invoice~V1~INV-1", "discount": 2.5, "user": "V1"}`}, `Unknown field "user"`, nil},
+	})
+
+	//the optional reason may be left out entirely, and queries take objects too
+	stub := newMockStub()
+	setupLedger(t, stub)
+	mustInvoke(t, stub, RoleCustomer, "C1", "acknowledge_invoice", `{"invoiceid": "invoice~V1~INV-1"}`)
+	res, err := stub.mockQuery(new(SimpleChaincode), "read", `{"name": "abc"}`)
+	if err != nil || string(res) != "99" {
+		t.Errorf("read with an object: %q, %v", res, err)
+	}
+	report := queryHistory(t, stub, `{"type": "invoice", "id": "invoice~V1~INV-1"}`)
+	if len(report.Versions) != 2 {
+		t.Errorf("invoice has %d versions, want 2", len(report.Versions))
+	}
+}
+
+func TestOrdinal(t *testing.T) {
+	for n, want := range map[int]string{1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th", 13: "13th", 21: "21st", 102: "102nd"} {
+		if got := ordinal(n); got != want {
+			t.Errorf("ordinal(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// formats the balance queries can answer in
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// BalanceLine is the sum of the postings to one GL account in the books of one party,
+// against one counterparty in one currency. Balance is debits less credits.
+type BalanceLine struct {
+	Entity       string `json:"entity"`
+	Account      string `json:"account"`
+	AccountName  string `json:"accountname"`
+	Counterparty string `json:"counterparty"`
+	Currency     string `json:"currency"`
+	Debit        Money  `json:"debit"`
+	Credit       Money  `json:"credit"`
+	Balance      Money  `json:"balance"`
+}
+
+// TrialBalance is the answer of trial_balance and account_balance
+type TrialBalance struct {
+	AsOf     string         `json:"asof"`
+	Entity   string         `json:"entity,omitempty"`  //only the books of this party
+	Account  string         `json:"account,omitempty"` //only this GL account
+	Lines    []BalanceLine  `json:"lines"`
+	Totals   []JournalTotal `json:"totals"` //by currency
+	Balanced bool           `json:"balanced"`
+}
+
+// ============================================================================================================================
+// balances - add up the journal to a date, both included, by party, GL account, counterparty and currency
+// ============================================================================================================================
+func balances(stub shim.ChaincodeStubInterface, asOf string, entity string, account string) (TrialBalance, error) {
+	report := TrialBalance{AsOf: asOf, Entity: entity, Account: account}
+	chart, err := getChart(stub)
+	if err != nil {
+		return report, err
+	}
+	names := map[string]string{}
+	for _, a := range chart {
+		names[a.Code] = a.Name
+	}
+
+	lines := map[string]*BalanceLine{}
+	totals := journalTotals{}
+	endKey := makeKey(journalType, asOf) + keySeparator + keyRangeEnd
+	err = scanRange(stub, makeKey(journalType), endKey, func(key string, value []byte) error {
+		entry := JournalEntry{}
+		err := json.Unmarshal(value, &entry)
+		if err != nil {
+			return newError(CodeInternal, "", "Journal entry "+key+" is corrupt")
+		}
+		for _, posting := range entry.Lines {
+			if (entity != "" && posting.Entity != entity) || (account != "" && posting.Account != account) {
+				continue
+			}
+			id := strings.Join([]string{posting.Entity, posting.Account, posting.Counterparty, posting.Currency}, "\x00") //sorts V1 before V10
+			line, ok := lines[id]
+			if !ok {
+				zero := ZeroMoney(posting.Currency)
+				line = &BalanceLine{Entity: posting.Entity, Account: posting.Account, AccountName: names[posting.Account],
+					Counterparty: posting.Counterparty, Currency: posting.Currency, Debit: zero, Credit: zero}
+				lines[id] = line
+			}
+			line.Debit, err = line.Debit.Add(posting.Debit)
+			if err != nil {
+				return err
+			}
+			line.Credit, err = line.Credit.Add(posting.Credit)
+			if err != nil {
+				return err
+			}
+			err = totals.add(posting)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	var ids []string
+	for id := range lines {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	report.Lines = []BalanceLine{}
+	for _, id := range ids {
+		line := lines[id]
+		line.Balance, err = line.Debit.Sub(line.Credit)
+		if err != nil {
+			return report, err
+		}
+		report.Lines = append(report.Lines, *line)
+	}
+	report.Totals, report.Balanced = totals.sorted()
+	return report, nil
+}
+
+// ============================================================================================================================
+// balanceAnswer - a trial balance as JSON, or as CSV with a line per balance and a TOTAL line per currency
+// ============================================================================================================================
+func balanceAnswer(report TrialBalance, format string) ([]byte, error) {
+	if format == FormatJSON {
+		return json.Marshal(report)
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"entity", "account", "accountname", "counterparty", "currency", "debit", "credit", "balance"})
+	for _, line := range report.Lines {
+		w.Write([]string{line.Entity, line.Account, line.AccountName, line.Counterparty, line.Currency,
+			line.Debit.String(), line.Credit.String(), line.Balance.String()})
+	}
+	for _, total := range report.Totals {
+		balance, err := total.Debit.Sub(total.Credit)
+		if err != nil {
+			return nil, err
+		}
+		w.Write([]string{"TOTAL", report.Account, "", "", total.Currency,
+			total.Debit.String(), total.Credit.String(), balance.String()})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// ============================================================================================================================
+// balanceArgs - the date and format arguments shared by the balance queries, json when no format is given
+// ============================================================================================================================
+func balanceArgs(date string, format string) (string, string, error) {
+	asOf, err := dateKey(date)
+	if err != nil {
+		return "", "", err
+	}
+	if format == "" {
+		return asOf, FormatJSON, nil
+	}
+	if format != FormatJSON && format != FormatCSV {
+		return "", "", newError(CodeInvalidArgument, "format", "Unknown format \""+format+"\", expecting json or csv")
+	}
+	return asOf, format, nil
+}
+
+// ============================================================================================================================
+// Trial Balance - the balance of every GL account by party, counterparty and currency on a date, for one party if given
+// ============================================================================================================================
+func (t *SimpleChaincode) trial_balance(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0			1		2
+	// "2026-10-31", *"V1"*, *"csv"*
+	if len(args) < 1 || len(args) > 3 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting date, optional entity and optional format")
+	}
+	var entity, format string
+	if len(args) > 1 {
+		entity = args[1]
+	}
+	if len(args) > 2 {
+		format = args[2]
+	}
+	asOf, format, err := balanceArgs(args[0], format)
+	if err != nil {
+		return nil, atArgument(err, 1)
+	}
+
+	report, err := balances(stub, asOf, entity, "")
+	if err != nil {
+		return nil, err
+	}
+	return balanceAnswer(report, format)
+}
+
+// ============================================================================================================================
+// Account Balance - the balance of one GL account in the books of one party on a date, by counterparty and currency.
+// The account is a code or a purpose of the chart of accounts, such as "receivable".
+// ============================================================================================================================
+func (t *SimpleChaincode) account_balance(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0		1			2			3
+	// "V1", "receivable", "2026-10-31", *"csv"*
+	if len(args) < 3 || len(args) > 4 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting entity, account, date and optional format")
+	}
+	if len(args[0]) <= 0 {
+		return nil, argError(CodeRequired, 1, "1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return nil, argError(CodeRequired, 2, "2nd argument must be a non-empty string")
+	}
+	var format string
+	if len(args) > 3 {
+		format = args[3]
+	}
+	asOf, format, err := balanceArgs(args[2], format)
+	if err != nil {
+		return nil, atArgument(err, 3)
+	}
+	chart, err := getChart(stub)
+	if err != nil {
+		return nil, err
+	}
+	account := args[1]
+	if a, ok := chart[account]; ok {
+		account = a.Code
+	}
+
+	report, err := balances(stub, asOf, args[0], account)
+	if err != nil {
+		return nil, err
+	}
+	return balanceAnswer(report, format)
+}
@@ -0,0 +1,129 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// setupPaidLedger - setupLedger plus a 40.00 payment of INV-1 on 2026-11-02, confirmed by B1
+func setupPaidLedger(t *testing.T, stub *mockStub) {
+	setupLedger(t, stub)
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", "P1", "V1", "C1", invoiceKey("V1", "INV-1"), "40.00", "USD", "B1", "2026-11-02", "T1", "")
+	mustInvoke(t, stub, RoleBanker, "B1", "confirm_payment", "P1")
+}
+
+// queryBalance - run a balance query that answers in JSON
+func queryBalance(t *testing.T, stub *mockStub, function string, args ...string) TrialBalance {
+	var report TrialBalance
+	res, err := stub.as(RoleAuditor, "AU1").mockQuery(new(SimpleChaincode), function, args...)
+	if err != nil {
+		t.Fatalf("%s %v: %v", function, args, err)
+	}
+	err = json.Unmarshal(res, &report)
+	if err != nil {
+		t.Fatalf("%s %v: %v", function, args, err)
+	}
+	return report
+}
+
+// lineBalance - the balance of the line for an entity and account, empty if there is none
+func lineBalance(report TrialBalance, entity string, account string) string {
+	for _, line := range report.Lines {
+		if line.Entity == entity && line.Account == account {
+			return line.Balance.String()
+		}
+	}
+	return ""
+}
+
+func TestTrialBalance(t *testing.T) {
+	stub := newMockStub()
+	setupPaidLedger(t, stub)
+
+	//the payment is dated after the end of October, so it only counts from November on
+	cases := []struct {
+		asOf       string
+		receivable string
+		cash       string
+	}{
+		{"2026-09-30", "", ""},
+		{"2026-10-31", "100.00", ""},
+		{"2026-11-30", "60.00", "40.00"},
+	}
+	for _, tc := range cases {
+		report := queryBalance(t, stub, "trial_balance", tc.asOf)
+		if got := lineBalance(report, "V1", "1200"); got != tc.receivable {
+			t.Errorf("%s: V1 receivable %q, want %q", tc.asOf, got, tc.receivable)
+		}
+		if got := lineBalance(report, "V1", "1000"); got != tc.cash {
+			t.Errorf("%s: V1 cash %q, want %q", tc.asOf, got, tc.cash)
+		}
+		if !report.Balanced {
+			t.Errorf("%s: trial balance does not balance %+v", tc.asOf, report.Totals)
+		}
+	}
+
+	report := queryBalance(t, stub, "trial_balance", "2026-11-30", "C1")
+	if len(report.Lines) != 3 || report.Lines[0].Account != "1000" || report.Lines[0].Counterparty != "V1" || report.Lines[0].AccountName != "Cash" {
+		t.Errorf("C1 trial balance %+v, want cash, payable and expense against V1", report.Lines)
+	}
+
+	//CSV has a header, one row per line and a total per currency
+	res, err := stub.mockQuery(new(SimpleChaincode), "trial_balance", `{"asof": "2026-11-30", "format": "csv"}`)
+	if err != nil {
+		t.Fatalf("trial_balance as csv: %v", err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(res))).ReadAll()
+	if err != nil {
+		t.Fatalf("trial_balance as csv: %v", err)
+	}
+	if len(rows) != 8 || rows[0][0] != "entity" || rows[7][0] != "TOTAL" || rows[7][7] != "0.00" {
+		t.Errorf("csv %q, want a header, 6 lines and a balanced total", rows)
+	}
+
+	if _, err := stub.mockQuery(new(SimpleChaincode), "trial_balance", "2026-11-30", "", "xml"); errorOf(err).Field != "format" {
+		t.Errorf("unknown format: %v", err)
+	}
+}
+
+func TestAccountBalance(t *testing.T) {
+	stub := newMockStub()
+	setupPaidLedger(t, stub)
+
+	//an account is named by its purpose or its code
+	for _, account := range []string{GLReceivable, "1200"} {
+		report := queryBalance(t, stub, "account_balance", "V1", account, "2026-11-30")
+		if len(report.Lines) != 1 || report.Lines[0].Counterparty != "C1" || report.Lines[0].Balance.String() != "60.00" || report.Account != "1200" {
+			t.Errorf("%s: %+v, want 60.00 owed by C1", account, report)
+		}
+	}
+	if report := queryBalance(t, stub, "account_balance", "V2", GLReceivable, "2026-11-30"); len(report.Lines) != 0 {
+		t.Errorf("V2 has receivables %+v", report.Lines)
+	}
+
+	res, err := stub.mockQuery(new(SimpleChaincode), "account_balance", "C1", GLPayable, "2026-10-31", "csv")
+	if err != nil || !strings.Contains(string(res), "C1,2000,Accounts payable,V1,USD,0.00,100.00,-100.00") {
+		t.Errorf("C1 payable as csv %q (%v)", res, err)
+	}
+}
@@ -0,0 +1,332 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Every invoice has a cap table, the holders of the right to collect it and the percentage each holds, together
+// exactly 100. It starts as the vendor at 100 and changes by sales in the trade book and by transfers. What a holder
+// holds of the outstanding amount, and collects of each payment, is its percentage of it. Amounts are rounded down
+// to minor units and the units left over go one each to the holders with the largest remainders, the earlier on
+// the cap table first among equals, so every peer splits a payment the same way.
+
+// percentScale is the number of decimal places a percentage is kept to
+const percentScale = 10
+
+// hundredPercent - the whole of an invoice
+func hundredPercent() Money {
+	hundred, _ := Money{100, 0}.rescale(percentScale) //fits, as does any percentage up to 100
+	return hundred
+}
+
+// ============================================================================================================================
+// parsePercent - a percentage with at most percentScale decimals, kept to percentScale decimals
+// ============================================================================================================================
+func parsePercent(s string) (Money, error) {
+	percent, err := parseDecimal(s)
+	if err != nil {
+		return percent, newError(CodeInvalidArgument, "percent", "Percent \""+s+"\" is not a decimal number")
+	}
+	if percent.scale > percentScale {
+		return percent, newError(CodeOutOfRange, "percent", fmt.Sprintf("Percent must have at most %d decimals", percentScale))
+	}
+	percent, err = percent.rescale(percentScale)
+	if err != nil {
+		return percent, newError(CodeOutOfRange, "percent", "Percent "+s+" is too large")
+	}
+	return percent, nil
+}
+
+// formatPercent - a percentage without trailing zeros, "30" rather than "30.0000000000"
+func formatPercent(percent Money) string {
+	s := percent.String()
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// sharePercent - the percentage of a cap table entry, kept to percentScale decimals
+func sharePercent(share Share) Money {
+	percent, _ := parseDecimal(share.Percent)
+	percent, _ = percent.rescale(percentScale) //a stored percentage is at most 100
+	return percent
+}
+
+// ============================================================================================================================
+// capTable - the holders of an invoice, an invoice stored before cap tables is all its owner's
+// ============================================================================================================================
+func capTable(inv Invoice) []Share {
+	if len(inv.CapTable) > 0 {
+		return inv.CapTable
+	}
+	return []Share{{Holder: invoiceOwner(inv), Percent: "100"}}
+}
+
+// percentOf - the percentage of an invoice a party holds, zero if it holds none
+func percentOf(inv Invoice, holder string) Money {
+	for _, share := range capTable(inv) {
+		if share.Holder == holder {
+			return sharePercent(share)
+		}
+	}
+	return Money{0, percentScale}
+}
+
+// holderNames - the holders of an invoice, for messages
+func holderNames(inv Invoice) string {
+	var names []string
+	for _, share := range capTable(inv) {
+		names = append(names, share.Holder)
+	}
+	return strings.Join(names, ", ")
+}
+
+// ============================================================================================================================
+// setCapTable - store the holders of an invoice, dropping any left with nothing. The owner is the largest holder,
+// the earlier on the cap table among equals.
+// ============================================================================================================================
+func setCapTable(inv *Invoice, table []Share) {
+	var kept []Share
+	for _, share := range table {
+		if sharePercent(share).Sign() > 0 {
+			kept = append(kept, share)
+		}
+	}
+	owner := 0
+	for i := range kept {
+		if sharePercent(kept[i]).Cmp(sharePercent(kept[owner])) > 0 {
+			owner = i
+		}
+	}
+	inv.CapTable = kept
+	if len(kept) > 0 {
+		inv.Owner = kept[owner].Holder
+	}
+}
+
+// ============================================================================================================================
+// transferPercent - move a percentage of an invoice from one holder to another, a new holder joins the end of the cap table
+// ============================================================================================================================
+func transferPercent(inv *Invoice, from string, to string, percent Money) error {
+	held := percentOf(*inv, from)
+	if percent.Sign() <= 0 || percent.Cmp(held) > 0 {
+		return newError(CodeOutOfRange, "percent", "Percent must be more than 0 and at most the "+formatPercent(held)+" "+from+" holds of invoice "+inv.InvoiceNumber)
+	}
+	var table []Share
+	received := false
+	for _, share := range capTable(*inv) {
+		p := sharePercent(share)
+		var err error
+		if share.Holder == from {
+			p, err = p.Sub(percent)
+		}
+		if share.Holder == to {
+			p, err = p.Add(percent)
+			received = true
+		}
+		if err != nil {
+			return err
+		}
+		table = append(table, Share{Holder: share.Holder, Percent: formatPercent(p)})
+	}
+	if !received {
+		table = append(table, Share{Holder: to, Percent: formatPercent(percent)})
+	}
+	setCapTable(inv, table)
+	return nil
+}
+
+// ============================================================================================================================
+// shareOut - split an amount of an invoice among its holders by their percentages, rounded down to minor units with
+// the units left over going to the largest remainders, the earlier holder first among equals
+// ============================================================================================================================
+func shareOut(inv Invoice, amount Money) ([]Collection, error) {
+	table := capTable(inv)
+	var err error
+	total := Money{0, percentScale}
+	for _, share := range table {
+		total, err = total.Add(sharePercent(share))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if total.Cmp(hundredPercent()) != 0 {
+		return nil, newError(CodeInternal, "", "Cap table of invoice "+inv.InvoiceNumber+" adds up to "+formatPercent(total)+", not 100")
+	}
+	whole := big.NewInt(hundredPercent().minor)
+	shares := make([]Collection, len(table))
+	remainders := make([]*big.Int, len(table))
+	left := amount
+	for i, share := range table {
+		q, r := new(big.Int).QuoRem(new(big.Int).Mul(big.NewInt(amount.minor), big.NewInt(sharePercent(share).minor)), whole, new(big.Int))
+		if q.BitLen() > 63 {
+			return nil, errOverflow
+		}
+		shares[i] = Collection{Holder: share.Holder, Amount: Money{q.Int64(), amount.scale}}
+		remainders[i] = r
+		left, err = left.Sub(shares[i].Amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	one := Money{1, amount.scale}
+	for ; left.Sign() > 0; left, _ = left.Sub(one) { //the units left over are fewer than the holders
+		largest := -1
+		for i := range remainders {
+			if remainders[i] != nil && (largest < 0 || remainders[i].Cmp(remainders[largest]) > 0) {
+				largest = i
+			}
+		}
+		shares[largest].Amount, err = shares[largest].Amount.Add(one)
+		if err != nil {
+			return nil, err
+		}
+		remainders[largest] = nil //one unit each
+	}
+	return shares, nil
+}
+
+// ============================================================================================================================
+// heldBy - the face value of an invoice a party holds, its share of what is outstanding, zero if it holds none
+// ============================================================================================================================
+func heldBy(inv Invoice, holder string) Money {
+	shares, err := shareOut(inv, outstanding(inv))
+	if err == nil {
+		for _, share := range shares {
+			if share.Holder == holder {
+				return share.Amount
+			}
+		}
+	}
+	return ZeroMoney(inv.Currency)
+}
+
+// ============================================================================================================================
+// facePercent - the percentage of an invoice a face value of its outstanding amount is, all of a holder's percentage
+// for all it holds, otherwise rounded half up to percentScale decimals
+// ============================================================================================================================
+func facePercent(inv Invoice, holder string, face Money) Money {
+	if face.Cmp(heldBy(inv, holder)) == 0 {
+		return percentOf(inv, holder)
+	}
+	total := outstanding(inv)
+	face, total, _ = align(face, total) //amounts of one currency, kept at its scale
+	v := new(big.Int).Mul(big.NewInt(face.minor), big.NewInt(hundredPercent().minor))
+	v.Mul(v, big.NewInt(2)).Add(v, big.NewInt(total.minor))
+	v.Quo(v, big.NewInt(2*total.minor)) //(face * 100 / total), half up
+	return Money{v.Int64(), percentScale}
+}
+
+// ============================================================================================================================
+// transferShare - move a percentage of an invoice to another party, off the trade book. A pledged invoice cannot
+// change hands, nor can a copy of a receivable encumbered under another invoice. Any other is assigned to its holders
+// in the registry from then on. The receivable the giver gives up moves to the books of the receiver at face value.
+// ============================================================================================================================
+func transferShare(stub shim.ChaincodeStubInterface, inv *Invoice, from string, to string, percent Money) error {
+	err := checkKeyPart("to", to)
+	if err != nil {
+		return atField(err, "to")
+	}
+	if to == from {
+		return newError(CodeInvalidArgument, "to", "Invoice "+inv.InvoiceNumber+" share is already held by "+to)
+	}
+	enc, err := getEncumbrance(stub, invoiceFingerprint(*inv))
+	if err != nil {
+		return err
+	}
+	if enc.Status == EncumbrancePledged {
+		return newError(CodeEncumbered, "invoiceid", "Invoice "+inv.InvoiceNumber+" is pledged to "+enc.Holder+", its shares cannot change hands")
+	}
+	if enc.Status != EncumbranceFree && enc.InvoiceID != invoiceKey(inv.VendorID, inv.InvoiceNumber) {
+		return newError(CodeEncumbered, "invoiceid", "Invoice "+inv.InvoiceNumber+" is the same receivable as "+enc.InvoiceID+", which is already "+enc.Status+", it cannot be sold")
+	}
+	held := heldBy(*inv, from)
+	err = transferPercent(inv, from, to, percent)
+	if err != nil {
+		return err
+	}
+	err = putInvoice(stub, *inv)
+	if err != nil {
+		return err
+	}
+	given, err := held.Sub(heldBy(*inv, from))
+	if err != nil {
+		return err
+	}
+	err = postTransfer(stub, *inv, from, to, given)
+	if err != nil {
+		return err
+	}
+	if enc.Status == EncumbranceListed { //clean up takes the listing down if the seller no longer holds what it offered
+		return nil
+	}
+	return encumber(stub, *inv, EncumbranceSold, invoiceOwner(*inv), stub.GetTxID())
+}
+
+// ============================================================================================================================
+// Transfer Share - a holder gives some or all of its percentage of an invoice to another party
+// ============================================================================================================================
+func (t *SimpleChaincode) transfer_share(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0						1		2		3
+	// "invoice~V1~INV-001", "F1", "F2", "25"
+	if len(args) != 3 && len(args) != 4 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting invoice id, from, to and optional percent")
+	}
+
+	fmt.Println("- start transfer share")
+	inv, err := getInvoice(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	from := args[1]
+	caller, err := getIdentity(stub)
+	if err != nil {
+		return nil, err
+	}
+	if caller.Role != RoleAdmin && caller.ID != from {
+		return nil, newError(CodePermissionDenied, "from", caller.ID+" cannot transfer the share of "+from)
+	}
+	percent := percentOf(inv, from) //all of it unless told otherwise
+	if len(args) == 4 && args[3] != "" {
+		percent, err = parsePercent(args[3])
+		if err != nil {
+			return nil, err
+		}
+	}
+	previous := invoiceOwner(inv)
+	err = transferShare(stub, &inv, from, args[2], percent)
+	if err != nil {
+		return nil, err
+	}
+
+	emitEvent(stub, Event{Name: EventShareTransferred, InvoiceID: args[0], PreviousOwner: from, NewOwner: args[2], Percent: formatPercent(percent)})
+	if owner := invoiceOwner(inv); owner != previous {
+		emitEvent(stub, Event{Name: EventInvoiceOwnerChanged, InvoiceID: args[0], PreviousOwner: previous, NewOwner: owner})
+	}
+	fmt.Println("- end transfer share")
+	return nil, nil
+}
@@ -0,0 +1,188 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShareOut(t *testing.T) {
+	inv := Invoice{InvoiceNumber: "INV-1", Currency: "USD", CapTable: []Share{{Holder: "A", Percent: "30"}, {Holder: "B", Percent: "30"}, {Holder: "C", Percent: "40"}}}
+	cases := []struct {
+		amount string
+		want   []string
+	}{
+		{"0.01", []string{"0.00", "0.00", "0.01"}}, //the largest remainder
+		{"0.02", []string{"0.01", "0.00", "0.01"}}, //then the earlier of two equal ones
+		{"0.03", []string{"0.01", "0.01", "0.01"}},
+		{"33.33", []string{"10.00", "10.00", "13.33"}},
+		{"100.00", []string{"30.00", "30.00", "40.00"}},
+	}
+	for _, tc := range cases {
+		shares, err := shareOut(inv, usd(tc.amount))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.amount, err)
+		}
+		var got []string
+		for _, share := range shares {
+			got = append(got, share.Amount.String())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s shared out as %v, want %v", tc.amount, got, tc.want)
+		}
+	}
+
+	inv.CapTable = []Share{{Holder: "A", Percent: "60"}, {Holder: "B", Percent: "30"}}
+	if _, err := shareOut(inv, usd("0.10")); !errorMatches(err, "adds up to 90, not 100") {
+		t.Errorf("cap table of 90 percent: got error %v", err)
+	}
+}
+
+func TestFacePercent(t *testing.T) {
+	inv := Invoice{InvoiceNumber: "INV-1", Currency: "USD", InvoiceAmount: usd("100.00"), PaidAmount: usd("70.00"), OutstandingAmount: usd("30.00"), Owner: "V1"}
+	cases := []struct {
+		face string
+		want string
+	}{
+		{"30.00", "100"},           //all of it
+		{"10.00", "33.3333333333"}, //rounded down
+		{"20.00", "66.6666666667"}, //rounded up
+		{"0.01", "0.0333333333"},
+	}
+	for _, tc := range cases {
+		if got := formatPercent(facePercent(inv, "V1", usd(tc.face))); got != tc.want {
+			t.Errorf("%s of 30.00 is %s percent, want %s", tc.face, got, tc.want)
+		}
+	}
+}
+
+func TestTransferShare(t *testing.T) {
+	inv1 := invoiceKey("V1", "INV-1")
+	runInvokeCases(t, "transfer_share", setupLedger, []invokeCase{
+		{name: "part of a share", role: RoleVendor, id: "V1", args: []string{inv1, "V1", "F1", "25"}, check: func(t *testing.T, stub *mockStub) {
+			inv := readInvoice(t, stub, "V1", "INV-1")
+			if wantTable := []Share{{Holder: "V1", Percent: "75"}, {Holder: "F1", Percent: "25"}}; inv.Owner != "V1" || !reflect.DeepEqual(inv.CapTable, wantTable) {
+				t.Errorf("part of a share: owner %s cap table %+v", inv.Owner, inv.CapTable)
+			}
+			if _, payload := lastEvent(t, stub); len(payload.Events) != 1 || payload.Events[0].Name != EventShareTransferred || payload.Events[0].Percent != "25" || payload.Events[0].NewOwner != "F1" {
+				t.Errorf("part of a share: events %+v", payload.Events)
+			}
+			if enc := queryEncumbrance(t, stub, inv1); enc.Status != EncumbranceSold || enc.Holder != "V1" {
+				t.Errorf("part of a share: encumbrance %+v", enc)
+			}
+			journal := queryJournal(t, stub, "2026-10-01", "2026-10-31")
+			if balance(journal, "V1", "1200") != "75.00" || balance(journal, "F1", "1200") != "25.00" || !journal.Balanced {
+				t.Errorf("part of a share: V1 receivable %s, F1 receivable %s", balance(journal, "V1", "1200"), balance(journal, "F1", "1200"))
+			}
+			if balance(journal, "V1", "1900") != "25.00" || balance(journal, "F1", "1900") != "-25.00" ||
+				balance(journal, "V1", "5200") != "0.00" || balance(journal, "F1", "4200") != "0.00" {
+				t.Errorf("part of a share: V1 clearing %s, F1 clearing %s, want the handover off the income statement",
+					balance(journal, "V1", "1900"), balance(journal, "F1", "1900"))
+			}
+		}},
+		{name: "the whole share", role: RoleVendor, id: "V1", args: []string{inv1, "V1", "F1"}, check: func(t *testing.T, stub *mockStub) {
+			if inv := readInvoice(t, stub, "V1", "INV-1"); inv.Owner != "F1" || !reflect.DeepEqual(inv.CapTable, []Share{{Holder: "F1", Percent: "100"}}) {
+				t.Errorf("the whole share: owner %s cap table %+v", inv.Owner, inv.CapTable)
+			}
+			if _, payload := lastEvent(t, stub); !reflect.DeepEqual(eventNames(payload), []string{EventShareTransferred, EventInvoiceOwnerChanged}) {
+				t.Errorf("the whole share: events %v", eventNames(payload))
+			}
+		}},
+		{name: "by an admin", role: RoleAdmin, id: "A1", args: []string{inv1, "V1", "F1", "40"}},
+		{name: "share of another", role: RoleFinancier, id: "F1", args: []string{inv1, "V1", "F1", "40"}, wantErr: "F1 cannot transfer the share of V1"},
+		{name: "from a party holding none", role: RoleFinancier, id: "F1", args: []string{inv1, "F1", "F2", "40"}, wantErr: "at most the 0 F1 holds"},
+		{name: "more than held", role: RoleVendor, id: "V1", args: []string{inv1, "V1", "F1", "100.01"}, wantErr: "at most the 100 V1 holds"},
+		{name: "nothing", role: RoleVendor, id: "V1", args: []string{inv1, "V1", "F1", "0"}, wantErr: "more than 0"},
+		{name: "too many decimals", role: RoleVendor, id: "V1", args: []string{inv1, "V1", "F1", "0.00000000001"}, wantErr: "at most 10 decimals"},
+		{name: "to itself", role: RoleVendor, id: "V1", args: []string{inv1, "V1", "V1", "10"}, wantErr: "already held by V1"},
+		{name: "unknown invoice", role: RoleVendor, id: "V1", args: []string{invoiceKey("V1", "INV-404"), "V1", "F1", "10"}, wantErr: "does not exist"},
+		{name: "by a customer", role: RoleCustomer, id: "C1", args: []string{inv1, "C1", "F1", "10"}, wantErr: "not allowed"},
+	})
+}
+
+func TestCapTable(t *testing.T) {
+	inv1 := invoiceKey("V1", "INV-1")
+	stub := newMockStub()
+	setupLedger(t, stub)
+
+	//thirds, the vendor keeps the extra ten billionth and stays the owner
+	mustInvoke(t, stub, RoleVendor, "V1", "transfer_share", inv1, "V1", "F1", "33.3333333333")
+	mustInvoke(t, stub, RoleVendor, "V1", "transfer_share", inv1, "V1", "F2", "33.3333333333")
+	inv := readInvoice(t, stub, "V1", "INV-1")
+	wantTable := []Share{{Holder: "V1", Percent: "33.3333333334"}, {Holder: "F1", Percent: "33.3333333333"}, {Holder: "F2", Percent: "33.3333333333"}}
+	if inv.Owner != "V1" || !reflect.DeepEqual(inv.CapTable, wantTable) {
+		t.Errorf("owner %s cap table %+v", inv.Owner, inv.CapTable)
+	}
+	if _, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "set_user", inv1, "F3"); !errorMatches(err, "held in pieces by V1, F1, F2") {
+		t.Errorf("set_user of an invoice held in pieces: %v", err)
+	}
+
+	//every payment is shared the same way and adds up to what was paid
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", paymentArgs("P1", "10.00", "2026-10-20")...)
+	mustInvoke(t, stub, RoleBanker, "B1", "confirm_payment", "P1")
+	inv = readInvoice(t, stub, "V1", "INV-1")
+	wantShares := []Collection{{Holder: "V1", Amount: usd("3.34")}, {Holder: "F1", Amount: usd("3.33")}, {Holder: "F2", Amount: usd("3.33")}}
+	if alloc := inv.Payments[0]; alloc.Payee != "" || !reflect.DeepEqual(alloc.Shares, wantShares) {
+		t.Errorf("payment shares %+v", alloc.Shares)
+	}
+	journal := queryJournal(t, stub, "2026-10-01", "2026-10-31")
+	for _, holder := range []string{"V1", "F1", "F2"} {
+		if got := balance(journal, holder, "1200"); got != "30.00" || heldBy(inv, holder).String() != got {
+			t.Errorf("%s has a receivable of %s and holds %s, want 30.00", holder, got, heldBy(inv, holder))
+		}
+	}
+
+	//F1 gives all it holds to F2, who now holds the most
+	mustInvoke(t, stub, RoleFinancier, "F1", "transfer_share", inv1, "F1", "F2")
+	inv = readInvoice(t, stub, "V1", "INV-1")
+	if wantTable = []Share{{Holder: "V1", Percent: "33.3333333334"}, {Holder: "F2", Percent: "66.6666666666"}}; inv.Owner != "F2" || !reflect.DeepEqual(inv.CapTable, wantTable) {
+		t.Errorf("owner %s cap table %+v after F1 gave its share away", inv.Owner, inv.CapTable)
+	}
+	if _, payload := lastEvent(t, stub); len(payload.Events) != 2 || payload.Events[1].PreviousOwner != "V1" || payload.Events[1].NewOwner != "F2" {
+		t.Errorf("events %+v, want the transfer and the owner change", payload.Events)
+	}
+	if _, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "cancel_invoice", inv1); !errorMatches(err, "is held by V1, F2") {
+		t.Errorf("vendor cancelling an invoice it gave part of away: %v", err)
+	}
+}
+
+func TestTransferShareEncumbered(t *testing.T) {
+	inv1 := invoiceKey("V1", "INV-1")
+	stub := newMockStub()
+	setupLedger(t, stub)
+	mustInvoke(t, stub, RoleVendor, "V1", "pledge_invoice", inv1, "B1")
+	_, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "transfer_share", inv1, "V1", "F1", "50")
+	if e := errorOf(err); e.Code != CodeEncumbered || !errorMatches(err, "pledged to B1") {
+		t.Errorf("transfer of a pledged invoice: %v", err)
+	}
+
+	//giving part away takes down a listing of the whole, the invoice stays with its holders in the registry
+	stub = newMockStub()
+	setupLedger(t, stub)
+	openTrade(t, stub)
+	mustInvoke(t, stub, RoleVendor, "V1", "transfer_share", inv1, "V1", "F1", "50")
+	if _, payload := lastEvent(t, stub); !reflect.DeepEqual(eventNames(payload), []string{EventShareTransferred, EventTradeCleaned}) {
+		t.Errorf("events %v, want the transfer and the listing cleaned up", eventNames(payload))
+	}
+	if enc := queryEncumbrance(t, stub, inv1); enc.Status != EncumbranceSold || enc.Holder != "V1" {
+		t.Errorf("encumbrance after the listing was cleaned up %+v", enc)
+	}
+}
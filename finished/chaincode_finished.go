@@ -20,13 +20,11 @@ under the License.
 package main
 
 import (
-	"errors"
 	"fmt"
 	"strconv"
 	"encoding/json"
 	"time"
-	"strings"
-	"log"
+	"os"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 )
 
@@ -37,6 +35,7 @@ type SimpleChaincode struct {
 var openTradesStr = "_opentrades"				//name for the key/value that will store all open trades
 
 
+//JSON array indexes from before records had one index key per entry, only read by migrate_keys
 var invoiceIndexStr = "_invoiceindex" 
 var accountIndexStr = "_accountindex"
 var paymentIndexStr = "_paymentindex"
@@ -46,7 +45,7 @@ type Invoice struct{
 	VendorID string `json:"vendorid"`
 	CustomerID string `json:"customerid"`
 	InvoiceNumber string `json:"invoicenumber"`	
-	InvoiceAmount float64 `json:"invoiceamount"`
+	InvoiceAmount Money `json:"invoiceamount"`
 	Currency string `json:"currency"`	
 	Material string `json:"material"`
 	Quantity int `json:"quantity"`
@@ -54,11 +53,30 @@ type Invoice struct{
 	PaymentDate string `json:"paymentdate"`
 	Status string `json:"status"`
 	NewPaymentDate string `json:"newpaymentdate"`
+	PaidAmount Money `json:"paidamount"`								//sum of all payments applied so far
+	OutstandingAmount Money `json:"outstandingamount"`					//invoice amount still to be paid
+	Payments []Allocation `json:"payments"`								//payments that settled part of this invoice
+	StatusHistory []StatusChange `json:"statushistory"`				//every lifecycle transition, oldest first
+	Owner string `json:"owner"`												//largest holder on the cap table, the vendor until the invoice is sold
+	Purchases []Purchase `json:"purchases"`								//every sale of the right to collect, oldest first
+	CapTable []Share `json:"captable"`										//who holds the right to collect and how much of it, together 100 percent
 } 
 
+//for one holder on the cap table of an invoice
+type Share struct{
+	Holder string `json:"holder"`
+	Percent string `json:"percent"`										//of the invoice, collects this much of every payment
+}
+
+//for what one holder collected of a payment
+type Collection struct{
+	Holder string `json:"holder"`
+	Amount Money `json:"amount"`
+}
+
 //for account
-type Invoice struct{
-	ID string `json:"vendorid"`
+type Account struct{
+	ID string `json:"id"`
 	AccountName string `json:"accountname"`
 	AccountType string `json:"accounttype"`	
 	Address string `json:"address"`
@@ -69,23 +87,80 @@ type Invoice struct{
 } 
 
 //for payment
-type Invoice struct{
+type Payment struct{
 	PaymentID string `json:"paymentId"`
 	VendorID string `json:"vendorid"`
 	CustomerID string `json:"customerid"`
 	InvoiceID string `json:"invoiceid"`	
-	Amount float64 `json:"amount"`
+	Amount Money `json:"amount"`
 	Currency string `json:"currency"`
-	BankerID string `json:"bankerid"	
+	BankerID string `json:"bankerid"`
 	PaymentDate string `json:"paymentdate"`
 	TradeID string `json:"tradeid"`
 	NewPaymentDate string `json:"newpaymentdate"`
+	Status string `json:"status"`											//pending until the customer's banker confirms it
+	ConfirmedBy string `json:"confirmedby"`
+	ConfirmedAt int64 `json:"confirmedat"`
+	Allocations []Allocation `json:"allocations"`							//invoices this payment covered, with the amount for each
 } 
 
+//for the split of a payment across invoices
+type Allocation struct{
+	PaymentID string `json:"paymentid"`
+	InvoiceID string `json:"invoiceid"`
+	Amount Money `json:"amount"`											//in the payment currency
+	AppliedAmount Money `json:"appliedamount"`							//in the invoice currency
+	FXRate string `json:"fxrate,omitempty"`								//rate used when the currencies differ
+	Payee string `json:"payee"`												//owner of the invoice when it was paid, who collected
+	Shares []Collection `json:"shares,omitempty"`						//what each holder collected, for an invoice with more than one
+}
+
+//for an order in the trade book, an ask sells the right to collect an invoice at a discount to its outstanding amount,
+//a bid buys any invoice due within its tenor at its discount or more
+type AnOpenTrade struct{
+	ID string `json:"id"`												//id of the transaction that opened the trade
+	Side string `json:"side,omitempty"`									//ask or bid, trades stored before bids were taken are asks
+	User string `json:"user"`												//seller of an ask, the holder of the invoice when it was listed, buyer of a bid
+	Timestamp int64 `json:"timestamp"`										//utc timestamp of creation, the trade id before trades had one
+	InvoiceID string `json:"invoiceid"`									//only for an ask
+	DueDate string `json:"duedate,omitempty"`								//payment date of the invoice of an ask
+	Tenor int `json:"tenor,omitempty"`										//most days to the due date a bid takes, 0 for any
+	Expires int64 `json:"expires,omitempty"`								//utc timestamp it can no longer be filled from, 0 for never
+	FaceValue Money `json:"facevalue"`									//face value still offered or wanted
+	Filled Money `json:"filled"`											//face value bought or sold so far
+	Currency string `json:"currency"`
+	Discount string `json:"discount"`										//asking or bid discount in percent of the face value
+	Price Money `json:"price"`											//face value less the discount, what the buyer pays
+}
+
+//for the sale of an invoice, kept on the invoice
+type Purchase struct{
+	TradeID string `json:"tradeid"`
+	Seller string `json:"seller"`
+	Buyer string `json:"buyer"`
+	FaceValue Money `json:"facevalue"`
+	Discount string `json:"discount"`
+	Price Money `json:"price"`
+	Percent string `json:"percent,omitempty"`								//of the invoice that changed hands
+	Timestamp int64 `json:"timestamp"`
+	BidID string `json:"bidid,omitempty"`									//bid that bought it, empty when bought off the ask
+}
+
+//for all the open trade orders, each side of the book best first: the highest discount ask, the lowest discount bid, then the oldest
+type AllTrades struct{
+	OpenTrades []AnOpenTrade `json:"open_trades"`							//asks
+	Bids []AnOpenTrade `json:"bids"`
+}
+
 // ============================================================================================================================
 // Main
 // ============================================================================================================================
+var runTool func(args []string) bool										//the gateway and erpctl, only built with -tags tools, see tools.go
+
 func main() {
+	if runTool != nil && runTool(os.Args) {
+		return
+	}
 	err := shim.Start(new(SimpleChaincode))
 	if err != nil {
 		fmt.Printf("Error starting Simple chaincode: %s", err)
@@ -95,18 +170,38 @@ func main() {
 // ============================================================================================================================
 // Init - reset all the things
 // ============================================================================================================================
-func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string, args []string) (res []byte, err error) {
 	var Aval int
-	var err error
+	var names []string
 	fmt.Printf("intot init")
+	defer func(named bool) {												//errors go back as {"code", "field", "message"}
+		err = envelope(err, names, named)
+	}(isJSONObject(args))
+
+	//the first deploy may set up the ledger, after that only an admin may reset it
+	initAsBytes, err := stub.GetState(openTradesStr)
+	if err != nil {
+		return nil, newError(CodeInternal, "", "Failed to get opentrades")
+	}
+	if initAsBytes != nil {
+		_, err = requireRole(stub, RoleAdmin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	args, names, err = namedArgs(invokeParams["init"], args)				//{"value": 99} is the same as "99"
+	if err != nil {
+		return nil, err
+	}
 	if len(args) != 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 1")
 	}
 
 	// Initialize the chaincode
 	Aval, err = strconv.Atoi(args[0])
 	if err != nil {
-		return nil, errors.New("Expecting integer value for asset holding")
+		return nil, argError(CodeInvalidArgument, 1, "Expecting integer value for asset holding")
 	}
 
 	// Write the state to the ledger
@@ -115,23 +210,8 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string
 		return nil, err
 	}
 	
-	var empty []string
-	jsonAsBytes, _ := json.Marshal(empty)								//marshal an emtpy array of strings to clear the index
-	err = stub.PutState(invoiceIndexStr, jsonAsBytes)
-	if err != nil {
-		return nil, err
-	}
-	
-	var emptyInv []string
-	jsonAsBytesInv, _ := json.Marshal(emptyInv)								//marshal an emtpy array of strings to clear the index
-	err = stub.PutState(invoiceIndexStr, jsonAsBytesInv)
-	if err != nil {
-		return nil, err
-	}
-	
 	var trades AllTrades
-	jsonAsBytes, _ = json.Marshal(trades)								//clear the open trade struct
-	err = stub.PutState(openTradesStr, jsonAsBytes)
+	err = putTrades(stub, trades)										//clear the open trade struct
 	if err != nil {
 		return nil, err
 	}
@@ -147,11 +227,67 @@ func (t *SimpleChaincode) Run(stub shim.ChaincodeStubInterface, function string,
 	return t.Invoke(stub, function, args)
 }
 
+// invokeRoles - the roles allowed to call each function of the Invoke dispatcher, checks on which records they may touch happen in the function
+var invokeRoles = map[string][]string{
+	"init":                 {RoleAdmin},
+	"write":                {RoleAdmin},
+	"create_invoice":       {RoleVendor, RoleAdmin},
+	"issue_invoice":        {RoleVendor, RoleAdmin},
+	"acknowledge_invoice":  {RoleCustomer, RoleAdmin},
+	"close_invoice":        {RoleVendor, RoleAdmin},
+	"dispute_invoice":      {RoleVendor, RoleCustomer, RoleAdmin},
+	"resolve_dispute":      {RoleVendor, RoleCustomer, RoleAdmin},
+	"cancel_invoice":       {RoleVendor, RoleAdmin},
+	"create_account":       {RoleBanker, RoleAdmin},
+	"create_payment":       {RoleCustomer, RoleAdmin},
+	"create_payment_multi": {RoleCustomer, RoleAdmin},
+	"confirm_payment":      {RoleBanker},
+	"set_fx_rate":          {RoleAdmin},
+	"set_gl_account":       {RoleAdmin},
+	"post_adjustment":      {RoleAdmin},
+	"open_period":          {RoleAdmin},
+	"soft_close_period":    {RoleAdmin},
+	"hard_close_period":    {RoleAdmin},
+	"migrate_keys":         {RoleAdmin},
+	"set_user":             {RoleVendor, RoleFinancier, RoleAdmin},
+	"transfer_share":       {RoleVendor, RoleFinancier, RoleAdmin},
+	"open_trade":           {RoleVendor, RoleFinancier, RoleAdmin},
+	"perform_trade":        {RoleFinancier, RoleAdmin},
+	"place_bid":            {RoleFinancier, RoleAdmin},
+	"remove_trade":         {RoleVendor, RoleFinancier, RoleAdmin},
+	"expire_trades":        {RoleVendor, RoleFinancier, RoleAdmin},
+	"pledge_invoice":       {RoleVendor, RoleFinancier, RoleAdmin},
+	"release_pledge":       {RoleFinancier, RoleBanker, RoleAdmin},
+}
+
 // ============================================================================================================================
 // Invoke - Our entry point for Invocations
 // ============================================================================================================================
-func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) (res []byte, err error) {
 	fmt.Println("invoke is running " + function)
+	var names []string														//field name of each argument
+	defer func(named bool) {												//events are only sent for invokes that succeed
+		err = envelope(err, names, named)									//errors go back as {"code", "field", "message"}
+		if err != nil {
+			takeEvents(stub)
+			return
+		}
+		err = flushEvents(stub)
+	}(isJSONObject(args))
+
+	roles, ok := invokeRoles[function]
+	if !ok {
+		fmt.Println("invoke did not find func: " + function)				//error
+		return nil, newError(CodeUnknownFunction, "", "Received unknown function invocation")
+	}
+	_, err = requireRole(stub, roles...)									//every invoke is checked against the caller's certificate
+	if err != nil {
+		return nil, err
+	}
+	args, names, err = namedArgs(invokeParams[function], args)				//a JSON object is turned into the positional arguments
+	if err != nil {
+		return nil, err
+	}
 
 	// Handle different functions
 	if function == "init" {													//initialize the chaincode state, used as reset
@@ -160,59 +296,162 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function stri
 		return t.Write(stub, args)
 	} else if function == "create_invoice" {									//create a new invoice
 		return t.create_invoice(stub, args)
-	else if function == "create_account" {									//create a new account
-		return t.create_invoice(stub, args)
-	else if function == "create_payment" {									//create a new payment
-		return t.create_invoice(stub, args)
+	} else if function == "issue_invoice" {									//draft -> issued
+		return t.issue_invoice(stub, args)
+	} else if function == "acknowledge_invoice" {							//issued -> acknowledged
+		return t.acknowledge_invoice(stub, args)
+	} else if function == "close_invoice" {									//paid -> closed
+		return t.close_invoice(stub, args)
+	} else if function == "dispute_invoice" {								//open invoice -> disputed
+		res, err := t.dispute_invoice(stub, args)
+		if err == nil {														//a disputed invoice cannot be sold
+			err = cleanTrades(stub)
+		}
+		return res, err
+	} else if function == "resolve_dispute" {								//disputed -> status before the dispute
+		return t.resolve_dispute(stub, args)
+	} else if function == "cancel_invoice" {									//draft/issued/disputed -> cancelled
+		res, err := t.cancel_invoice(stub, args)
+		if err == nil {
+			err = cleanTrades(stub)
+		}
+		return res, err
+	} else if function == "create_account" {									//create a new account
+		return t.create_account(stub, args)
+	} else if function == "create_payment" {									//create a new payment against an invoice
+		return t.create_payment(stub, args)
+	} else if function == "create_payment_multi" {							//create a new payment split across several invoices
+		return t.create_payment_multi(stub, args)
+	} else if function == "confirm_payment" {								//banker confirms a payment and it is settled against its invoices
+		res, err := t.confirm_payment(stub, args)
+		if err == nil {														//a listing is for the amount outstanding when it was opened
+			err = cleanTrades(stub)
+		}
+		return res, err
+	} else if function == "set_fx_rate" {									//add or correct an exchange rate
+		return t.set_fx_rate(stub, args)
+	} else if function == "set_gl_account" {								//change the GL account postings for a purpose go to
+		return t.set_gl_account(stub, args)
+	} else if function == "post_adjustment" {								//manual journal entry correcting a closed period
+		return t.post_adjustment(stub, args)
+	} else if function == "open_period" {									//reopen a soft-closed fiscal period
+		return t.open_period(stub, args)
+	} else if function == "soft_close_period" {								//stop postings into a fiscal period
+		return t.soft_close_period(stub, args)
+	} else if function == "hard_close_period" {								//close a fiscal period for good
+		return t.hard_close_period(stub, args)
+	} else if function == "migrate_keys" {									//one-off move of records to namespaced keys
+		return t.migrate_keys(stub, args)
 	} else if function == "set_user" {										//change owner of a invoice
 		res, err := t.set_user(stub, args)
-		cleanTrades(stub)													//lets make sure all open trades are still valid
+		if err == nil {														//lets make sure all open trades are still valid
+			err = cleanTrades(stub)
+		}
 		return res, err
-	} else if function == "open_trade" {									//create a new trade order
+	} else if function == "transfer_share" {								//give a share of an invoice to another party
+		res, err := t.transfer_share(stub, args)
+		if err == nil {														//the giver may have listed more than it holds now
+			err = cleanTrades(stub)
+		}
+		return res, err
+	} else if function == "open_trade" {									//list an invoice for sale
 		return t.open_trade(stub, args)
-	} else if function == "perform_trade" {									//forfill an open trade order
+	} else if function == "perform_trade" {									//a financier buys a listed invoice
 		res, err := t.perform_trade(stub, args)
-		cleanTrades(stub)													//lets clean just in case
+		if err == nil {														//lets clean just in case
+			err = cleanTrades(stub)
+		}
 		return res, err
-	} else if function == "remove_trade" {									//cancel an open trade order
+	} else if function == "place_bid" {										//a financier bids for invoices
+		return t.place_bid(stub, args)
+	} else if function == "remove_trade" {									//take a listing or a bid down
 		return t.remove_trade(stub, args)
+	} else if function == "expire_trades" {									//sweep expired orders out of the book
+		return t.expire_trades(stub, args)
+	} else if function == "pledge_invoice" {								//give an invoice to a lender as collateral
+		return t.pledge_invoice(stub, args)
+	} else if function == "release_pledge" {								//lender gives a pledged invoice back
+		return t.release_pledge(stub, args)
 	}
 	fmt.Println("invoke did not find func: " + function)					//error
 
-	return nil, errors.New("Received unknown function invocation")
+	return nil, newError(CodeUnknownFunction, "", "Received unknown function invocation")
 }
 
 // ============================================================================================================================
 // Query - Our entry point for Queries
 // ============================================================================================================================
-func (t *SimpleChaincode) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+func (t *SimpleChaincode) Query(stub shim.ChaincodeStubInterface, function string, args []string) (res []byte, err error) {
 	fmt.Println("query is running " + function)
+	var names []string
+	defer func(named bool) {												//errors go back as {"code", "field", "message"}
+		err = envelope(err, names, named)
+	}(isJSONObject(args))
+	args, names, err = namedArgs(queryParams[function], args)				//a JSON object is turned into the positional arguments
+	if err != nil {
+		return nil, err
+	}
 
 	// Handle different functions
 	if function == "read" {													//read a variable
 		return t.read(stub, args)
+	} else if function == "payments_for_invoice" {							//payments that settled an invoice
+		return t.payments_for_invoice(stub, args)
+	} else if function == "invoices_for_payment" {							//invoices a payment covered
+		return t.invoices_for_payment(stub, args)
+	} else if function == "invoices_by" {									//invoices of a vendor, customer, status or due date range
+		return t.invoices_by(stub, args)
+	} else if function == "list_invoices" {									//a page of invoices, filtered and sorted
+		return t.list_invoices(stub, args)
+	} else if function == "list_accounts" {									//a page of accounts
+		return t.list_accounts(stub, args)
+	} else if function == "list_payments" {									//a page of payments
+		return t.list_payments(stub, args)
+	} else if function == "history" {										//every version of a record, with who changed what
+		return t.history(stub, args)
+	} else if function == "get_fx_rate" {									//exchange rate in effect on a date
+		return t.get_fx_rate(stub, args)
+	} else if function == "invoice_report" {								//invoices in a reporting currency
+		return t.invoice_report(stub, args)
+	} else if function == "journal" {										//journal entries of a period, with their totals
+		return t.journal(stub, args)
+	} else if function == "chart_of_accounts" {								//GL account for each purpose
+		return t.chart_of_accounts(stub, args)
+	} else if function == "trial_balance" {									//balances of every GL account on a date
+		return t.trial_balance(stub, args)
+	} else if function == "account_balance" {								//balance of one GL account of a party on a date
+		return t.account_balance(stub, args)
+	} else if function == "fiscal_periods" {								//status of every closed fiscal period
+		return t.fiscal_periods(stub, args)
+	} else if function == "trade_depth" {									//open asks and bids by discount and tenor
+		return t.trade_depth(stub, args)
+	} else if function == "closed_trades" {									//orders that left the book and why
+		return t.closed_trades(stub, args)
+	} else if function == "encumbrance_status" {							//whether an invoice is already listed, pledged or sold
+		return t.encumbrance_status(stub, args)
+	} else if function == "fingerprint_status" {							//the same for an invoice given by its printed fields
+		return t.fingerprint_status(stub, args)
 	}
 	fmt.Println("query did not find func: " + function)						//error
 
-	return nil, errors.New("Received unknown function query")
+	return nil, newError(CodeUnknownFunction, "", "Received unknown function query")
 }
 
 // ============================================================================================================================
 // Read - read a variable from chaincode state
 // ============================================================================================================================
 func (t *SimpleChaincode) read(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	var name, jsonResp string
+	var name string
 	var err error
 
 	if len(args) != 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting name of the var to query")
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting name of the var to query")
 	}
 
 	name = args[0]
 	valAsbytes, err := stub.GetState(name)									//get the var from chaincode state
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + name + "\"}"
-		return nil, errors.New(jsonResp)
+		return nil, newError(CodeInternal, "name", "Failed to get state for " + name)
 	}
 
 	return valAsbytes, nil													//send it onward
@@ -229,7 +468,7 @@ func (t *SimpleChaincode) Write(stub shim.ChaincodeStubInterface, args []string)
 	fmt.Println("running write()")
 
 	if len(args) != 2 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 2. name of the variable and value to set")
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 2. name of the variable and value to set")
 	}
 
 	name = args[0]															//rename for funsies
@@ -247,556 +486,376 @@ func (t *SimpleChaincode) create_invoice(stub shim.ChaincodeStubInterface, args
 	var err error
 
 	if len(args) != 11 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 11")
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 11")
 	}
 	
 	//input sanitation
 	fmt.Println("- start init invoice")
 	if len(args[0]) <= 0 {
 		// Vendor ID //
-		return nil, errors.New("1st argument must be a non-empty string")
+		return nil, argError(CodeRequired, 1, "1st argument must be a non-empty string")
 	}
 	if len(args[1]) <= 0 {
 		// Customer ID //
-		return nil, errors.New("2nd argument must be a non-empty string")
+		return nil, argError(CodeRequired, 2, "2nd argument must be a non-empty string")
 	}
 	if len(args[2]) <= 0 {
 		//Invoice Number //
-		return nil, errors.New("3rd argument must be a non-empty string")
+		return nil, argError(CodeRequired, 3, "3rd argument must be a non-empty string")
 	}
 	if len(args[3]) <= 0 {
 		// Invoice Amount //
-		return nil, errors.New("4th argument must be a non-empty string")
+		return nil, argError(CodeRequired, 4, "4th argument must be a non-empty string")
 	}
 	if len(args[4]) <= 0 {
 		// Currency //
-		return nil, errors.New("5th argument must be a non-empty string")
+		return nil, argError(CodeRequired, 5, "5th argument must be a non-empty string")
 	}
 	if len(args[5]) <= 0 {
 		// Material //
-		return nil, errors.New("6th argument must be a non-empty string")
+		return nil, argError(CodeRequired, 6, "6th argument must be a non-empty string")
 	}
 	if len(args[6]) <= 0 {
 		// Quantity //
-		return nil, errors.New("7th argument must be a non-empty string")
+		return nil, argError(CodeRequired, 7, "7th argument must be a non-empty string")
 	}
 	if len(args[7]) <= 0 {
 		// Trader ID //
-		return nil, errors.New("8th argument must be a non-empty string")
+		return nil, argError(CodeRequired, 8, "8th argument must be a non-empty string")
 	}
 	if len(args[8]) <= 0 {
 		// Payment Date //
-		return nil, errors.New("9th argument must be a non-empty string")
+		return nil, argError(CodeRequired, 9, "9th argument must be a non-empty string")
 	}
 	if len(args[9]) <= 0 {
 		// Status //
-		return nil, errors.New("10th argument must be a non-empty string")
+		return nil, argError(CodeRequired, 10, "10th argument must be a non-empty string")
+	}
+	if args[9] != StatusDraft && args[9] != StatusIssued {
+		// Status //
+		return nil, argError(CodeInvalidArgument, 10, "10th argument must be the initial status \""+StatusDraft+"\" or \""+StatusIssued+"\"")
 	}
 	if len(args[10]) <= 0 {
 		// New Payment Date //
-		return nil, errors.New("11th argument must be a non-empty string")
+		return nil, argError(CodeRequired, 11, "11th argument must be a non-empty string")
+	}
+	err = checkCurrency("currency", args[4])
+	if err != nil {
+		return nil, err
+	}
+	InvoiceAmount, err := ParseMoney(args[3], args[4])
+	if err != nil {
+		return nil, argError(codeOf(err, CodeInvalidArgument), 4, "4th argument must be a decimal amount: "+err.Error())
+	}
+	if InvoiceAmount.Sign() <= 0 {
+		return nil, argError(CodeOutOfRange, 4, "4th argument must be greater than zero")
+	}
+	Quantity, err := strconv.Atoi(args[6])
+	if err != nil {
+		return nil, argError(CodeInvalidArgument, 7, "7th argument must be a numeric string")
+	}
+
+	invoice := Invoice{}
+	invoice.VendorID = args[0]
+	invoice.CustomerID = args[1]
+	invoice.InvoiceNumber = args[2]
+	invoice.InvoiceAmount = InvoiceAmount
+	invoice.Currency = args[4]
+	invoice.Material = args[5]
+	invoice.Quantity = Quantity
+	invoice.TradeID = args[7]
+	invoice.PaymentDate = args[8]
+	invoice.Status = args[9]
+	invoice.NewPaymentDate = args[10]
+	invoice.PaidAmount = ZeroMoney(invoice.Currency)
+	invoice.OutstandingAmount = InvoiceAmount
+	setCapTable(&invoice, []Share{{Holder: invoice.VendorID, Percent: "100"}})
+	err = validateInvoice(invoice)
+	if err != nil {
+		return nil, err
+	}
+	err = atArgument(checkKeyPart("1st argument", invoice.VendorID), 1)
+	if err != nil {
+		return nil, err
 	}
-	VendorID := args[0]
-	CustomerID := args[1]
-	InvoiceNumber := args[2]
-	InvoiceAmount := args[3]
-	Currency := args[4]
-	Material := args[5]
-	Quantity := args[6]
-	TraderID := args[7]
-	PaymentDate := args[8]
-	Status := args[9]
-	NewPaymentDate := args[10]
+	err = atArgument(checkKeyPart("2nd argument", invoice.CustomerID), 2)
+	if err != nil {
+		return nil, err
+	}
+	err = atArgument(checkKeyPart("3rd argument", invoice.InvoiceNumber), 3)
+	if err != nil {
+		return nil, err
+	}
+	InvoiceKey := invoiceKey(invoice.VendorID, invoice.InvoiceNumber)
+	InvoiceNumber := invoice.InvoiceNumber
 
+	//vendors may only invoice as themselves
+	err = checkParty(stub, invoice)
 	if err != nil {
-		return nil, errors.New("3rd argument must be a numeric string")
+		return nil, err
 	}
 
-	//check if invoice already exists
-	invoiceAsBytes, err := stub.GetState(InvoiceNumber)
+	//an invoice is dated on the day it is created, which must be in an open period
+	today, err := txDate(stub)
 	if err != nil {
-		return nil, errors.New("Failed to get Invoice number")
+		return nil, err
+	}
+	err = checkPeriodOpen(stub, "", today)
+	if err != nil {
+		return nil, err
+	}
+
+	//check if invoice already exists, numbers only need to be unique per vendor
+	invoiceAsBytes, err := stub.GetState(InvoiceKey)
+	if err != nil {
+		return nil, newError(CodeInternal, "", "Failed to get Invoice number")
 	}
 	res := Invoice{}
 	json.Unmarshal(invoiceAsBytes, &res)
 	if res.InvoiceNumber == InvoiceNumber{
 		fmt.Println("This invoice arleady exists: " + InvoiceNumber)
 		fmt.Println(res);
-		return nil, errors.New("This invoice arleady exists")				//all stop a invoice by this name exists
+		return nil, newError(CodeAlreadyExists, "invoicenumber", "This invoice arleady exists")				//all stop a invoice by this name exists
 	}
 	
 	
 
-	str := `{"vendorid": "` + VendorID + `", "customerid": "` + CustomerID + `", "invoicenumber": "` + InvoiceNumber + `", "invoiceamount": ` + InvoiceAmount + `, "currency": "` + Currency + `", "material": "` + Material + `","quantity":` + Quantity + `,"traderid":"` + TraderID + `","paymentdate":"` + PaymentDate + `","Status":"` + Status + `","newpaymentdate":"` + NewPaymentDate + `"}`
-	err = stub.PutState(VendorID, []byte(str))									//store invoice with id as key
+	err = putInvoice(stub, invoice)											//store invoice under invoice~vendor~number, with its index entries
 	if err != nil {
 		return nil, err
 	}
-		
-	//get the invoice index
-	invoicesAsBytes, err := stub.GetState(invoiceIndexStr)
-	if err != nil {
-		return nil, errors.New("Failed to get invoice index")
+	if invoice.Status == StatusIssued {										//an issued invoice is in the books from now on
+		err = postInvoice(stub, invoice, invoice.InvoiceAmount, false, "invoice " + InvoiceNumber + " issued")
+		if err != nil {
+			return nil, err
+		}
 	}
-	var invoiceIndex []string
-	json.Unmarshal(invoicesAsBytes, &invoiceIndex)							//un stringify it aka JSON.parse()
-	
-	//append
-	invoiceIndex = append(invoiceIndex, VendorID)									//add invoice name to index list
-	fmt.Println("! invoice index: ", invoiceIndex)
-	jsonAsBytes, _ := json.Marshal(invoiceIndex)
-	err = stub.PutState(invoiceIndexStr, jsonAsBytes)						//store name of invoice
+	emitEvent(stub, Event{Name: EventInvoiceCreated, InvoiceID: InvoiceKey, Invoice: &invoice})
 
 	fmt.Println("- end init invoice")
 	return nil, nil
 } 
 
 //this is for account
-
-	 string `json:"vendorid"`
-	 string `json:"accountname"`
-	 string `json:"accounttype"`	
-	 string `json:"address"`
-	  int `json:"bankaccount"`	
-	 string `json:"phone"`
-	 string `json:"bankerid"`
-	
 func (t *SimpleChaincode) create_account(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 	var err error
 
-	
-	ID := args[0]
-	AccountName := args[1]
-	AccountType := args[2]
-	InvoiceAmount := args[3]
-	Address := args[4]
-	BankAccountNumber := args[5]
-	Phone := args[6]
-	BankerID := args[7]
-
-	
+	//	0		1				2				3			4					5		6
+	// "ID", "AccountName", "AccountType", "Address", "BankAccountNumber", "Phone", "BankerID"
+	if len(args) != 7 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 7")
+	}
 
-	//check if account already exists
-	accountAsBytes, err := stub.GetState(ID)
+	fmt.Println("- start init account")
+	err = atArgument(checkKeyPart("1st argument", args[0]), 1)
 	if err != nil {
-		return nil, errors.New("Failed to get account")
+		return nil, err
 	}
-	res := Account{}
-	json.Unmarshal(accountAsBytes, &res)
-	if res.ID == ID{
-		fmt.Println("This invoice arleady exists: " + ID)
-		fmt.Println(res);
-		return nil, errors.New("This account arleady exists")				
+	if len(args[6]) <= 0 {
+		return nil, argError(CodeRequired, 7, "7th argument must be a non-empty string")
 	}
-	
-	
-	str := `{"ID": "` + ID + `", "AccountName": "` + AccountName + `", "AccountType": "` + AccountType + `", "InvoiceAmount": ` + InvoiceAmount + `, "Address": "` + Address + `", "BankAccountNumber": "` + BankAccountNumber + `","Phone":` + Phone + `,"traderid":"` + TraderID + `","BankerID":"` + BankerID + `"}`
-	
-	err = stub.PutState(ID, []byte(str))									
+	BankAccountNumber, err := strconv.Atoi(args[4])
+	if err != nil {
+		return nil, argError(CodeInvalidArgument, 5, "5th argument must be a numeric string")
+	}
+
+	account := Account{}
+	account.ID = args[0]
+	account.AccountName = args[1]
+	account.AccountType = args[2]
+	account.Address = args[3]
+	account.BankAccountNumber = BankAccountNumber
+	account.Phone = args[5]
+	account.BankerID = args[6]
+	err = validateAccount(account)
 	if err != nil {
 		return nil, err
 	}
-		
-	//get the account index
-	accountAsBytes, err := stub.GetState(accountIndexStr)
+
+	//bankers may only open accounts they are the banker on
+	caller, err := getIdentity(stub)
 	if err != nil {
-		return nil, errors.New("Failed to get account index")
+		return nil, err
+	}
+	if caller.Role == RoleBanker && caller.ID != account.BankerID {
+		return nil, newError(CodePermissionDenied, "bankerid", "Banker " + caller.ID + " cannot open an account for banker " + account.BankerID)
 	}
-	var invoiceIndex []string
-	json.Unmarshal(invoicesAsBytes, &invoiceIndex)							//un stringify it aka JSON.parse()
-	
-	//append
-	accountIndex = append(accountIndex, ID)									//add account id to index list
-	fmt.Println("! invoice index: ", accountAsBytes)
-	jsonAsBytes, _ := json.Marshal(accountAsBytes)
-	err = stub.PutState(accountIndexStr, jsonAsBytes)						//store name of account
-
-	fmt.Println("- end init account")
-	return nil, nil
-} 
-//create payment
-func (t *SimpleChaincode) create_payment(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	var err error
-
-	PaymentID := args[0]
-	VendorID := args[1]
-	CustomerID := args[2]
-	InvoiceID := args[3]
-	Amount := args[4]
-	Currency := args[5]
-	BankerID := args[6]
-	PaymentDate := args[7]
-	TraderID := args[8]
-	NewPaymentDate := args[9]
-
-	
 
-	//check if payment already exists
-	paymentAsBytes, err := stub.GetState(ID)
+	//check if account already exists
+	accountAsBytes, err := stub.GetState(accountKey(account.ID))
 	if err != nil {
-		return nil, errors.New("Failed to get payment")
+		return nil, newError(CodeInternal, "", "Failed to get account")
 	}
-	res := Payment{}
-	json.Unmarshal(paymentAsBytes, &res)
-	if res.ID == ID{
-		fmt.Println("This invoice arleady exists: " + ID)
+	res := Account{}
+	json.Unmarshal(accountAsBytes, &res)
+	if res.ID == account.ID{
+		fmt.Println("This account arleady exists: " + account.ID)
 		fmt.Println(res);
-		return nil, errors.New("This account arleady exists")				
+		return nil, newError(CodeAlreadyExists, "id", "This account arleady exists")
 	}
-	
-	
-	str := `{"vendorid": "` + VendorID + `", "customerid": "` + CustomerID + `", "InvoiceID": "` + InvoiceID + `", "Amount": ` + Amount + `, "currency": "` + Currency + `", "BankerID": "` + BankerID + `","paymentdate":"` + PaymentDate + `","traderid":"` + TraderID + `","newpaymentdate":"` + NewPaymentDate + `"}`
-	
-	err = stub.PutState(ID, []byte(str))									
+
+	err = putAccount(stub, account)											//store account under account~id, with its index entries
 	if err != nil {
 		return nil, err
 	}
-		
-	//get the account index
-	paymentAsBytes, err := stub.GetState(accountIndexStr)
-	if err != nil {
-		return nil, errors.New("Failed to get account index")
-	}
-	var paymentIndex []string
-	json.Unmarshal(invoicesAsBytes, &paymentIndex)							//un stringify it aka JSON.parse()
-	
-	//append
-	paymentIndex = append(paymentIndex, ID)									//add account id to index list
-	fmt.Println("! invoice index: ", paymentAsBytes)
-	jsonAsBytes, _ := json.Marshal(paymentAsBytes)
-	err = stub.PutState(accountIndexStr, jsonAsBytes)						//store name of account
+	emitEvent(stub, Event{Name: EventAccountCreated, Account: &account})
 
 	fmt.Println("- end init account")
 	return nil, nil
 } 
 // ============================================================================================================================
-// Set User Permission on invoice
+// Get Account - read an account from chaincode state
 // ============================================================================================================================
-func (t *SimpleChaincode) set_user(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	var err error
-	
-	//   0       1
-	// "name", "bob"
-	if len(args) < 2 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 2")
-	}
-	
-	fmt.Println("- start set user")
-	fmt.Println(args[0] + " - " + args[1])
-	invoiceAsBytes, err := stub.GetState(args[0])
+func getAccount(stub shim.ChaincodeStubInterface, id string) (Account, error) {
+	var account Account
+	accountAsBytes, err := stub.GetState(accountKey(id))
 	if err != nil {
-		return nil, errors.New("Failed to get thing")
+		return account, newError(CodeInternal, "", "Failed to get account "+id)
 	}
-	res := invoice{}
-	json.Unmarshal(invoiceAsBytes, &res)										//un stringify it aka JSON.parse()
-	res.User = args[1]														//change the user
-	
-	jsonAsBytes, _ := json.Marshal(res)
-	err = stub.PutState(args[0], jsonAsBytes)								//rewrite the invoice with id as key
+	if accountAsBytes == nil {
+		return account, newError(CodeNotFound, "", "Account does not exist: " + id)
+	}
+	err = json.Unmarshal(accountAsBytes, &account)							//un stringify it aka JSON.parse()
 	if err != nil {
-		return nil, err
+		return account, newError(CodeInternal, "", "Account "+id+" is corrupt")
 	}
-	
-	fmt.Println("- end set user")
-	return nil, nil
+	return account, nil
 }
 
 // ============================================================================================================================
-// Open Trade - create an open trade for a invoice you want with invoices you have 
+// Put Account - write an account to chaincode state and bring its secondary indexes up to date
 // ============================================================================================================================
-func (t *SimpleChaincode) open_trade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	var err error
-	var will_size int
-	var trade_away Description
-	
-	//	0        1      2     3      4      5       6
-	//["bob", "blue", "16", "red", "16"] *"blue", "35*
-	if len(args) < 5 {
-		return nil, errors.New("Incorrect number of arguments. Expecting like 5?")
+func putAccount(stub shim.ChaincodeStubInterface, account Account) error {
+	key := accountKey(account.ID)
+	var oldIndexKeys []string
+	oldAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return newError(CodeInternal, "", "Failed to get account "+key)
 	}
-	if len(args)%2 == 0{
-		return nil, errors.New("Incorrect number of arguments. Expecting an odd number")
+	if oldAsBytes != nil {
+		old := Account{}
+		json.Unmarshal(oldAsBytes, &old)										//un stringify it aka JSON.parse()
+		oldIndexKeys = accountIndexKeys(old)
 	}
 
-	size1, err := strconv.Atoi(args[2])
+	jsonAsBytes, _ := json.Marshal(account)
+	err = stub.PutState(key, jsonAsBytes)
 	if err != nil {
-		return nil, errors.New("3rd argument must be a numeric string")
+		return err
 	}
-
-	open := AnOpenTrade{}
-	open.User = args[0]
-	open.Timestamp = makeTimestamp()											//use timestamp as an ID
-	open.Want.Color = args[1]
-	open.Want.Size =  size1
-	fmt.Println("- start open trade")
-	jsonAsBytes, _ := json.Marshal(open)
-	err = stub.PutState("_debug1", jsonAsBytes)
-
-	for i:=3; i < len(args); i++ {												//create and append each willing trade
-		will_size, err = strconv.Atoi(args[i + 1])
-		if err != nil {
-			msg := "is not a numeric string " + args[i + 1]
-			fmt.Println(msg)
-			return nil, errors.New(msg)
-		}
-		
-		trade_away = Description{}
-		trade_away.Color = args[i]
-		trade_away.Size =  will_size
-		fmt.Println("! created trade_away: " + args[i])
-		jsonAsBytes, _ = json.Marshal(trade_away)
-		err = stub.PutState("_debug2", jsonAsBytes)
-		
-		open.Willing = append(open.Willing, trade_away)
-		fmt.Println("! appended willing to open")
-		i++;
-	}
-	
-	//get the open trade struct
-	tradesAsBytes, err := stub.GetState(openTradesStr)
+	err = recordHistory(stub, key, jsonAsBytes)
 	if err != nil {
-		return nil, errors.New("Failed to get opentrades")
+		return err
 	}
-	var trades AllTrades
-	json.Unmarshal(tradesAsBytes, &trades)										//un stringify it aka JSON.parse()
-	
-	trades.OpenTrades = append(trades.OpenTrades, open);						//append to open trades
-	fmt.Println("! appended open to trades")
-	jsonAsBytes, _ = json.Marshal(trades)
-	err = stub.PutState(openTradesStr, jsonAsBytes)								//rewrite open orders
-	if err != nil {
-		return nil, err
-	}
-	fmt.Println("- end open trade")
-	return nil, nil
+	return updateIndexes(stub, oldIndexKeys, accountIndexKeys(account), key)
 }
 
-// ============================================================================================================================
-// Perform Trade - close an open trade and move ownership
-// ============================================================================================================================
-func (t *SimpleChaincode) perform_trade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+//create payment
+func (t *SimpleChaincode) create_payment(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 	var err error
-	
-	//	0		1					2					3				4					5
-	//[data.id, data.closer.user, data.closer.name, data.opener.user, data.opener.color, data.opener.size]
-	if len(args) < 6 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 6")
+
+	//	0			1			2			3			4		5			6			7				8			9
+	// "PaymentID", "VendorID", "CustomerID", "InvoiceID", "Amount", "Currency", "BankerID", "PaymentDate", "TradeID", "NewPaymentDate"
+	// an empty "PaymentDate" is the day of the transaction
+	if len(args) != 10 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 10")
 	}
-	
-	fmt.Println("- start close trade")
-	timestamp, err := strconv.ParseInt(args[0], 10, 64)
-	if err != nil {
-		return nil, errors.New("1st argument must be a numeric string")
+
+	fmt.Println("- start create payment")
+	if len(args[0]) <= 0 {
+		return nil, argError(CodeRequired, 1, "1st argument must be a non-empty string")
 	}
-	
-	size, err := strconv.Atoi(args[5])
-	if err != nil {
-		return nil, errors.New("6th argument must be a numeric string")
+	if len(args[3]) <= 0 {
+		return nil, argError(CodeRequired, 4, "4th argument must be a non-empty string")
 	}
-	
-	//get the open trade struct
-	tradesAsBytes, err := stub.GetState(openTradesStr)
+	err = checkCurrency("currency", args[5])
 	if err != nil {
-		return nil, errors.New("Failed to get opentrades")
+		return nil, err
 	}
-	var trades AllTrades
-	json.Unmarshal(tradesAsBytes, &trades)															//un stringify it aka JSON.parse()
-	
-	for i := range trades.OpenTrades{																//look for the trade
-		fmt.Println("looking at " + strconv.FormatInt(trades.OpenTrades[i].Timestamp, 10) + " for " + strconv.FormatInt(timestamp, 10))
-		if trades.OpenTrades[i].Timestamp == timestamp{
-			fmt.Println("found the trade");
-			
-			
-			invoiceAsBytes, err := stub.GetState(args[2])
-			if err != nil {
-				return nil, errors.New("Failed to get thing")
-			}
-			closersinvoice := invoice{}
-			json.Unmarshal(invoiceAsBytes, &closersinvoice)											//un stringify it aka JSON.parse()
-			
-			//verify if invoice meets trade requirements
-			if closersinvoice.Color != trades.OpenTrades[i].Want.Color || closersinvoice.Size != trades.OpenTrades[i].Want.Size {
-				msg := "invoice in input does not meet trade requriements"
-				fmt.Println(msg)
-				return nil, errors.New(msg)
-			}
-			
-			invoice, e := findinvoice4Trade(stub, trades.OpenTrades[i].User, args[4], size)			//find a invoice that is suitable from opener
-			if(e == nil){
-				fmt.Println("! no errors, proceeding")
-
-				t.set_user(stub, []string{args[2], trades.OpenTrades[i].User})						//change owner of selected invoice, closer -> opener
-				t.set_user(stub, []string{invoice.Name, args[1]})									//change owner of selected invoice, opener -> closer
-			
-				trades.OpenTrades = append(trades.OpenTrades[:i], trades.OpenTrades[i+1:]...)		//remove trade
-				jsonAsBytes, _ := json.Marshal(trades)
-				err = stub.PutState(openTradesStr, jsonAsBytes)										//rewrite open orders
-				if err != nil {
-					return nil, err
-				}
-			}
-		}
+	amount, err := ParseMoney(args[4], args[5])
+	if err != nil {
+		return nil, argError(codeOf(err, CodeInvalidArgument), 5, "5th argument must be a decimal amount: "+err.Error())
 	}
-	fmt.Println("- end close trade")
-	return nil, nil
-}
 
-// ============================================================================================================================
-// findinvoice4Trade - look for a matching invoice that this user owns and return it
-// ============================================================================================================================
-func findinvoice4Trade(stub shim.ChaincodeStubInterface, user string, color string, size int )(m invoice, err error){
-	var fail invoice;
-	fmt.Println("- start find invoice 4 trade")
-	fmt.Println("looking for " + user + ", " + color + ", " + strconv.Itoa(size));
+	payment := Payment{}
+	payment.PaymentID = args[0]
+	payment.VendorID = args[1]
+	payment.CustomerID = args[2]
+	payment.InvoiceID = args[3]
+	payment.Amount = amount
+	payment.Currency = args[5]
+	payment.BankerID = args[6]
+	payment.PaymentDate = args[7]
+	payment.TradeID = args[8]
+	payment.NewPaymentDate = args[9]
 
-	//get the invoice index
-	invoicesAsBytes, err := stub.GetState(invoiceIndexStr)
-	if err != nil {
-		return fail, errors.New("Failed to get invoice index")
-	}
-	var invoiceIndex []string
-	json.Unmarshal(invoicesAsBytes, &invoiceIndex)								//un stringify it aka JSON.parse()
-	
-	for i:= range invoiceIndex{													//iter through all the invoices
-		//fmt.Println("looking @ invoice name: " + invoiceIndex[i]);
+	payment.Allocations = []Allocation{{PaymentID: payment.PaymentID, InvoiceID: payment.InvoiceID, Amount: payment.Amount}}
 
-		invoiceAsBytes, err := stub.GetState(invoiceIndex[i])						//grab this invoice
-		if err != nil {
-			return fail, errors.New("Failed to get invoice")
-		}
-		res := invoice{}
-		json.Unmarshal(invoiceAsBytes, &res)										//un stringify it aka JSON.parse()
-		//fmt.Println("looking @ " + res.User + ", " + res.Color + ", " + strconv.Itoa(res.Size));
-		
-		//check for user && color && size
-		if strings.ToLower(res.User) == strings.ToLower(user) && strings.ToLower(res.Color) == strings.ToLower(color) && res.Size == size{
-			fmt.Println("found a invoice: " + res.Name)
-			fmt.Println("! end find invoice 4 trade")
-			return res, nil
-		}
+	err = recordPayment(stub, payment)
+	if err != nil {
+		return nil, err
 	}
-	
-	fmt.Println("- end find invoice 4 trade - error")
-	return fail, errors.New("Did not find invoice to use in this trade")
-}
-
-// ============================================================================================================================
-// Make Timestamp - create a timestamp in ms
-// ============================================================================================================================
-func makeTimestamp() int64 {
-    return time.Now().UnixNano() / (int64(time.Millisecond)/int64(time.Nanosecond))
-}
 
+	fmt.Println("- end create payment")
+	return nil, nil
+} 
 // ============================================================================================================================
-// Remove Open Trade - close an open trade
+// Set User - give the whole of an invoice to another party, use transfer_share for part of it
 // ============================================================================================================================
-func (t *SimpleChaincode) remove_trade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+func (t *SimpleChaincode) set_user(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 	var err error
 	
-	//	0
-	//[data.id]
-	if len(args) < 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	//   0       						1
+	// "invoice~V1~INV-001", "bob"
+	if len(args) < 2 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 2")
 	}
 	
-	fmt.Println("- start remove trade")
-	timestamp, err := strconv.ParseInt(args[0], 10, 64)
+	fmt.Println("- start set user")
+	fmt.Println(args[0] + " - " + args[1])
+	res, err := getInvoice(stub, args[0])
 	if err != nil {
-		return nil, errors.New("1st argument must be a numeric string")
+		return nil, err
 	}
-	
-	//get the open trade struct
-	tradesAsBytes, err := stub.GetState(openTradesStr)
+	previous := invoiceOwner(res)
+	caller, err := getIdentity(stub)
 	if err != nil {
-		return nil, errors.New("Failed to get opentrades")
+		return nil, err
 	}
-	var trades AllTrades
-	json.Unmarshal(tradesAsBytes, &trades)																//un stringify it aka JSON.parse()
-	
-	for i := range trades.OpenTrades{																	//look for the trade
-		//fmt.Println("looking at " + strconv.FormatInt(trades.OpenTrades[i].Timestamp, 10) + " for " + strconv.FormatInt(timestamp, 10))
-		if trades.OpenTrades[i].Timestamp == timestamp{
-			fmt.Println("found the trade");
-			trades.OpenTrades = append(trades.OpenTrades[:i], trades.OpenTrades[i+1:]...)				//remove this trade
-			jsonAsBytes, _ := json.Marshal(trades)
-			err = stub.PutState(openTradesStr, jsonAsBytes)												//rewrite open orders
-			if err != nil {
-				return nil, err
-			}
-			break
-		}
+	if caller.Role != RoleAdmin && caller.ID != previous {
+		return nil, newError(CodePermissionDenied, "invoiceid", "Invoice "+res.InvoiceNumber+" belongs to "+previous+", not "+caller.ID)
+	}
+	if len(capTable(res)) > 1 {
+		return nil, newError(CodeRejected, "invoiceid", "Invoice "+res.InvoiceNumber+" is held in pieces by "+holderNames(res)+", use transfer_share")
 	}
+	err = transferShare(stub, &res, previous, args[1], hundredPercent())	//change the user, rewrites the invoice
+	if err != nil {
+		return nil, err
+	}
+	emitEvent(stub, Event{Name: EventInvoiceOwnerChanged, InvoiceID: args[0], PreviousOwner: previous, NewOwner: invoiceOwner(res)})
 	
-	fmt.Println("- end remove trade")
+	fmt.Println("- end set user")
 	return nil, nil
 }
 
 // ============================================================================================================================
-// Clean Up Open Trades - make sure open trades are still possible, remove choices that are no longer possible, remove trades that have no valid choices
+// Tx Timestamp - the time the transaction was proposed in ms, the same on every peer unlike the local clock
 // ============================================================================================================================
-func cleanTrades(stub shim.ChaincodeStubInterface)(err error){
-	var didWork = false
-	fmt.Println("- start clean trades")
-	
-	//get the open trade struct
-	tradesAsBytes, err := stub.GetState(openTradesStr)
-	if err != nil {
-		return errors.New("Failed to get opentrades")
-	}
-	var trades AllTrades
-	json.Unmarshal(tradesAsBytes, &trades)																		//un stringify it aka JSON.parse()
-	
-	fmt.Println("# trades " + strconv.Itoa(len(trades.OpenTrades)))
-	for i:=0; i<len(trades.OpenTrades); {																		//iter over all the known open trades
-		fmt.Println(strconv.Itoa(i) + ": looking at trade " + strconv.FormatInt(trades.OpenTrades[i].Timestamp, 10))
-		
-		fmt.Println("# options " + strconv.Itoa(len(trades.OpenTrades[i].Willing)))
-		for x:=0; x<len(trades.OpenTrades[i].Willing); {														//find a invoice that is suitable
-			fmt.Println("! on next option " + strconv.Itoa(i) + ":" + strconv.Itoa(x))
-			_, e := findinvoice4Trade(stub, trades.OpenTrades[i].User, trades.OpenTrades[i].Willing[x].Color, trades.OpenTrades[i].Willing[x].Size)
-			if(e != nil){
-				fmt.Println("! errors with this option, removing option")
-				didWork = true
-				trades.OpenTrades[i].Willing = append(trades.OpenTrades[i].Willing[:x], trades.OpenTrades[i].Willing[x+1:]...)	//remove this option
-				x--;
-			}else{
-				fmt.Println("! this option is fine")
-			}
-			
-			x++
-			fmt.Println("! x:" + strconv.Itoa(x))
-			if x >= len(trades.OpenTrades[i].Willing) {														//things might have shifted, recalcuate
-				break
-			}
-		}
-		
-		if len(trades.OpenTrades[i].Willing) == 0 {
-			fmt.Println("! no more options for this trade, removing trade")
-			didWork = true
-			trades.OpenTrades = append(trades.OpenTrades[:i], trades.OpenTrades[i+1:]...)					//remove this trade
-			i--;
-			
-		}
-		
-		i++
-		fmt.Println("! i:" + strconv.Itoa(i))
-		if i >= len(trades.OpenTrades) {																	//things might have shifted, recalcuate
-			break
-		}
+func txTimestamp(stub shim.ChaincodeStubInterface) (int64, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil || ts == nil {
+		return 0, newError(CodeInternal, "", "Failed to get transaction timestamp")
 	}
+	return ts.Seconds*1000 + int64(ts.Nanos)/int64(time.Millisecond), nil
+}
 
-	if(didWork){
-		fmt.Println("! saving open trade changes")
-		jsonAsBytes, _ := json.Marshal(trades)
-		err = stub.PutState(openTradesStr, jsonAsBytes)														//rewrite open orders
-		if err != nil {
-			return err
-		}
-	}else{
-		fmt.Println("! all open trades are fine")
+// ============================================================================================================================
+// Tx Date - the day the transaction was proposed, YYYY-MM-DD in UTC
+// ============================================================================================================================
+func txDate(stub shim.ChaincodeStubInterface) (string, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil || ts == nil {
+		return "", newError(CodeInternal, "", "Failed to get transaction timestamp")
 	}
-
-	fmt.Println("- end clean trades")
-	return nil
-}
\ No newline at end of file
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC().Format("2006-01-02"), nil
+}
@@ -0,0 +1,309 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// invokeCase is one row of a table driven test of an invoke function
+type invokeCase struct {
+	name    string
+	role    string //caller role and id
+	id      string
+	args    []string
+	wantErr string //substring of the expected error, empty when the call should succeed
+	check   func(t *testing.T, stub *mockStub)
+}
+
+// runInvokeCases - run each case against a fresh ledger prepared by setup
+func runInvokeCases(t *testing.T, function string, setup func(t *testing.T, stub *mockStub), cases []invokeCase) {
+	for _, tc := range cases {
+		cc := new(SimpleChaincode)
+		stub := newMockStub()
+		if setup != nil {
+			setup(t, stub)
+		}
+		_, err := stub.as(tc.role, tc.id).mockInvoke(cc, function, tc.args...)
+		if !errorMatches(err, tc.wantErr) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+			continue
+		}
+		if err == nil && tc.check != nil {
+			tc.check(t, stub)
+		}
+	}
+}
+
+// errorMatches - true if the message of the error contains want, or there is no error and want is empty
+func errorMatches(err error, want string) bool {
+	if err == nil {
+		return want == ""
+	}
+	return want != "" && strings.Contains(errorOf(err).Message, want)
+}
+
+// errorOf - the code, field and message of an error returned by the chaincode
+func errorOf(err error) ChaincodeError {
+	var e ChaincodeError
+	if json.Unmarshal([]byte(err.Error()), &e) != nil {
+		e.Message = err.Error()
+	}
+	return e
+}
+
+// mustInvoke - run a setup step that has to succeed
+func mustInvoke(t *testing.T, stub *mockStub, role string, id string, function string, args ...string) {
+	_, err := stub.as(role, id).mockInvoke(new(SimpleChaincode), function, args...)
+	if err != nil {
+		t.Fatalf("%s %v as %s %s: %v", function, args, role, id, err)
+	}
+}
+
+// readJSON - unmarshal a key of the ledger, failing the test if it is missing
+func readJSON(t *testing.T, stub *mockStub, key string, v interface{}) {
+	value, ok := stub.state[key]
+	if !ok {
+		t.Fatalf("%s is not on the ledger", key)
+	}
+	err := json.Unmarshal([]byte(value), v)
+	if err != nil {
+		t.Fatalf("%s: %v", key, err)
+	}
+}
+
+func readInvoice(t *testing.T, stub *mockStub, vendorID string, number string) Invoice {
+	var inv Invoice
+	readJSON(t, stub, invoiceKey(vendorID, number), &inv)
+	return inv
+}
+
+func readTrades(t *testing.T, stub *mockStub) AllTrades {
+	var trades AllTrades
+	readJSON(t, stub, openTradesStr, &trades)
+	return trades
+}
+
+// invoiceArgs - create_invoice arguments for an issued USD invoice
+func invoiceArgs(vendorID string, customerID string, number string, amount string, material string, quantity string) []string {
+	return []string{vendorID, customerID, number, amount, "USD", material, quantity, "T1", "2026-11-01", StatusIssued, "2026-11-01"}
+}
+
+// setupLedger - an initialised ledger with customer C1 banked by B1, and an issued invoice INV-1 from V1 to C1
+func setupLedger(t *testing.T, stub *mockStub) {
+	_, err := stub.as("", "").mockInit(new(SimpleChaincode), "init", "99")
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	mustInvoke(t, stub, RoleBanker, "B1", "create_account", "C1", "Customer One", "customer", "1 Main St", "12345", "555-0101", "B1")
+	mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", invoiceArgs("V1", "C1", "INV-1", "100.00", "steel", "16")...)
+}
+
+// setupTradeLedger - setupLedger plus a 50.00 invoice INV-2 from V2 to C1
+func setupTradeLedger(t *testing.T, stub *mockStub) {
+	setupLedger(t, stub)
+	mustInvoke(t, stub, RoleVendor, "V2", "create_invoice", invoiceArgs("V2", "C1", "INV-2", "50.00", "copper", "8")...)
+}
+
+// openTrade - V1 lists INV-1 at a 2.5% discount, returning the id of the trade
+func openTrade(t *testing.T, stub *mockStub) string {
+	mustInvoke(t, stub, RoleVendor, "V1", "open_trade", invoiceKey("V1", "INV-1"), "2.5")
+	trades := readTrades(t, stub)
+	if len(trades.OpenTrades) == 0 {
+		t.Fatalf("open_trade stored no trade")
+	}
+	return trades.OpenTrades[len(trades.OpenTrades)-1].ID
+}
+
+func TestInit(t *testing.T) {
+	cases := []struct {
+		name    string
+		reinit  bool //the ledger was set up before
+		role    string
+		args    []string
+		wantErr string
+		wantVar string
+	}{
+		{"first deploy", false, "", []string{"99"}, "", "99"},
+		{"no argument", false, "", []string{}, "Expecting 1", ""},
+		{"not a number", false, "", []string{"abc"}, "Expecting integer", ""},
+		{"reset by admin", true, RoleAdmin, []string{"7"}, "", "7"},
+		{"reset by vendor", true, RoleVendor, []string{"7"}, "not allowed", ""},
+		{"reset without a role", true, "", []string{"7"}, "no \"role\" attribute", ""},
+	}
+	for _, tc := range cases {
+		cc := new(SimpleChaincode)
+		stub := newMockStub()
+		if tc.reinit {
+			setupLedger(t, stub)
+			openTrade(t, stub)
+		}
+		_, err := stub.as(tc.role, "A1").mockInit(cc, "init", tc.args...)
+		if !errorMatches(err, tc.wantErr) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := stub.state["abc"]; got != tc.wantVar {
+			t.Errorf("%s: abc = %q, want %q", tc.name, got, tc.wantVar)
+		}
+		if trades := readTrades(t, stub); len(trades.OpenTrades) != 0 {
+			t.Errorf("%s: %d open trades left after init", tc.name, len(trades.OpenTrades))
+		}
+	}
+}
+
+func TestCreateInvoice(t *testing.T) {
+	setup := func(t *testing.T, stub *mockStub) {
+		setupLedger(t, stub)
+	}
+	args := func(change func(args []string)) []string {
+		a := invoiceArgs("V1", "C1", "INV-9", "1234.50", "steel", "16")
+		if change != nil {
+			change(a)
+		}
+		return a
+	}
+
+	runInvokeCases(t, "create_invoice", setup, []invokeCase{
+		{name: "issued invoice", role: RoleVendor, id: "V1", args: args(nil), check: func(t *testing.T, stub *mockStub) {
+			inv := readInvoice(t, stub, "V1", "INV-9")
+			if inv.Status != StatusIssued || inv.InvoiceAmount.String() != "1234.50" || inv.OutstandingAmount.String() != "1234.50" || !inv.PaidAmount.IsZero() {
+				t.Errorf("issued invoice: stored %+v", inv)
+			}
+			if inv.Owner != "V1" || !reflect.DeepEqual(inv.CapTable, []Share{{Holder: "V1", Percent: "100"}}) {
+				t.Errorf("issued invoice: held by %q as %+v, want all the vendor's", inv.Owner, inv.CapTable)
+			}
+			if _, ok := stub.state[indexKey(invoiceType, byCustomer, "C1", "V1", "INV-9")]; !ok {
+				t.Errorf("issued invoice: no customer index entry")
+			}
+		}},
+		{name: "draft invoice", role: RoleVendor, id: "V1", args: args(func(a []string) { a[9] = StatusDraft }), check: func(t *testing.T, stub *mockStub) {
+			if inv := readInvoice(t, stub, "V1", "INV-9"); inv.Status != StatusDraft {
+				t.Errorf("draft invoice: status %q", inv.Status)
+			}
+		}},
+		{name: "same number from another vendor", role: RoleVendor, id: "V2", args: args(func(a []string) { a[0], a[2] = "V2", "INV-1" })},
+		{name: "created as admin", role: RoleAdmin, id: "A1", args: args(nil)},
+		{name: "wrong argument count", role: RoleVendor, id: "V1", args: args(nil)[:10], wantErr: "Expecting 11"},
+		{name: "paid initial status", role: RoleVendor, id: "V1", args: args(func(a []string) { a[9] = StatusPaid }), wantErr: "initial status"},
+		{name: "amount not a number", role: RoleVendor, id: "V1", args: args(func(a []string) { a[3] = "12,50" }), wantErr: "decimal amount"},
+		{name: "negative amount", role: RoleVendor, id: "V1", args: args(func(a []string) { a[3] = "-5" }), wantErr: "greater than zero"},
+		{name: "too many decimals", role: RoleVendor, id: "V1", args: args(func(a []string) { a[3] = "1.005" }), wantErr: "decimal places"},
+		{name: "unknown currency", role: RoleVendor, id: "V1", args: args(func(a []string) { a[4] = "XYZ" }), wantErr: "Unknown currency"},
+		{name: "quantity not a number", role: RoleVendor, id: "V1", args: args(func(a []string) { a[6] = "many" }), wantErr: "numeric string"},
+		{name: "separator in number", role: RoleVendor, id: "V1", args: args(func(a []string) { a[2] = "INV~9" }), wantErr: "must not contain"},
+		{name: "duplicate number", role: RoleVendor, id: "V1", args: args(func(a []string) { a[2] = "INV-1" }), wantErr: "arleady exists"},
+		{name: "for another vendor", role: RoleVendor, id: "V2", args: args(nil), wantErr: "not the vendor"},
+		{name: "by a customer", role: RoleCustomer, id: "C1", args: args(nil), wantErr: "not allowed"},
+	})
+}
+
+func TestCreateAccount(t *testing.T) {
+	setup := func(t *testing.T, stub *mockStub) {
+		setupLedger(t, stub)
+	}
+	args := func(change func(args []string)) []string {
+		a := []string{"C2", "Customer Two", "customer", "2 Main St", "67890", "555-0102", "B1"}
+		if change != nil {
+			change(a)
+		}
+		return a
+	}
+
+	runInvokeCases(t, "create_account", setup, []invokeCase{
+		{name: "by its banker", role: RoleBanker, id: "B1", args: args(nil), check: func(t *testing.T, stub *mockStub) {
+			var account Account
+			readJSON(t, stub, accountKey("C2"), &account)
+			if account.ID != "C2" || account.BankAccountNumber != 67890 || account.BankerID != "B1" {
+				t.Errorf("by its banker: stored %+v", account)
+			}
+			if _, ok := stub.state[indexKey(accountType, byBanker, "B1", "C2")]; !ok {
+				t.Errorf("by its banker: no banker index entry")
+			}
+		}},
+		{name: "by an admin", role: RoleAdmin, id: "A1", args: args(nil)},
+		{name: "wrong argument count", role: RoleBanker, id: "B1", args: args(nil)[:6], wantErr: "Expecting 7"},
+		{name: "empty id", role: RoleBanker, id: "B1", args: args(func(a []string) { a[0] = "" }), wantErr: "non-empty"},
+		{name: "no banker", role: RoleAdmin, id: "A1", args: args(func(a []string) { a[6] = "" }), wantErr: "7th argument"},
+		{name: "bank account not a number", role: RoleBanker, id: "B1", args: args(func(a []string) { a[4] = "DE89" }), wantErr: "numeric string"},
+		{name: "for another banker", role: RoleBanker, id: "B2", args: args(nil), wantErr: "cannot open an account"},
+		{name: "duplicate id", role: RoleBanker, id: "B1", args: args(func(a []string) { a[0] = "C1" }), wantErr: "arleady exists"},
+		{name: "by a vendor", role: RoleVendor, id: "V1", args: args(nil), wantErr: "not allowed"},
+	})
+}
+
+func TestCreatePayment(t *testing.T) {
+	setup := func(t *testing.T, stub *mockStub) {
+		setupLedger(t, stub)
+		mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", append(invoiceArgs("V1", "C1", "INV-D", "10.00", "tin", "1")[:9], StatusDraft, "2026-11-01")...)
+	}
+	args := func(change func(args []string)) []string {
+		a := []string{"P1", "V1", "C1", invoiceKey("V1", "INV-1"), "40.00", "USD", "B1", "2026-10-20", "T1", "2026-11-01"}
+		if change != nil {
+			change(a)
+		}
+		return a
+	}
+
+	runInvokeCases(t, "create_payment", setup, []invokeCase{
+		{name: "part payment", role: RoleCustomer, id: "C1", args: args(nil), check: func(t *testing.T, stub *mockStub) {
+			var payment Payment
+			readJSON(t, stub, paymentKey("P1"), &payment)
+			if payment.Status != PaymentPending || payment.Amount.String() != "40.00" || len(payment.Allocations) != 1 {
+				t.Errorf("part payment: stored %+v", payment)
+			}
+			if inv := readInvoice(t, stub, "V1", "INV-1"); inv.Status != StatusIssued || inv.OutstandingAmount.String() != "100.00" {
+				t.Errorf("part payment: invoice settled before the banker confirmed, %+v", inv)
+			}
+		}},
+		{name: "full payment", role: RoleCustomer, id: "C1", args: args(func(a []string) { a[4] = "100" })},
+		{name: "no payment date", role: RoleCustomer, id: "C1", args: args(func(a []string) { a[7] = "" }), check: func(t *testing.T, stub *mockStub) {
+			var payment Payment
+			readJSON(t, stub, paymentKey("P1"), &payment)
+			if payment.PaymentDate != "2026-10-01" {
+				t.Errorf("no payment date: paid on %q, want the transaction date", payment.PaymentDate)
+			}
+		}},
+		{name: "wrong argument count", role: RoleCustomer, id: "C1", args: args(nil)[:9], wantErr: "Expecting 10"},
+		{name: "amount not a number", role: RoleCustomer, id: "C1", args: args(func(a []string) { a[4] = "forty" }), wantErr: "decimal amount"},
+		{name: "more than outstanding", role: RoleCustomer, id: "C1", args: args(func(a []string) { a[4] = "100.01" }), wantErr: "outstanding"},
+		{name: "unknown invoice", role: RoleCustomer, id: "C1", args: args(func(a []string) { a[3] = invoiceKey("V1", "INV-404") }), wantErr: "does not exist"},
+		{name: "draft invoice", role: RoleCustomer, id: "C1", args: args(func(a []string) { a[3] = invoiceKey("V1", "INV-D") }), wantErr: StatusDraft},
+		{name: "wrong vendor", role: RoleCustomer, id: "C1", args: args(func(a []string) { a[1] = "V2" }), wantErr: "vendor"},
+		{name: "wrong banker", role: RoleCustomer, id: "C1", args: args(func(a []string) { a[6] = "B2" }), wantErr: "not the banker"},
+		{name: "for another customer", role: RoleCustomer, id: "C2", args: args(nil), wantErr: "cannot pay for customer"},
+		{name: "by a banker", role: RoleBanker, id: "B1", args: args(nil), wantErr: "not allowed"},
+	})
+
+	//a payment id can only be used once
+	stub := newMockStub()
+	setup(t, stub)
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", args(nil)...)
+	_, err := stub.as(RoleCustomer, "C1").mockInvoke(new(SimpleChaincode), "create_payment", args(nil)...)
+	if !errorMatches(err, "arleady exists") {
+		t.Errorf("duplicate payment: got error %v", err)
+	}
+}
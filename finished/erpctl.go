@@ -0,0 +1,762 @@
+//go:build tools
+// +build tools
+
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// erpctl calls the Invoke and Query functions from the command line, with flags named after their arguments,
+// either in-process against a ledger file or through the JSON-RPC endpoint of a peer or gateway:
+//
+//	erpctl -ledger ledger.json -role vendor -id V1 invoice create -vendorid V1 -customerid C1 ...
+//	erpctl -url http://localhost:7050 -user bob -secret pw -chaincode <name> invoice list -status issued
+//
+// It is this chaincode binary built with the tools, run as "erpctl" (go build -tags tools -o erpctl ./finished)
+// or as "<binary> erpctl ...".
+
+// erpCommand is one subcommand, such as "invoice create"
+type erpCommand struct {
+	Function string
+	Query    bool
+	Fixed    map[string]string      //arguments the subcommand always passes, e.g. the record type of a history
+	Key      func(id string) string //a get reads this key for the id it is given
+	Page     bool                   //a list query taking a ListQuery
+	Record   func() interface{}     //what the query returns, or each item of a page
+	Rows     string                 //field of Record holding the rows shown in a table
+	Columns  []string               //table columns of a list, every field when empty
+}
+
+var invoiceColumns = []string{"vendorid", "invoicenumber", "customerid", "invoiceamount", "outstandingamount", "currency", "status", "paymentdate", "owner"}
+var accountColumns = []string{"id", "accountname", "accounttype", "bankerid", "bankaccountnumber"}
+var paymentColumns = []string{"paymentId", "vendorid", "customerid", "amount", "currency", "paymentdate", "status", "bankerid"}
+var historyColumns = []string{"txid", "timestamp", "caller", "role", "deleted", "changes"}
+var closedTradeColumns = []string{"tradeid", "reason", "closedat", "txid"}
+
+func newInvoice() interface{}       { return &Invoice{} }
+func newAccount() interface{}       { return &Account{} }
+func newPayment() interface{}       { return &Payment{} }
+func newTrades() interface{}        { return &AllTrades{} }
+func newEncumbrance() interface{}   { return &Encumbrance{} }
+func newTradeDepth() interface{}    { return &TradeDepth{} }
+func newClosedTrades() interface{}  { return &ClosedTrades{} }
+func newRecordHistory() interface{} { return &RecordHistory{} }
+
+func historyCommand(recordType string) erpCommand {
+	return erpCommand{Function: "history", Query: true, Fixed: map[string]string{"type": recordType}, Record: newRecordHistory, Rows: "Versions", Columns: historyColumns}
+}
+
+func lifecycleCommand(function string) erpCommand {
+	return erpCommand{Function: function}
+}
+
+var erpCommands = map[string]map[string]erpCommand{
+	"invoice": {
+		"create":      {Function: "create_invoice"},
+		"get":         {Function: "read", Query: true, Key: func(id string) string { return id }, Record: newInvoice},
+		"list":        {Function: "list_invoices", Query: true, Page: true, Record: newInvoice, Columns: invoiceColumns},
+		"history":     historyCommand(invoiceType),
+		"issue":       lifecycleCommand("issue_invoice"),
+		"acknowledge": lifecycleCommand("acknowledge_invoice"),
+		"close":       lifecycleCommand("close_invoice"),
+		"dispute":     lifecycleCommand("dispute_invoice"),
+		"resolve":     lifecycleCommand("resolve_dispute"),
+		"cancel":      lifecycleCommand("cancel_invoice"),
+		"set-user":    {Function: "set_user"},
+		"transfer":    {Function: "transfer_share"},
+
+		"pledge":         {Function: "pledge_invoice"},
+		"release-pledge": {Function: "release_pledge"},
+		"encumbrance":    {Function: "encumbrance_status", Query: true, Record: newEncumbrance},
+		"fingerprint":    {Function: "fingerprint_status", Query: true, Record: newEncumbrance},
+	},
+	"account": {
+		"create":  {Function: "create_account"},
+		"get":     {Function: "read", Query: true, Key: accountKey, Record: newAccount},
+		"list":    {Function: "list_accounts", Query: true, Page: true, Record: newAccount, Columns: accountColumns},
+		"history": historyCommand(accountType),
+	},
+	"payment": {
+		"create":       {Function: "create_payment"},
+		"create-multi": {Function: "create_payment_multi"},
+		"confirm":      {Function: "confirm_payment"},
+		"get":          {Function: "read", Query: true, Key: paymentKey, Record: newPayment},
+		"list":         {Function: "list_payments", Query: true, Page: true, Record: newPayment, Columns: paymentColumns},
+		"history":      historyCommand(paymentType),
+	},
+	"trade": {
+		"open":    {Function: "open_trade"},
+		"bid":     {Function: "place_bid"},
+		"perform": {Function: "perform_trade"},
+		"cancel":  {Function: "remove_trade"},
+		"list":    {Function: "read", Query: true, Key: func(string) string { return openTradesStr }, Record: newTrades, Rows: "OpenTrades"},
+		"bids":    {Function: "read", Query: true, Key: func(string) string { return openTradesStr }, Record: newTrades, Rows: "Bids"},
+		"depth":   {Function: "trade_depth", Query: true, Record: newTradeDepth},
+		"expire":  {Function: "expire_trades"},
+		"closed":  {Function: "closed_trades", Query: true, Record: newClosedTrades, Rows: "Trades", Columns: closedTradeColumns},
+		"history": historyCommand(tradeType),
+	},
+	"chaincode": {
+		"deploy": {Function: "init"},
+	},
+}
+
+// erpBackend runs the chaincode functions, in-process or over JSON-RPC
+type erpBackend interface {
+	deploy(path string, args []string) (string, error)
+	invoke(function string, args []string) (string, error)
+	query(function string, args []string) ([]byte, error)
+}
+
+// ============================================================================================================================
+// runErpctl - the erpctl command, output goes to out
+// ============================================================================================================================
+func runErpctl(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("erpctl", flag.ContinueOnError)
+	flags.SetOutput(out)
+	ledgerPath := flags.String("ledger", "ledger.json", "ledger file to run the chaincode against in-process")
+	url := flags.String("url", "", "JSON-RPC endpoint of a peer or gateway, e.g. http://localhost:7050, instead of -ledger")
+	chaincode := flags.String("chaincode", "", "name of the deployed chaincode, optional with -ledger if only one is deployed")
+	role := flags.String("role", "", "role of the caller with -ledger")
+	id := flags.String("id", "", "id of the caller with -ledger")
+	user := flags.String("user", "", "enroll id of the caller with -url")
+	secret := flags.String("secret", "", "enroll secret, to log in first with -url")
+	output := flags.String("o", "table", "output as table or json")
+	flags.Usage = func() { erpUsage(out, flags) }
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		erpUsage(out, flags)
+		return errors.New("Expecting a record type and a command")
+	}
+	if *output != "table" && *output != "json" {
+		return errors.New("Output must be table or json")
+	}
+	noun, verb := flags.Arg(0), flags.Arg(1)
+	cmd, ok := erpCommands[noun][verb]
+	if !ok {
+		erpUsage(out, flags)
+		return errors.New("Unknown command \"" + noun + " " + verb + "\"")
+	}
+
+	var backend erpBackend
+	if *url != "" {
+		backend = &rpcBackend{url: strings.TrimRight(*url, "/"), name: *chaincode, user: *user, secret: *secret}
+	} else {
+		backend, err = openLocalBackend(*ledgerPath, *chaincode, *role, *id, cmd.Function == "init")
+		if err != nil {
+			return err
+		}
+	}
+	return runErpCommand(backend, noun+" "+verb, cmd, flags.Args()[2:], *output == "json", out)
+}
+
+// erpUsage - the global flags and every subcommand
+func erpUsage(out io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(out, "usage: erpctl [flags] <record> <command> [command flags] [arguments]")
+	flags.PrintDefaults()
+	var nouns []string
+	for noun := range erpCommands {
+		nouns = append(nouns, noun)
+	}
+	sort.Strings(nouns)
+	for _, noun := range nouns {
+		var verbs []string
+		for verb := range erpCommands[noun] {
+			verbs = append(verbs, verb)
+		}
+		sort.Strings(verbs)
+		fmt.Fprintln(out, "  "+noun+" "+strings.Join(verbs, "|"))
+	}
+	fmt.Fprintln(out, "erpctl <record> <command> -h lists the flags of a command")
+}
+
+// ============================================================================================================================
+// runErpCommand - parse the flags of a subcommand, call its function and print the answer
+// ============================================================================================================================
+func runErpCommand(backend erpBackend, name string, cmd erpCommand, args []string, asJSON bool, out io.Writer) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(out)
+
+	//a get takes the id, a deploy the init value, anything else the named arguments of its function
+	var params []param
+	switch {
+	case cmd.Key != nil:
+		params = []param{required("id", kindID)}
+		if cmd.Rows != "" {
+			params = nil
+		}
+	case cmd.Function == "init":
+		params = invokeParams["init"]
+	case cmd.Page:
+		params = listParams()
+	case cmd.Query:
+		params = queryParams[cmd.Function]
+	default:
+		params = invokeParams[cmd.Function]
+	}
+	var named []param
+	for _, p := range params {
+		if _, fixed := cmd.Fixed[p.Name]; !fixed {
+			named = append(named, p)
+		}
+	}
+	values := map[string]flag.Value{}
+	for _, p := range named {
+		v := &paramValue{p: p}
+		values[p.Name] = v
+		flags.Var(v, p.Name, paramUsage(p))
+	}
+	path, all := new(string), new(bool)
+	if cmd.Function == "init" {
+		flags.StringVar(path, "path", "erp", "chaincode path to deploy")
+	}
+	if cmd.Page {
+		flags.BoolVar(all, "all", false, "follow the next token to the last page")
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	//arguments without a flag fill the params not given, in order
+	rest := flags.Args()
+	for _, p := range named {
+		v := values[p.Name].(*paramValue)
+		if len(rest) == 0 {
+			break
+		}
+		if !v.set && p.Fields == nil {
+			v.Set(rest[0])
+			rest = rest[1:]
+		}
+	}
+	if len(rest) > 0 {
+		return errors.New("Unexpected argument \"" + rest[0] + "\"")
+	}
+
+	object := map[string]interface{}{}
+	for name, value := range cmd.Fixed {
+		object[name] = value
+	}
+	for _, p := range named {
+		v := values[p.Name].(*paramValue)
+		if v.set {
+			object[p.Name] = v.value
+		}
+	}
+
+	switch {
+	case cmd.Function == "init":
+		value, _ := object["value"].(string)
+		name, err := backend.deploy(*path, []string{value})
+		if err != nil {
+			return err
+		}
+		return printResult(out, asJSON, map[string]string{"chaincode": name})
+	case !cmd.Query:
+		txID, err := backend.invoke(cmd.Function, []string{jsonArg(object)})
+		if err != nil {
+			return err
+		}
+		return printResult(out, asJSON, map[string]string{"txid": txID})
+	case cmd.Key != nil:
+		id, _ := object["id"].(string)
+		if cmd.Rows == "" && id == "" {
+			return errors.New("Expecting the id to get")
+		}
+		res, err := backend.query(cmd.Function, []string{cmd.Key(id)})
+		if err != nil {
+			return err
+		}
+		if len(res) == 0 {
+			return newError(CodeNotFound, "id", "Not found: "+id)
+		}
+		return printRecord(out, asJSON, cmd, res)
+	case cmd.Page:
+		return printPages(out, asJSON, backend, cmd, object, *all)
+	}
+	res, err := backend.query(cmd.Function, []string{jsonArg(object)})
+	if err != nil {
+		return err
+	}
+	return printRecord(out, asJSON, cmd, res)
+}
+
+// listParams - a flag for each field of ListQuery
+func listParams() []param {
+	var params []param
+	t := reflect.TypeOf(ListQuery{})
+	for i := 0; i < t.NumField(); i++ {
+		params = append(params, param{Name: jsonName(t.Field(i)), Optional: true})
+	}
+	return params
+}
+
+func paramUsage(p param) string {
+	var fields []string
+	for _, field := range p.Fields {
+		fields = append(fields, field.Name)
+	}
+	switch {
+	case p.List:
+		return "repeat for each " + strings.Join(fields, ":")
+	case p.Fields != nil:
+		return strings.Join(fields, ":")
+	case p.Optional || p.Omit:
+		return "optional"
+	}
+	return "required"
+}
+
+// paramValue is the flag of one param. An object param is given as its fields joined by ":", a list param is repeated.
+type paramValue struct {
+	p     param
+	set   bool
+	value interface{}
+}
+
+func (v *paramValue) String() string {
+	if v == nil || !v.set {
+		return ""
+	}
+	return fmt.Sprint(v.value)
+}
+
+func (v *paramValue) Set(s string) error {
+	if v.p.Fields == nil {
+		v.value, v.set = s, true
+		return nil
+	}
+	parts := strings.SplitN(s, ":", len(v.p.Fields))
+	if len(parts) != len(v.p.Fields) {
+		return errors.New("expecting " + paramUsage(param{Fields: v.p.Fields}))
+	}
+	object := map[string]string{}
+	for i, field := range v.p.Fields {
+		object[field.Name] = parts[i]
+	}
+	if !v.p.List {
+		v.value, v.set = object, true
+		return nil
+	}
+	list, _ := v.value.([]map[string]string)
+	v.value, v.set = append(list, object), true
+	return nil
+}
+
+// jsonArg - the one JSON object argument a function is called with
+func jsonArg(object map[string]interface{}) string {
+	jsonAsBytes, _ := json.Marshal(object)
+	return string(jsonAsBytes)
+}
+
+// ============================================================================================================================
+// printPages - run a list query, and with all set every page after it, as one table or JSON array
+// ============================================================================================================================
+func printPages(out io.Writer, asJSON bool, backend erpBackend, cmd erpCommand, object map[string]interface{}, all bool) error {
+	if size, ok := object["pagesize"].(string); ok {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return errors.New("pagesize must be a whole number")
+		}
+		object["pagesize"] = n
+	}
+
+	var items []json.RawMessage
+	var next string
+	for {
+		res, err := backend.query(cmd.Function, []string{jsonArg(object)})
+		if err != nil {
+			return err
+		}
+		var page struct {
+			Items []json.RawMessage `json:"items"`
+			Next  string            `json:"next"`
+		}
+		err = json.Unmarshal(res, &page)
+		if err != nil {
+			return errors.New("Unexpected answer to " + cmd.Function + ": " + err.Error())
+		}
+		items = append(items, page.Items...)
+		next = page.Next
+		if !all || next == "" {
+			break
+		}
+		object["token"] = next
+	}
+
+	if asJSON {
+		if items == nil {
+			items = []json.RawMessage{}
+		}
+		return printResult(out, true, map[string]interface{}{"items": items, "next": next})
+	}
+	var rows []interface{}
+	for _, item := range items {
+		record := cmd.Record()
+		json.Unmarshal(item, record)
+		rows = append(rows, record)
+	}
+	printTable(out, rows, cmd.Columns)
+	if next != "" {
+		fmt.Fprintln(out, "next page: -token "+next)
+	}
+	return nil
+}
+
+// printRecord - a query answer as JSON, or as a table of its rows or of its fields
+func printRecord(out io.Writer, asJSON bool, cmd erpCommand, res []byte) error {
+	if asJSON {
+		var indented bytes.Buffer
+		if json.Indent(&indented, res, "", "  ") != nil {
+			return printResult(out, true, string(res))
+		}
+		fmt.Fprintln(out, indented.String())
+		return nil
+	}
+	record := cmd.Record()
+	err := json.Unmarshal(res, record)
+	if err != nil {
+		return errors.New("Unexpected answer to " + cmd.Function + ": " + err.Error())
+	}
+	if cmd.Rows == "" {
+		printFields(out, record)
+		return nil
+	}
+	slice := reflect.ValueOf(record).Elem().FieldByName(cmd.Rows)
+	var rows []interface{}
+	for i := 0; i < slice.Len(); i++ {
+		rows = append(rows, slice.Index(i).Addr().Interface())
+	}
+	printTable(out, rows, cmd.Columns)
+	return nil
+}
+
+// printResult - the answer of an invoke or deploy
+func printResult(out io.Writer, asJSON bool, v interface{}) error {
+	if asJSON {
+		jsonAsBytes, _ := json.MarshalIndent(v, "", "  ")
+		fmt.Fprintln(out, string(jsonAsBytes))
+		return nil
+	}
+	if m, ok := v.(map[string]string); ok {
+		for key, value := range m {
+			fmt.Fprintln(out, key+": "+value)
+		}
+		return nil
+	}
+	fmt.Fprintln(out, v)
+	return nil
+}
+
+// ============================================================================================================================
+// printTable - one row per record, with the columns given or every field of the record
+// ============================================================================================================================
+func printTable(out io.Writer, rows []interface{}, columns []string) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	if len(rows) == 0 {
+		fmt.Fprintln(out, "(none)")
+		return
+	}
+	if len(columns) == 0 {
+		columns, _ = recordFields(rows[0])
+	}
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, row := range rows {
+		names, values := recordFields(row)
+		byName := map[string]string{}
+		for i, name := range names {
+			byName[name] = values[i]
+		}
+		var cells []string
+		for _, column := range columns {
+			cells = append(cells, byName[column])
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+}
+
+// printFields - one line per field of a record
+func printFields(out io.Writer, record interface{}) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	names, values := recordFields(record)
+	for i := range names {
+		fmt.Fprintln(w, names[i]+"\t"+values[i])
+	}
+	w.Flush()
+}
+
+// recordFields - the JSON names and values of the fields of a record, in the order they are declared.
+// Strings and amounts are shown as they are, anything else as compact JSON.
+func recordFields(record interface{}) ([]string, []string) {
+	var names, values []string
+	v := reflect.Indirect(reflect.ValueOf(record))
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		jsonAsBytes, _ := json.Marshal(v.Field(i).Interface())
+		value := string(jsonAsBytes)
+		var s string
+		if json.Unmarshal(jsonAsBytes, &s) == nil {
+			value = s
+		}
+		names = append(names, name)
+		values = append(values, value)
+	}
+	return names, values
+}
+
+// jsonName - the name a struct field has in JSON, empty if it is not serialized
+func jsonName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// localBackend runs the chaincode in-process against a ledger file, like the gateway does
+type localBackend struct {
+	gateway    *gateway
+	name       string
+	attributes map[string]string
+}
+
+// ============================================================================================================================
+// openLocalBackend - the ledger file and the chaincode in it to run, the only one deployed if none is named
+// ============================================================================================================================
+func openLocalBackend(path string, name string, role string, id string, deploying bool) (*localBackend, error) {
+	ledger, err := openLedger(path)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" && !deploying {
+		for deployed := range ledger.Chaincodes {
+			if name != "" {
+				return nil, errors.New("Ledger " + path + " holds several chaincodes, pick one with -chaincode")
+			}
+			name = deployed
+		}
+		if name == "" {
+			return nil, errors.New("Ledger " + path + " holds no chaincode, run erpctl chaincode deploy first")
+		}
+	}
+	attributes := map[string]string{}
+	if role != "" {
+		attributes[roleAttribute] = role
+	}
+	if id != "" {
+		attributes[idAttribute] = id
+	}
+	return &localBackend{gateway: newGateway(ledger, nil), name: name, attributes: attributes}, nil
+}
+
+func (b *localBackend) spec(function string, args []string) *chaincodeSpec {
+	spec := &chaincodeSpec{}
+	spec.ChaincodeID.Name = b.name
+	spec.CtorMsg.Function = function
+	spec.CtorMsg.Args = args
+	return spec
+}
+
+func (b *localBackend) deploy(path string, args []string) (string, error) {
+	spec := b.spec("init", args)
+	spec.ChaincodeID.Path = path
+	return b.gateway.deploy(spec, b.attributes)
+}
+
+func (b *localBackend) invoke(function string, args []string) (string, error) {
+	return b.gateway.invoke(b.spec(function, args), b.attributes)
+}
+
+func (b *localBackend) query(function string, args []string) ([]byte, error) {
+	return b.gateway.query(b.spec(function, args), b.attributes)
+}
+
+// rpcBackend calls the /chaincode JSON-RPC endpoint of a peer or gateway
+type rpcBackend struct {
+	url      string
+	name     string
+	user     string
+	secret   string
+	loggedIn bool
+	lastID   int
+}
+
+// login - log the user in through the registrar, once, if a secret was given
+func (b *rpcBackend) login() error {
+	if b.loggedIn || b.secret == "" {
+		return nil
+	}
+	body, _ := json.Marshal(map[string]string{"enrollId": b.user, "enrollSecret": b.secret})
+	resp, err := http.Post(b.url+"/registrar", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var answer map[string]string
+	json.NewDecoder(resp.Body).Decode(&answer)
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Login failed: " + answer["Error"])
+	}
+	b.loggedIn = true
+	return nil
+}
+
+// call - send one JSON-RPC request, the message of the result or the chaincode error
+func (b *rpcBackend) call(method string, spec *chaincodeSpec) (string, error) {
+	err := b.login()
+	if err != nil {
+		return "", err
+	}
+	b.lastID++
+	spec.Type = 1
+	spec.SecureContext = b.user
+	req := struct {
+		Jsonrpc string         `json:"jsonrpc"`
+		Method  string         `json:"method"`
+		Params  *chaincodeSpec `json:"params"`
+		ID      int            `json:"id"`
+	}{"2.0", method, spec, b.lastID}
+	body, _ := json.Marshal(req)
+	resp, err := http.Post(b.url+"/chaincode", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var answer rpcResponse
+	err = json.NewDecoder(resp.Body).Decode(&answer)
+	if err != nil {
+		return "", errors.New("Unexpected answer from " + b.url + ": " + err.Error())
+	}
+	if answer.Error != nil {
+		e := &errorEnvelope{}
+		if json.Unmarshal([]byte(answer.Error.Data), &e.ChaincodeError) == nil && e.Code != "" {
+			return "", e
+		}
+		return "", errors.New(answer.Error.Message + ": " + answer.Error.Data)
+	}
+	if answer.Result == nil {
+		return "", errors.New("Unexpected answer from " + b.url + ": no result")
+	}
+	return answer.Result.Message, nil
+}
+
+func (b *rpcBackend) spec(function string, args []string) (*chaincodeSpec, error) {
+	if b.name == "" {
+		return nil, errors.New("-chaincode is required with -url")
+	}
+	spec := &chaincodeSpec{}
+	spec.ChaincodeID.Name = b.name
+	spec.CtorMsg.Function = function
+	spec.CtorMsg.Args = args
+	return spec, nil
+}
+
+func (b *rpcBackend) deploy(path string, args []string) (string, error) {
+	spec := &chaincodeSpec{}
+	spec.ChaincodeID.Path = path
+	spec.CtorMsg.Function = "init"
+	spec.CtorMsg.Args = args
+	return b.call("deploy", spec)
+}
+
+func (b *rpcBackend) invoke(function string, args []string) (string, error) {
+	spec, err := b.spec(function, args)
+	if err != nil {
+		return "", err
+	}
+	return b.call("invoke", spec)
+}
+
+func (b *rpcBackend) query(function string, args []string) ([]byte, error) {
+	spec, err := b.spec(function, args)
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.call("query", spec)
+	return []byte(res), err
+}
+
+// ============================================================================================================================
+// erpctlMain - run erpctl and exit, printing a chaincode error as its message and code
+// ============================================================================================================================
+func erpctlMain(args []string) {
+	err := runErpctl(args, os.Stdout)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		e := erpctlError(err)
+		msg := "Error: " + e.Message
+		if e.Code != "" {
+			msg += " [" + e.Code
+			if e.Field != "" {
+				msg += " " + e.Field
+			}
+			msg += "]"
+		}
+		fmt.Fprintln(os.Stderr, msg)
+		os.Exit(1)
+	}
+}
+
+// erpctlError - the code, field and message of an error from the chaincode or from erpctl itself
+func erpctlError(err error) ChaincodeError {
+	if err == nil {
+		return ChaincodeError{}
+	}
+	switch e := err.(type) {
+	case *ChaincodeError:
+		return *e
+	case *errorEnvelope:
+		return e.ChaincodeError
+	}
+	return ChaincodeError{Message: err.Error()}
+}
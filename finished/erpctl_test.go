@@ -0,0 +1,166 @@
+//go:build tools
+// +build tools
+
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// erpctl - run erpctl with the arguments, returning what it printed
+func erpctl(t *testing.T, args ...string) (string, error) {
+	var out bytes.Buffer
+	err := runErpctl(args, &out)
+	return out.String(), err
+}
+
+// mustErpctl - run erpctl and fail the test on an error
+func mustErpctl(t *testing.T, args ...string) string {
+	out, err := erpctl(t, args...)
+	if err != nil {
+		t.Fatalf("erpctl %s: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+func TestErpctlLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "erpctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ledger := filepath.Join(dir, "ledger.json")
+	banker := []string{"-ledger", ledger, "-role", RoleBanker, "-id", "B1"}
+	vendor := []string{"-ledger", ledger, "-role", RoleVendor, "-id", "V1"}
+	financier := []string{"-ledger", ledger, "-role", RoleFinancier, "-id", "F1"}
+
+	if _, err := erpctl(t, "-ledger", ledger, "account", "list"); err == nil || !strings.Contains(err.Error(), "no chaincode") {
+		t.Errorf("list before deploy: %v", err)
+	}
+	if out := mustErpctl(t, "-ledger", ledger, "chaincode", "deploy", "99"); !strings.Contains(out, chaincodeName("erp")) {
+		t.Errorf("deploy printed %q", out)
+	}
+	mustErpctl(t, append(banker, "account", "create", "-id", "C1", "-accountname", "Customer One", "-accounttype", "customer",
+		"-address", "1 Main St", "-bankaccountnumber", "12345", "-phone", "555-0101", "-bankerid", "B1")...)
+	out := mustErpctl(t, append(vendor, "invoice", "create", "-vendorid", "V1", "-customerid", "C1", "-invoicenumber", "INV-1",
+		"-invoiceamount", "100.00", "-currency", "USD", "-material", "steel", "-quantity", "16", "-tradeid", "T1",
+		"-paymentdate", "2026-11-01", "-status", StatusIssued, "-newpaymentdate", "2026-11-01")...)
+	if !strings.HasPrefix(out, "txid: ") || len(strings.TrimSpace(out)) != len("txid: ")+36 {
+		t.Errorf("invoke printed %q, want the tx id", out)
+	}
+
+	//a field missing is the chaincode's own error
+	_, err = erpctl(t, append(vendor, "invoice", "create", "-vendorid", "V1", "-customerid", "C1")...)
+	if e := erpctlError(err); e.Code != CodeRequired || e.Field != "invoicenumber" {
+		t.Errorf("create without a number: %+v", e)
+	}
+
+	//get takes the id as an argument, and shows one line per field
+	out = mustErpctl(t, append(vendor, "invoice", "get", makeKey(invoiceType, "V1", "INV-1"))...)
+	if !strings.Contains(out, "outstandingamount") || !strings.Contains(out, "100.00") {
+		t.Errorf("invoice get printed %q", out)
+	}
+	if _, err := erpctl(t, append(vendor, "invoice", "get", makeKey(invoiceType, "V1", "INV-9"))...); erpctlError(err).Code != CodeNotFound {
+		t.Errorf("get of a missing invoice: %v", err)
+	}
+
+	var page struct {
+		Items []Invoice `json:"items"`
+	}
+	out = mustErpctl(t, append(banker, "-o", "json", "invoice", "list", "-status", StatusIssued, "-pagesize", "10")...)
+	if err := json.Unmarshal([]byte(out), &page); err != nil || len(page.Items) != 1 || page.Items[0].InvoiceNumber != "INV-1" {
+		t.Errorf("invoice list -o json printed %q (%v)", out, err)
+	}
+	out = mustErpctl(t, append(banker, "invoice", "list")...)
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], "VENDORID") {
+		t.Errorf("invoice list printed %q, want a header and one row", out)
+	}
+
+	mustErpctl(t, append(vendor, "trade", "open", "-invoiceid", invoiceKey("V1", "INV-1"), "-discount", "2.5")...)
+	var trades AllTrades
+	out = mustErpctl(t, append(vendor, "-o", "json", "trade", "list")...)
+	if json.Unmarshal([]byte(out), &trades); len(trades.OpenTrades) != 1 || trades.OpenTrades[0].Price.String() != "97.50" {
+		t.Fatalf("trade list printed %q", out)
+	}
+	mustErpctl(t, append(vendor, "trade", "cancel", trades.OpenTrades[0].ID)...)
+	if out = mustErpctl(t, append(vendor, "trade", "list")...); !strings.Contains(out, "(none)") {
+		t.Errorf("trade list after cancel printed %q", out)
+	}
+	if out = mustErpctl(t, append(vendor, "trade", "closed", "-reason", "removed")...); !strings.Contains(out, trades.OpenTrades[0].ID) || !strings.HasPrefix(out, "TRADEID") {
+		t.Errorf("closed trades after cancel printed %q", out)
+	}
+	mustErpctl(t, append(financier, "trade", "bid", "-financier", "F1", "-currency", "USD", "-facevalue", "500", "-discount", "3", "-tenor", "90", "-expiry", "72h")...)
+	var depth TradeDepth
+	out = mustErpctl(t, append(financier, "-o", "json", "trade", "depth", "-currency", "USD")...)
+	if json.Unmarshal([]byte(out), &depth); len(depth.Asks) != 0 || len(depth.Bids) != 1 || depth.Bids[0].FaceValue.String() != "500.00" {
+		t.Errorf("trade depth printed %q", out)
+	}
+
+	if _, err := erpctl(t, "-ledger", ledger, "invoice", "pay"); err == nil || !strings.Contains(err.Error(), "Unknown command") {
+		t.Errorf("unknown command: %v", err)
+	}
+}
+
+func TestErpctlRPC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "erpctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := startGateway(t, dir)
+	defer server.Close()
+
+	//logging in is done once, before the first call
+	bob := []string{"-url", server.URL, "-user", "bob", "-secret", "pw"}
+	out := mustErpctl(t, append(bob, "-o", "json", "chaincode", "deploy", "1")...)
+	var deployed map[string]string
+	json.Unmarshal([]byte(out), &deployed)
+	name := deployed["chaincode"]
+	if name != chaincodeName("erp") {
+		t.Fatalf("deploy printed %q", out)
+	}
+	bob = append(bob, "-chaincode", name)
+
+	mustErpctl(t, append(bob, "account", "create", "-id", "C1", "-accountname", "Customer One", "-accounttype", "customer",
+		"-address", "1 Main St", "-bankaccountnumber", "12345", "-phone", "555-0101", "-bankerid", "B1")...)
+	var account Account
+	out = mustErpctl(t, append(bob, "-o", "json", "account", "get", "C1")...)
+	if json.Unmarshal([]byte(out), &account); account.BankerID != "B1" {
+		t.Errorf("account get printed %q", out)
+	}
+
+	//the chaincode error comes back from the data of the JSON-RPC error
+	_, err = erpctl(t, append(bob, "account", "create", "-id", "C2", "-accountname", "Customer Two", "-accounttype", "customer",
+		"-address", "2 Main St", "-bankaccountnumber", "12345", "-phone", "555-0102", "-bankerid", "B2")...)
+	if e := erpctlError(err); e.Code != CodePermissionDenied || e.Field != "bankerid" {
+		t.Errorf("account for another banker: %+v", e)
+	}
+	if _, err := erpctl(t, "-url", server.URL, "-user", "bob", "-secret", "wrong", "-chaincode", name, "account", "list"); err == nil || !strings.Contains(err.Error(), "Login failed") {
+		t.Errorf("wrong secret: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+)
+
+// codes of the errors Invoke and Query return, clients match on these so they never change
+const (
+	CodeInvalidArgument  = "invalid_argument"  //an argument or field is malformed
+	CodeRequired         = "required"          //a required field is missing or empty
+	CodeOutOfRange       = "out_of_range"      //a number is outside the range allowed for the field
+	CodeInvalidCurrency  = "invalid_currency"  //not an ISO 4217 currency code
+	CodeInvalidDate      = "invalid_date"      //not an ISO 8601 date (YYYY-MM-DD)
+	CodeNotFound         = "not_found"         //the record asked for does not exist
+	CodeAlreadyExists    = "already_exists"    //a record with that id exists
+	CodePermissionDenied = "permission_denied" //the caller may not do this
+	CodeUnknownFunction  = "unknown_function"  //no such invoke or query function
+	CodePeriodClosed     = "period_closed"     //the date falls in a closed fiscal period
+	CodeEncumbered       = "encumbered"        //the invoice is already listed, pledged or sold
+	CodeExpired          = "expired"           //the trade is past its expiry
+	CodeInternal         = "internal"          //the ledger could not be read or written
+	CodeRejected         = "rejected"          //any other rule of the chaincode was broken
+)
+
+// ChaincodeError is a failure with a code for programs and a message for people.
+// Field is the JSON name of the argument or record field at fault, if there is one.
+type ChaincodeError struct {
+	Code     string `json:"code"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+	position int    //1-based positional argument at fault, envelope names it when Field is empty
+}
+
+func (e *ChaincodeError) Error() string {
+	return e.Message
+}
+
+func newError(code string, field string, message string) *ChaincodeError {
+	return &ChaincodeError{Code: code, Field: field, Message: message}
+}
+
+// argError - an error in a positional argument, the field is the name of the param at that position
+func argError(code string, position int, message string) *ChaincodeError {
+	return &ChaincodeError{Code: code, Message: message, position: position}
+}
+
+// atArgument - an error blamed on a positional argument, unless it already names its field
+func atArgument(err error, position int) error {
+	if ce, ok := err.(*ChaincodeError); ok && ce.Field == "" {
+		blamed := *ce
+		blamed.position = position
+		return &blamed
+	}
+	return err
+}
+
+// atField - an error blamed on a record field, unless it already names its field
+func atField(err error, field string) error {
+	if ce, ok := err.(*ChaincodeError); ok && ce.Field == "" {
+		blamed := *ce
+		blamed.Field = field
+		return &blamed
+	}
+	return err
+}
+
+// errorEnvelope is a ChaincodeError as it leaves the chaincode, its error text is the JSON of the ChaincodeError
+type errorEnvelope struct {
+	ChaincodeError
+}
+
+func (e *errorEnvelope) Error() string {
+	jsonAsBytes, _ := json.Marshal(&e.ChaincodeError)
+	return string(jsonAsBytes)
+}
+
+// ============================================================================================================================
+// envelope - the error to return from Init, Invoke or Query, with a code and the field at fault. An error not raised
+// as a ChaincodeError came from the ledger. names holds the field name of each argument, which names the argument
+// an error was raised for, and replaces "4th argument" in the message if reword is set.
+// ============================================================================================================================
+func envelope(err error, names []string, reword bool) error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*errorEnvelope); ok { //Invoke("init") returns what Init returned
+		return e
+	}
+
+	e := &errorEnvelope{}
+	if ce, ok := err.(*ChaincodeError); ok {
+		e.ChaincodeError = *ce
+	} else {
+		e.Code = CodeInternal
+		e.Message = err.Error()
+	}
+
+	if e.Field == "" && e.position > 0 && e.position <= len(names) {
+		e.Field = names[e.position-1]
+	}
+	if reword {
+		e.Message = nameArguments(e.Message, names)
+	}
+	return e
+}
+
+// codeOf - the code of an error raised as a ChaincodeError, otherwise the code given
+func codeOf(err error, code string) string {
+	if ce, ok := err.(*ChaincodeError); ok {
+		return ce.Code
+	}
+	return code
+}
@@ -0,0 +1,122 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// eventVersion is bumped whenever a field of EventPayload or Event changes meaning or goes away
+const eventVersion = 3
+
+// names of the events, subscribers match on these so they never change
+const (
+	EventInvoiceCreated      = "invoice_created"
+	EventInvoiceStatus       = "invoice_status_changed"
+	EventInvoiceOwnerChanged = "invoice_owner_changed"
+	EventAccountCreated      = "account_created"
+	EventPaymentCreated      = "payment_created"
+	EventPaymentConfirmed    = "payment_confirmed"
+	EventTradeOpened         = "trade_opened"
+	EventTradePerformed      = "trade_performed"
+	EventTradeRemoved        = "trade_removed"
+	EventTradeCleaned        = "trade_cleaned"
+	EventShareTransferred    = "share_transferred"
+	EventTradeExpired        = "trade_expired"
+)
+
+// Event is one business state change, only the fields that apply to it are set
+type Event struct {
+	Name           string       `json:"name"`
+	InvoiceID      string       `json:"invoiceid,omitempty"`
+	Invoice        *Invoice     `json:"invoice,omitempty"`
+	Account        *Account     `json:"account,omitempty"`
+	Payment        *Payment     `json:"payment,omitempty"`
+	TradeID        string       `json:"tradeid,omitempty"`
+	Trade          *AnOpenTrade `json:"trade,omitempty"`
+	Purchase       *Purchase    `json:"purchase,omitempty"` //what a fill of a trade sold
+	PreviousOwner  string       `json:"previousowner,omitempty"`
+	NewOwner       string       `json:"newowner,omitempty"`
+	Percent        string       `json:"percent,omitempty"` //of the invoice that changed hands
+	PreviousStatus string       `json:"previousstatus,omitempty"`
+	NewStatus      string       `json:"newstatus,omitempty"`
+	Closed         bool         `json:"closed,omitempty"` //clean up or expiry took the order down
+}
+
+// EventPayload is the payload of the one chaincode event a transaction may set.
+// The chaincode event is named after the first Event, the one for the function invoked.
+type EventPayload struct {
+	Version   int     `json:"version"`
+	TxID      string  `json:"txid"`
+	Timestamp int64   `json:"timestamp"`
+	Caller    string  `json:"caller"`
+	Events    []Event `json:"events"` //in the order they happened
+}
+
+// A transaction can set only one event, a later SetEvent replaces an earlier one. Events are therefore
+// held per stub while the invoke runs and set together once it succeeds, see Invoke.
+var pendingEvents = map[shim.ChaincodeStubInterface][]Event{}
+var pendingEventsLock sync.Mutex
+
+// ============================================================================================================================
+// emitEvent - queue an event for the running transaction
+// ============================================================================================================================
+func emitEvent(stub shim.ChaincodeStubInterface, event Event) {
+	pendingEventsLock.Lock()
+	defer pendingEventsLock.Unlock()
+	pendingEvents[stub] = append(pendingEvents[stub], event)
+	fmt.Println("! event " + event.Name)
+}
+
+// takeEvents - the events queued for the running transaction, which are forgotten
+func takeEvents(stub shim.ChaincodeStubInterface) []Event {
+	pendingEventsLock.Lock()
+	defer pendingEventsLock.Unlock()
+	events := pendingEvents[stub]
+	delete(pendingEvents, stub)
+	return events
+}
+
+// ============================================================================================================================
+// flushEvents - set the queued events as the chaincode event of the transaction
+// ============================================================================================================================
+func flushEvents(stub shim.ChaincodeStubInterface) error {
+	events := takeEvents(stub)
+	if len(events) == 0 {
+		return nil
+	}
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+
+	payload := EventPayload{}
+	payload.Version = eventVersion
+	payload.TxID = stub.GetTxID()
+	payload.Timestamp = timestamp
+	payload.Caller = getCaller(stub)
+	payload.Events = events
+	jsonAsBytes, _ := json.Marshal(payload)
+	return stub.SetEvent(events[0].Name, jsonAsBytes)
+}
@@ -0,0 +1,132 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// lastEvent - the payload of the event set by the last transaction that set one
+func lastEvent(t *testing.T, stub *mockStub) (string, EventPayload) {
+	var payload EventPayload
+	if len(stub.events) == 0 {
+		t.Fatalf("no event was set")
+	}
+	event := stub.events[len(stub.events)-1]
+	err := json.Unmarshal(event.Payload, &payload)
+	if err != nil {
+		t.Fatalf("event %s: %v", event.Name, err)
+	}
+	return event.Name, payload
+}
+
+func eventNames(payload EventPayload) []string {
+	var names []string
+	for _, event := range payload.Events {
+		names = append(names, event.Name)
+	}
+	return names
+}
+
+func TestEvents(t *testing.T) {
+	cases := []struct {
+		name      string
+		invoke    func(t *testing.T, stub *mockStub)
+		wantName  string
+		wantNames []string
+	}{
+		{"create invoice", func(t *testing.T, stub *mockStub) {
+			mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", invoiceArgs("V1", "C1", "INV-9", "10.00", "tin", "1")...)
+		}, EventInvoiceCreated, []string{EventInvoiceCreated}},
+		{"create account", func(t *testing.T, stub *mockStub) {
+			mustInvoke(t, stub, RoleBanker, "B1", "create_account", "C2", "Customer Two", "customer", "2 Main St", "67890", "555-0102", "B1")
+		}, EventAccountCreated, []string{EventAccountCreated}},
+		{"create payment", func(t *testing.T, stub *mockStub) {
+			mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", "P1", "V1", "C1", invoiceKey("V1", "INV-1"), "40.00", "USD", "B1", "", "T1", "")
+		}, EventPaymentCreated, []string{EventPaymentCreated}},
+		{"set user", func(t *testing.T, stub *mockStub) {
+			mustInvoke(t, stub, RoleVendor, "V1", "set_user", invoiceKey("V1", "INV-1"), "F1")
+		}, EventInvoiceOwnerChanged, []string{EventInvoiceOwnerChanged}},
+		{"remove trade", func(t *testing.T, stub *mockStub) {
+			mustInvoke(t, stub, RoleVendor, "V1", "remove_trade", openTrade(t, stub))
+		}, EventTradeRemoved, []string{EventTradeRemoved}},
+		{"perform trade", func(t *testing.T, stub *mockStub) {
+			mustInvoke(t, stub, RoleFinancier, "F1", "perform_trade", openTrade(t, stub), "F1")
+		}, EventTradePerformed, []string{EventTradePerformed, EventInvoiceOwnerChanged}},
+		{"payment cleans up a listing", func(t *testing.T, stub *mockStub) {
+			openTrade(t, stub)
+			mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", "P1", "V1", "C1", invoiceKey("V1", "INV-1"), "40.00", "USD", "B1", "", "T1", "")
+			mustInvoke(t, stub, RoleBanker, "B1", "confirm_payment", "P1") //INV-1 has less outstanding than listed
+		}, EventPaymentConfirmed, []string{EventPaymentConfirmed, EventTradeCleaned}},
+	}
+	for _, tc := range cases {
+		stub := newMockStub()
+		setupTradeLedger(t, stub)
+		tc.invoke(t, stub)
+
+		name, payload := lastEvent(t, stub)
+		if name != tc.wantName {
+			t.Errorf("%s: event %q, want %q", tc.name, name, tc.wantName)
+		}
+		if payload.Version != eventVersion || payload.TxID != stub.txID {
+			t.Errorf("%s: version %d in tx %s, want %d in %s", tc.name, payload.Version, payload.TxID, eventVersion, stub.txID)
+		}
+		if names := eventNames(payload); !reflect.DeepEqual(names, tc.wantNames) {
+			t.Errorf("%s: events %v, want %v", tc.name, names, tc.wantNames)
+		}
+	}
+}
+
+func TestEventDetails(t *testing.T) {
+	stub := newMockStub()
+	setupTradeLedger(t, stub)
+	mustInvoke(t, stub, RoleVendor, "V1", "set_user", invoiceKey("V1", "INV-1"), "F1")
+	_, payload := lastEvent(t, stub)
+	if event := payload.Events[0]; event.InvoiceID != invoiceKey("V1", "INV-1") || event.PreviousOwner != "V1" || event.NewOwner != "F1" {
+		t.Errorf("owner change event %+v", event)
+	}
+	if payload.Caller != "V1" {
+		t.Errorf("event caller %q, want V1", payload.Caller)
+	}
+
+	//a failed invoke sets no event, and leaves nothing behind for the next one
+	seen := len(stub.events)
+	_, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "create_invoice", invoiceArgs("V1", "C1", "INV-1", "10.00", "tin", "1")...)
+	if err == nil {
+		t.Fatalf("duplicate invoice was created")
+	}
+	if len(stub.events) != seen || len(pendingEvents[stub]) != 0 {
+		t.Errorf("failed invoke left events %v, pending %v", stub.events[seen:], pendingEvents[stub])
+	}
+
+	//clean up takes down listings by someone who does not own the invoice
+	tradesAsBytes, _ := json.Marshal(AllTrades{OpenTrades: []AnOpenTrade{{ID: "tx0", User: "F1", InvoiceID: invoiceKey("V2", "INV-2"), FaceValue: usd("50.00"), Currency: "USD", Discount: "1", Price: usd("49.50")}}})
+	stub.state[openTradesStr] = string(tradesAsBytes)
+	mustInvoke(t, stub, RoleVendor, "V2", "set_user", invoiceKey("V2", "INV-2"), "V3")
+	_, payload = lastEvent(t, stub)
+	if len(payload.Events) != 2 {
+		t.Fatalf("events %v, want an owner change and a clean up", eventNames(payload))
+	}
+	if event := payload.Events[1]; event.TradeID != "tx0" || !event.Closed || event.InvoiceID != invoiceKey("V2", "INV-2") {
+		t.Errorf("clean up event %+v", event)
+	}
+}
@@ -0,0 +1,246 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Every order in the book expires. It is given a time to live from the transaction that opens it, or a date or time
+// to expire at, and defaultTradeTTL when it is given neither. Orders stored before orders expired never do. An expired
+// order can no longer be filled, it stays in the book until expire_trades or the next clean up sweeps it out. Every
+// order that leaves the book for good, filled, removed, cleaned up or expired, is kept as a ClosedTrade with the reason.
+
+// defaultTradeTTL is how long an order stays open when it is not given an expiry
+const defaultTradeTTL = 30 * 24 * time.Hour
+
+// maxTTLDays is the longest time to live in days, a time.Duration holds about 292 years
+const maxTTLDays = math.MaxInt64 / int64(24*time.Hour)
+
+// why an order left the book, stored in ClosedTrade.Reason
+const (
+	ClosedFilled  = "filled"
+	ClosedRemoved = "removed"
+	ClosedCleaned = "cleaned"
+	ClosedExpired = "expired"
+)
+
+// ClosedTrade is an order that left the book, as it was when it left
+type ClosedTrade struct {
+	TradeID  string      `json:"tradeid"`
+	Reason   string      `json:"reason"`
+	ClosedAt int64       `json:"closedat"` //utc timestamp of the transaction that closed it
+	TxID     string      `json:"txid"`
+	Trade    AnOpenTrade `json:"trade"`
+}
+
+// ClosedTrades is the answer of the closed_trades query, oldest first
+type ClosedTrades struct {
+	Trades []ClosedTrade `json:"trades"`
+}
+
+// ============================================================================================================================
+// parseExpiry - when an order opened at now expires: a time to live such as "72h" or "30d", the end of a date
+// "YYYY-MM-DD", or an RFC 3339 time, defaultTradeTTL when empty. It must be after now.
+// ============================================================================================================================
+func parseExpiry(s string, now int64) (int64, error) {
+	if s == "" {
+		return now + int64(defaultTradeTTL/time.Millisecond), nil
+	}
+	var expires int64
+	if ttl, err := parseTTL(s); err == nil {
+		expires = now + int64(ttl/time.Millisecond)
+	} else if codeOf(err, CodeInvalidArgument) == CodeOutOfRange {
+		return 0, err
+	} else if at, err := time.Parse(time.RFC3339, s); err == nil {
+		expires = at.UnixNano() / int64(time.Millisecond)
+	} else if day, err := time.Parse("2006-01-02", s); err == nil {
+		expires = day.AddDate(0, 0, 1).UnixNano() / int64(time.Millisecond) //the end of that day in UTC
+	} else {
+		return 0, newError(CodeInvalidArgument, "expiry", "Expiry \""+s+"\" is not a time to live such as 72h or 30d, a date or an RFC 3339 time")
+	}
+	if expires <= now {
+		return 0, newError(CodeOutOfRange, "expiry", "Expiry "+s+" is not after the time of the transaction, "+formatTimestamp(now))
+	}
+	return expires, nil
+}
+
+// parseTTL - a Go duration, or a whole number of days such as "30d", at most maxTTLDays
+func parseTTL(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseInt(strings.TrimSuffix(s, "d"), 10, 64)
+		if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+			days = maxTTLDays + 1 //too many digits for an int64 even
+		} else if err != nil {
+			return 0, err
+		}
+		if days > maxTTLDays || days < -maxTTLDays {
+			return 0, newError(CodeOutOfRange, "expiry", "Expiry "+s+" is more than "+strconv.FormatInt(maxTTLDays, 10)+" days")
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// formatTimestamp - a utc timestamp in milliseconds as an RFC 3339 time, for messages
+func formatTimestamp(ts int64) string {
+	return time.Unix(0, ts*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+}
+
+// isExpired - true if an order can no longer be filled at now
+func isExpired(trade AnOpenTrade, now int64) bool {
+	return trade.Expires > 0 && now >= trade.Expires
+}
+
+// ============================================================================================================================
+// closeTrade - keep an order that left the book for good, with the reason it left
+// ============================================================================================================================
+func closeTrade(stub shim.ChaincodeStubInterface, trade AnOpenTrade, reason string) error {
+	var err error
+	closed := ClosedTrade{}
+	closed.TradeID = tradeID(trade)
+	closed.Reason = reason
+	closed.ClosedAt, err = txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+	closed.TxID = stub.GetTxID()
+	closed.Trade = trade
+	jsonAsBytes, _ := json.Marshal(closed)
+	return stub.PutState(makeKey(closedTradeType, fmt.Sprintf("%016d", closed.ClosedAt), closed.TradeID), jsonAsBytes)
+}
+
+// ============================================================================================================================
+// expireTrades - take the expired orders out of the book, the invoices of expired asks may be financed again
+// ============================================================================================================================
+func expireTrades(stub shim.ChaincodeStubInterface) (int, error) {
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return 0, err
+	}
+	trades, err := getTrades(stub)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := AllTrades{OpenTrades: []AnOpenTrade{}, Bids: []AnOpenTrade{}}
+	var expired []AnOpenTrade
+	for _, trade := range trades.OpenTrades {
+		if isExpired(trade, now) {
+			expired = append(expired, trade)
+		} else {
+			kept.OpenTrades = append(kept.OpenTrades, trade)
+		}
+	}
+	for _, trade := range trades.Bids {
+		if isExpired(trade, now) {
+			expired = append(expired, trade)
+		} else {
+			kept.Bids = append(kept.Bids, trade)
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	err = putTrades(stub, kept) //rewrite open orders
+	if err != nil {
+		return 0, err
+	}
+	for _, trade := range expired {
+		fmt.Println("! trade " + tradeID(trade) + " expired at " + formatTimestamp(trade.Expires))
+		if trade.Side != SideBid {
+			if inv, e := getInvoice(stub, trade.InvoiceID); e == nil {
+				err = releaseEncumbrance(stub, inv, tradeID(trade))
+				if err != nil {
+					return 0, err
+				}
+			}
+		}
+		err = closeTrade(stub, trade, ClosedExpired)
+		if err != nil {
+			return 0, err
+		}
+		gone := trade
+		emitEvent(stub, Event{Name: EventTradeExpired, TradeID: tradeID(gone), InvoiceID: gone.InvoiceID, Trade: &gone, Closed: true})
+	}
+	return len(expired), nil
+}
+
+// ============================================================================================================================
+// Expire Trades - sweep the orders past their expiry out of the book
+// ============================================================================================================================
+func (t *SimpleChaincode) expire_trades(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 0 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting none")
+	}
+
+	fmt.Println("- start expire trades")
+	n, err := expireTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end expire trades, " + strconv.Itoa(n) + " expired")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Closed Trades - the orders that left the book, oldest first, all of them or those closed for one reason
+// ============================================================================================================================
+func (t *SimpleChaincode) closed_trades(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0
+	// "expired"
+	if len(args) > 1 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting optional reason")
+	}
+	reason := ""
+	if len(args) == 1 {
+		reason = args[0]
+	}
+	switch reason {
+	case "", ClosedFilled, ClosedRemoved, ClosedCleaned, ClosedExpired:
+	default:
+		return nil, newError(CodeInvalidArgument, "reason", "Reason \""+reason+"\" is not one of filled, removed, cleaned or expired")
+	}
+
+	res := ClosedTrades{Trades: []ClosedTrade{}}
+	err := scanPrefix(stub, makeKey(closedTradeType, ""), func(key string, value []byte) error {
+		closed := ClosedTrade{}
+		err := json.Unmarshal(value, &closed)
+		if err != nil {
+			return newError(CodeInternal, "", "Closed trade "+key+" is corrupt")
+		}
+		if reason == "" || closed.Reason == reason {
+			res.Trades = append(res.Trades, closed)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(res)
+}
@@ -0,0 +1,149 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// queryClosed - the closed_trades query, failing the test if it fails
+func queryClosed(t *testing.T, stub *mockStub, args ...string) []ClosedTrade {
+	var closed ClosedTrades
+	res, err := stub.as(RoleFinancier, "F1").mockQuery(new(SimpleChaincode), "closed_trades", args...)
+	if err != nil {
+		t.Fatalf("closed_trades %v: %v", args, err)
+	}
+	err = json.Unmarshal(res, &closed)
+	if err != nil {
+		t.Fatalf("closed_trades %v: %v", args, err)
+	}
+	return closed.Trades
+}
+
+func TestParseExpiry(t *testing.T) {
+	at := func(s string) int64 {
+		ts, _ := time.Parse(time.RFC3339, s)
+		return ts.UnixNano() / int64(time.Millisecond)
+	}
+	now := at("2026-10-01T09:00:00Z")
+	cases := []struct {
+		expiry  string
+		want    int64
+		wantErr string
+	}{
+		{"", at("2026-10-31T09:00:00Z"), ""}, //defaultTradeTTL
+		{"72h", at("2026-10-04T09:00:00Z"), ""},
+		{"90m", at("2026-10-01T10:30:00Z"), ""},
+		{"7d", at("2026-10-08T09:00:00Z"), ""},
+		{"2026-10-31", at("2026-11-01T00:00:00Z"), ""}, //the end of the day
+		{"2026-10-02T17:00:00Z", at("2026-10-02T17:00:00Z"), ""},
+		{"2026-10-02T17:00:00+02:00", at("2026-10-02T15:00:00Z"), ""},
+		{"106751d", at("2026-10-01T09:00:00Z") + 106751*24*int64(time.Hour/time.Millisecond), ""}, //maxTTLDays
+		{"106752d", 0, "is more than 106751 days"},
+		{"300000d", 0, "is more than 106751 days"},
+		{"99999999999999999999d", 0, "is more than 106751 days"},
+		{"-300000d", 0, "is more than 106751 days"},
+		{"soon", 0, "is not a time to live"},
+		{"-1h", 0, "is not after the time of the transaction"},
+		{"2026-09-30", 0, "is not after the time of the transaction"},
+		{"2026-10-01T09:00:00Z", 0, "is not after the time of the transaction"},
+	}
+	for _, tc := range cases {
+		got, err := parseExpiry(tc.expiry, now)
+		if !errorMatches(err, tc.wantErr) || got != tc.want {
+			t.Errorf("%q: got %s, %v, want %s, %q", tc.expiry, formatTimestamp(got), err, formatTimestamp(tc.want), tc.wantErr)
+		}
+		if strings.Contains(tc.wantErr, "more than") && codeOf(err, "") != CodeOutOfRange {
+			t.Errorf("%q: got %v, want code %s", tc.expiry, err, CodeOutOfRange)
+		}
+	}
+}
+
+func TestTradeExpiry(t *testing.T) {
+	inv1, inv2 := invoiceKey("V1", "INV-1"), invoiceKey("V2", "INV-2")
+	stub := newMockStub()
+	setupTradeLedger(t, stub)
+
+	mustInvoke(t, stub, RoleVendor, "V1", "open_trade", inv1, "2.5", "1h")
+	mustInvoke(t, stub, RoleVendor, "V2", "open_trade", inv2, "2")
+	mustInvoke(t, stub, RoleFinancier, "F1", "place_bid", "F1", "USD", "100", "3", "90", "2h")
+	trades := readTrades(t, stub)
+	ask, bid := trades.OpenTrades[0], trades.Bids[0]
+	if ask.InvoiceID != inv1 || ask.Expires != ask.Timestamp+int64(time.Hour/time.Millisecond) || trades.OpenTrades[1].Expires != trades.OpenTrades[1].Timestamp+int64(defaultTradeTTL/time.Millisecond) {
+		t.Errorf("asks %+v, want INV-1 expiring in an hour and INV-2 in the default", trades.OpenTrades)
+	}
+
+	//an hour on the INV-1 ask can no longer be bought, met by a bid, or listed over, but it is still in the book
+	stub.txTime = stub.txTime.Add(time.Hour)
+	_, err := stub.as(RoleFinancier, "F2").mockInvoke(new(SimpleChaincode), "perform_trade", ask.ID, "F2")
+	if e := errorOf(err); e.Code != CodeExpired || !errorMatches(err, "expired at "+formatTimestamp(ask.Expires)) {
+		t.Errorf("buying an expired trade: %v", err)
+	}
+	mustInvoke(t, stub, RoleFinancier, "F2", "place_bid", "F2", "USD", "50", "2.5", "0")
+	if trades = readTrades(t, stub); len(trades.OpenTrades) != 2 || len(trades.Bids) != 2 || !trades.Bids[0].Filled.IsZero() {
+		t.Errorf("book after a bid only the expired ask would fill: asks %+v bids %+v", trades.OpenTrades, trades.Bids)
+	}
+	if _, err = stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "open_trade", inv1, "2"); !errorMatches(err, "which expired, use expire_trades first") {
+		t.Errorf("listing an invoice again before its expired listing was swept: %v", err)
+	}
+	if depth := queryDepth(t, stub, "USD"); len(depth.Asks) != 1 || depth.Asks[0].Discount != "2" || len(depth.Bids) != 2 {
+		t.Errorf("depth %+v, want the expired ask left out", depth)
+	}
+
+	//the sweep archives it and the invoice may be financed again
+	mustInvoke(t, stub, RoleAdmin, "A1", "expire_trades")
+	sweep := stub.txID
+	_, payload := lastEvent(t, stub)
+	if len(payload.Events) != 1 || payload.Events[0].Name != EventTradeExpired || payload.Events[0].TradeID != ask.ID || !payload.Events[0].Closed {
+		t.Errorf("sweep events %+v, want the INV-1 ask expired", payload.Events)
+	}
+	if trades = readTrades(t, stub); len(trades.OpenTrades) != 1 || trades.OpenTrades[0].InvoiceID != inv2 || len(trades.Bids) != 2 {
+		t.Errorf("book after the sweep: asks %+v bids %+v", trades.OpenTrades, trades.Bids)
+	}
+	if enc := queryEncumbrance(t, stub, inv1); enc.Status != EncumbranceFree {
+		t.Errorf("encumbrance of the expired listing %+v, want free", enc)
+	}
+	closed := queryClosed(t, stub, ClosedExpired)
+	if len(closed) != 1 || closed[0].TradeID != ask.ID || closed[0].Reason != ClosedExpired || closed[0].TxID != sweep || !reflect.DeepEqual(closed[0].Trade, ask) {
+		t.Errorf("closed trades %+v, want the INV-1 ask as it was", closed)
+	}
+
+	//clean up after any trade sweeps too, F1's bid expires with the next one
+	stub.txTime = stub.txTime.Add(time.Hour)
+	mustInvoke(t, stub, RoleFinancier, "F3", "perform_trade", trades.OpenTrades[0].ID, "F3")
+	_, payload = lastEvent(t, stub)
+	if names := eventNames(payload); !reflect.DeepEqual(names, []string{EventTradePerformed, EventInvoiceOwnerChanged, EventTradeExpired}) || payload.Events[2].TradeID != bid.ID {
+		t.Errorf("events %v, want the INV-2 sale and F1's bid expired", names)
+	}
+	var reasons []string
+	for _, c := range queryClosed(t, stub) {
+		reasons = append(reasons, c.TradeID+" "+c.Reason)
+	}
+	if want := []string{ask.ID + " expired", trades.OpenTrades[0].ID + " filled", bid.ID + " expired"}; !reflect.DeepEqual(reasons, want) {
+		t.Errorf("closed trades %v, want %v", reasons, want)
+	}
+	if _, err = stub.mockQuery(new(SimpleChaincode), "closed_trades", "late"); !errorMatches(err, "is not one of") {
+		t.Errorf("unknown reason: %v", err)
+	}
+}
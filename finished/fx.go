@@ -0,0 +1,324 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// rates for a currency pair were kept in one JSON array under _fx_<FROM>_<TO>, only read by migrate_keys
+var fxRatePrefix = "_fx_"
+
+// Rate is an exact decimal exchange rate, e.g. "1.0845" USD per EUR
+type Rate struct {
+	value Money
+}
+
+// FXRate is one entry of the on-ledger rate table, keyed by currency pair and effective date
+type FXRate struct {
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Rate          Rate   `json:"rate"`          //units of To for one unit of From
+	EffectiveDate string `json:"effectivedate"` //YYYY-MM-DD, applies until a later entry takes over
+	SetBy         string `json:"setby"`
+	Timestamp     int64  `json:"timestamp"`
+}
+
+// ============================================================================================================================
+// ParseRate - read a positive decimal exchange rate
+// ============================================================================================================================
+func ParseRate(s string) (Rate, error) {
+	m, err := parseDecimal(s)
+	if err != nil {
+		return Rate{}, newError(CodeInvalidArgument, "rate", "Rate \""+s+"\" is not a decimal number")
+	}
+	if m.Sign() <= 0 {
+		return Rate{}, newError(CodeOutOfRange, "rate", "Rate must be greater than zero")
+	}
+	return Rate{m}, nil
+}
+
+// String prints the rate with the digits it was given
+func (r Rate) String() string {
+	return r.value.String()
+}
+
+// MarshalJSON writes the rate as a JSON string
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return r.value.MarshalJSON()
+}
+
+// UnmarshalJSON reads the rate from a JSON string
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	return r.value.UnmarshalJSON(data)
+}
+
+// ============================================================================================================================
+// Convert - the amount multiplied by the rate, rounded half away from zero to the minor units of currency
+// ============================================================================================================================
+func (m Money) Convert(rate Rate, currency string) (Money, error) {
+	digits, err := currencyDigits(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	product := new(big.Int).Mul(big.NewInt(m.minor), big.NewInt(rate.value.minor))
+	return roundBig(product, m.scale+rate.value.scale, digits)
+}
+
+// ============================================================================================================================
+// dateKey - the YYYY-MM-DD part of an ISO 8601 date or timestamp, used to compare dates as strings. Anything after
+// the first 10 characters is ignored, dates that are stored are checked with checkDate.
+// ============================================================================================================================
+func dateKey(date string) (string, error) {
+	if len(date) < 10 {
+		return "", newError(CodeInvalidDate, "", "Date \""+date+"\" is not an ISO 8601 date (YYYY-MM-DD)")
+	}
+	_, err := time.Parse("2006-01-02", date[:10])
+	if err != nil {
+		return "", newError(CodeInvalidDate, "", "Date \""+date+"\" is not an ISO 8601 date (YYYY-MM-DD)")
+	}
+	return date[:10], nil
+}
+
+// fxRateKey - a rate is keyed by its currency pair and the day it takes effect, so a pair's rates sort by date
+func fxRateKey(from string, to string, day string) string {
+	return makeKey(fxRateType, from, to, day)
+}
+
+// ============================================================================================================================
+// getFXRate - the rate from one currency to another in effect on a date, the last one to take effect by then
+// ============================================================================================================================
+func getFXRate(stub shim.ChaincodeStubInterface, from string, to string, date string) (FXRate, error) {
+	day, err := dateKey(date)
+	if err != nil {
+		return FXRate{}, err
+	}
+	var rate FXRate
+	found := false
+	err = scanRange(stub, fxRateKey(from, to, ""), fxRateKey(from, to, day), func(key string, value []byte) error {
+		err := json.Unmarshal(value, &rate)
+		if err != nil {
+			return newError(CodeInternal, "", "FX rate "+key+" is corrupt")
+		}
+		found = true
+		return nil
+	})
+	if err != nil {
+		return FXRate{}, err
+	}
+	if !found {
+		return FXRate{}, newError(CodeNotFound, "", "No "+from+"/"+to+" rate effective on "+day)
+	}
+	return rate, nil
+}
+
+// ============================================================================================================================
+// putFXRate - store a rate under its pair and effective date, replacing the rate of that pair for that day
+// ============================================================================================================================
+func putFXRate(stub shim.ChaincodeStubInterface, rate FXRate) error {
+	jsonAsBytes, _ := json.Marshal(rate)
+	return stub.PutState(fxRateKey(rate.From, rate.To, rate.EffectiveDate), jsonAsBytes)
+}
+
+// ============================================================================================================================
+// convertAmount - an amount in one currency expressed in another at the rate in effect on a date
+// ============================================================================================================================
+func convertAmount(stub shim.ChaincodeStubInterface, amount Money, from string, to string, date string) (Money, FXRate, error) {
+	if from == to {
+		digits, err := currencyDigits(to)
+		if err != nil {
+			return Money{}, FXRate{}, err
+		}
+		converted, err := amount.rescale(digits)
+		return converted, FXRate{}, err
+	}
+	rate, err := getFXRate(stub, from, to, date)
+	if err != nil {
+		return Money{}, FXRate{}, err
+	}
+	converted, err := amount.Convert(rate.Rate, to)
+	return converted, rate, err
+}
+
+// ============================================================================================================================
+// Set FX Rate - add or replace the rate for a currency pair from an effective date onward
+// ============================================================================================================================
+func (t *SimpleChaincode) set_fx_rate(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0		1		2			3
+	// "EUR", "USD", "1.0845", "2026-10-01"
+	if len(args) != 4 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 4")
+	}
+
+	fmt.Println("- start set fx rate")
+	err := checkCurrency("from", args[0])
+	if err != nil {
+		return nil, err
+	}
+	err = checkCurrency("to", args[1])
+	if err != nil {
+		return nil, err
+	}
+	if args[0] == args[1] {
+		return nil, argError(CodeInvalidArgument, 2, "Cannot set a rate from a currency to itself")
+	}
+	rate, err := ParseRate(args[2])
+	if err != nil {
+		return nil, err
+	}
+	err = checkDate("effectivedate", args[3]) //a rate is set for a day, not for a moment of it
+	if err != nil {
+		return nil, err
+	}
+	day := args[3]
+
+	entry := FXRate{}
+	entry.From = args[0]
+	entry.To = args[1]
+	entry.Rate = rate
+	entry.EffectiveDate = day
+	entry.SetBy = getCaller(stub)
+	entry.Timestamp, err = txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	err = putFXRate(stub, entry) //a second rate for the same day corrects the first
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end set fx rate")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Get FX Rate - the rate for a currency pair in effect on a date
+// ============================================================================================================================
+func (t *SimpleChaincode) get_fx_rate(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0		1		2
+	// "EUR", "USD", "2026-10-15"
+	if len(args) != 3 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 3")
+	}
+
+	_, err := dateKey(args[2])
+	if err != nil {
+		return nil, atArgument(err, 3)
+	}
+	rate, err := getFXRate(stub, args[0], args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rate)
+}
+
+// ReportLine is one invoice in an invoice report, in its own and in the reporting currency
+type ReportLine struct {
+	InvoiceID            string `json:"invoiceid"`
+	InvoiceNumber        string `json:"invoicenumber"`
+	Status               string `json:"status"`
+	Currency             string `json:"currency"`
+	InvoiceAmount        Money  `json:"invoiceamount"`
+	OutstandingAmount    Money  `json:"outstandingamount"`
+	Rate                 string `json:"rate,omitempty"` //empty when already in the reporting currency
+	ReportingAmount      Money  `json:"reportingamount"`
+	ReportingOutstanding Money  `json:"reportingoutstanding"`
+}
+
+// InvoiceReport is every invoice converted into one reporting currency
+type InvoiceReport struct {
+	ReportingCurrency string       `json:"reportingcurrency"`
+	Date              string       `json:"date"`
+	Invoices          []ReportLine `json:"invoices"`
+	TotalAmount       Money        `json:"totalamount"`
+	TotalOutstanding  Money        `json:"totaloutstanding"`
+}
+
+// ============================================================================================================================
+// Invoice Report - all invoices converted into a reporting currency at the rates in effect on a date
+// ============================================================================================================================
+func (t *SimpleChaincode) invoice_report(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0		1
+	// "USD", "2026-10-31"
+	if len(args) != 2 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 2")
+	}
+	if _, err := currencyDigits(args[0]); err != nil {
+		return nil, err
+	}
+	day, err := dateKey(args[1])
+	if err != nil {
+		return nil, atArgument(err, 2)
+	}
+
+	report := InvoiceReport{}
+	report.ReportingCurrency = args[0]
+	report.Date = day
+	report.Invoices = []ReportLine{}
+	report.TotalAmount = ZeroMoney(args[0])
+	report.TotalOutstanding = ZeroMoney(args[0])
+
+	err = scanPrefix(stub, invoiceType+keySeparator, func(id string, invoiceAsBytes []byte) error {
+		inv := Invoice{}
+		err := json.Unmarshal(invoiceAsBytes, &inv) //un stringify it aka JSON.parse()
+		if err != nil {
+			return newError(CodeInternal, "", "Invoice "+id+" is corrupt")
+		}
+
+		line := ReportLine{}
+		line.InvoiceID = id
+		line.InvoiceNumber = inv.InvoiceNumber
+		line.Status = inv.Status
+		line.Currency = inv.Currency
+		line.InvoiceAmount = inv.InvoiceAmount
+		line.OutstandingAmount = inv.OutstandingAmount
+		var rate FXRate
+		line.ReportingAmount, rate, err = convertAmount(stub, inv.InvoiceAmount, inv.Currency, report.ReportingCurrency, day)
+		if err != nil {
+			return err
+		}
+		line.ReportingOutstanding, _, err = convertAmount(stub, inv.OutstandingAmount, inv.Currency, report.ReportingCurrency, day)
+		if err != nil {
+			return err
+		}
+		if rate.From != "" {
+			line.Rate = rate.Rate.String()
+		}
+
+		report.Invoices = append(report.Invoices, line)
+		report.TotalAmount, err = report.TotalAmount.Add(line.ReportingAmount)
+		if err != nil {
+			return err
+		}
+		report.TotalOutstanding, err = report.TotalOutstanding.Add(line.ReportingOutstanding)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(report)
+}
@@ -0,0 +1,181 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// setupFXLedger - setupLedger plus EUR/USD at 1.0845 from October 2026 and 1.1 from November
+func setupFXLedger(t *testing.T, stub *mockStub) {
+	setupLedger(t, stub)
+	mustInvoke(t, stub, RoleAdmin, "A1", "set_fx_rate", "EUR", "USD", "1.1", "2026-11-01")
+	mustInvoke(t, stub, RoleAdmin, "A1", "set_fx_rate", "EUR", "USD", "1.0845", "2026-10-01")
+}
+
+func TestSetFXRate(t *testing.T) {
+	rates := func(t *testing.T, stub *mockStub) []FXRate {
+		var r []FXRate
+		err := scanPrefix(stub, makeKey(fxRateType, "EUR", "USD")+keySeparator, func(key string, value []byte) error {
+			var rate FXRate
+			err := json.Unmarshal(value, &rate)
+			if err == nil && key != fxRateKey("EUR", "USD", rate.EffectiveDate) {
+				t.Errorf("%s holds the rate effective %s", key, rate.EffectiveDate)
+			}
+			r = append(r, rate)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("EUR/USD rates: %v", err)
+		}
+		return r
+	}
+
+	runInvokeCases(t, "set_fx_rate", setupFXLedger, []invokeCase{
+		{name: "later rate", role: RoleAdmin, id: "A1", args: []string{"EUR", "USD", "1.2", "2026-12-01"}, check: func(t *testing.T, stub *mockStub) {
+			r := rates(t, stub)
+			if len(r) != 3 || r[2].Rate.String() != "1.2" || r[2].EffectiveDate != "2026-12-01" || r[2].SetBy != "A1" {
+				t.Errorf("later rate: stored %+v", r)
+			}
+		}},
+		{name: "earlier rate", role: RoleAdmin, id: "A1", args: []string{"EUR", "USD", "1.05", "2026-09-01"}, check: func(t *testing.T, stub *mockStub) {
+			if r := rates(t, stub); len(r) != 3 || r[0].EffectiveDate != "2026-09-01" || r[1].EffectiveDate != "2026-10-01" {
+				t.Errorf("earlier rate: stored %+v, want it first", r)
+			}
+		}},
+		{name: "correction", role: RoleAdmin, id: "A1", args: []string{"EUR", "USD", "1.0850", "2026-10-01"}, check: func(t *testing.T, stub *mockStub) {
+			if r := rates(t, stub); len(r) != 2 || r[0].Rate.String() != "1.0850" {
+				t.Errorf("correction: stored %+v, want the October rate replaced", r)
+			}
+		}},
+		{name: "garbage after the date", role: RoleAdmin, id: "A1", args: []string{"EUR", "USD", "1.2", "2026-11-01garbage"}, wantErr: "YYYY-MM-DD"},
+		{name: "timestamp", role: RoleAdmin, id: "A1", args: []string{"EUR", "USD", "1.2", "2026-11-01T00:00:00Z"}, wantErr: "YYYY-MM-DD"},
+		{name: "no date", role: RoleAdmin, id: "A1", args: []string{"EUR", "USD", "1.2", ""}, wantErr: "non-empty"},
+		{name: "zero rate", role: RoleAdmin, id: "A1", args: []string{"EUR", "USD", "0", "2026-11-01"}, wantErr: "greater than zero"},
+		{name: "same currency", role: RoleAdmin, id: "A1", args: []string{"USD", "USD", "1", "2026-11-01"}, wantErr: "to itself"},
+		{name: "unknown currency", role: RoleAdmin, id: "A1", args: []string{"EUR", "XYZ", "1.2", "2026-11-01"}, wantErr: "XYZ"},
+		{name: "by a vendor", role: RoleVendor, id: "V1", args: []string{"EUR", "USD", "1.2", "2026-11-01"}, wantErr: "not allowed"},
+	})
+}
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		amount   string
+		currency string
+		rate     string
+		to       string
+		want     string
+	}{
+		{"100.00", "EUR", "1.0845", "USD", "108.45"},
+		{"0.05", "EUR", "1.1", "USD", "0.06"}, //0.055 rounds half away from zero
+		{"-0.05", "EUR", "1.1", "USD", "-0.06"},
+		{"0.01", "EUR", "1.0845", "USD", "0.01"},   //0.010845
+		{"10.00", "USD", "149.5", "JPY", "1495"},   //no minor units
+		{"0.03", "USD", "149.5", "JPY", "4"},       //4.485
+		{"1000", "JPY", "0.0066", "USD", "6.60"},   //more minor units than the amount
+		{"1.000", "KWD", "3.25", "USD", "3.25"},    //three minor units
+		{"1.23", "USD", "0.30745", "KWD", "0.378"}, //0.3781635
+	}
+	for _, tc := range cases {
+		amount, err := ParseMoney(tc.amount, tc.currency)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.amount, tc.currency, err)
+		}
+		rate, err := ParseRate(tc.rate)
+		if err != nil {
+			t.Fatalf("rate %s: %v", tc.rate, err)
+		}
+		got, err := amount.Convert(rate, tc.to)
+		if err != nil || got.String() != tc.want {
+			t.Errorf("%s %s at %s: got %s %v, want %s %s", tc.amount, tc.currency, tc.rate, got, err, tc.want, tc.to)
+		}
+	}
+}
+
+func TestConvertAmount(t *testing.T) {
+	stub := newMockStub()
+	setupFXLedger(t, stub)
+	cases := []struct {
+		amount  string
+		from    string
+		to      string
+		date    string
+		want    string
+		wantErr string
+	}{
+		{"100.00", "EUR", "USD", "2026-10-01", "108.45", ""},
+		{"100.00", "EUR", "USD", "2026-10-31T23:59:59Z", "108.45", ""}, //a timestamp is read as its day
+		{"100.00", "EUR", "USD", "2026-11-01", "110.00", ""},
+		{"100.00", "EUR", "USD", "2027-01-01", "110.00", ""},
+		{"100.00", "USD", "USD", "2026-01-01", "100.00", ""},
+		{"100.00", "EUR", "USD", "2026-09-30", "", "No EUR/USD rate effective on 2026-09-30"},
+		{"100.00", "USD", "EUR", "2026-11-01", "", "No USD/EUR rate"}, //rates are not inverted
+		{"100.00", "EUR", "USD", "October", "", "YYYY-MM-DD"},
+		{"100.00", "EUR", "GBP", "2026-11-01", "", "No EUR/GBP rate"},
+	}
+	for _, tc := range cases {
+		amount, _ := ParseMoney(tc.amount, tc.from)
+		got, _, err := convertAmount(stub, amount, tc.from, tc.to, tc.date)
+		if !errorMatches(err, tc.wantErr) || (err == nil && got.String() != tc.want) {
+			t.Errorf("%s %s to %s on %s: got %s %v, want %s %q", tc.amount, tc.from, tc.to, tc.date, got, err, tc.want, tc.wantErr)
+		}
+	}
+
+	//a rate that cannot be read fails the lookup instead of being skipped
+	stub.state[fxRateKey("EUR", "USD", "2026-10-15")] = "{"
+	if _, err := stub.mockQuery(new(SimpleChaincode), "get_fx_rate", "EUR", "USD", "2026-10-20"); err == nil || errorOf(err).Code != CodeInternal {
+		t.Errorf("corrupt rate: got %v, want code %s", err, CodeInternal)
+	}
+}
+
+func TestInvoiceReport(t *testing.T) {
+	stub := newMockStub()
+	setupFXLedger(t, stub) //INV-1 100.00 USD
+	eur := invoiceArgs("V1", "C1", "INV-2", "33.33", "steel", "4")
+	eur[4] = "EUR"
+	mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", eur...)
+
+	report := func(date string) (InvoiceReport, error) {
+		var r InvoiceReport
+		res, err := stub.as(RoleAuditor, "AU1").mockQuery(new(SimpleChaincode), "invoice_report", "USD", date)
+		if err == nil {
+			err = json.Unmarshal(res, &r)
+		}
+		return r, err
+	}
+
+	r, err := report("2026-10-15")
+	if err != nil {
+		t.Fatalf("invoice_report: %v", err)
+	}
+	if len(r.Invoices) != 2 || r.Invoices[1].Rate != "1.0845" || r.Invoices[1].ReportingAmount.String() != "36.15" ||
+		r.Invoices[0].Rate != "" || r.TotalAmount.String() != "136.15" || r.TotalOutstanding.String() != "136.15" {
+		t.Errorf("invoice_report in October: got %+v", r) //33.33 * 1.0845 = 36.146385
+	}
+	r, err = report("2026-11-01")
+	if err != nil || r.TotalAmount.String() != "136.66" { //33.33 * 1.1 = 36.663
+		t.Errorf("invoice_report in November: got %+v %v, want total 136.66", r, err)
+	}
+	_, err = report("2026-09-30")
+	if !errorMatches(err, "No EUR/USD rate effective on 2026-09-30") {
+		t.Errorf("invoice_report before the first rate: got %v", err)
+	}
+}
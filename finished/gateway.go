@@ -0,0 +1,409 @@
+//go:build tools
+// +build tools
+
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// The gateway serves the peer's /chaincode JSON-RPC and /registrar REST endpoints, so LearnChaincodeREST.postman_collection.json
+// works with no network:
+//
+//	chaincode_finished gateway -listen localhost:7050 -ledger ledger.json -users users.json
+//
+// Unlike the peer, an invoke runs before the response is sent, and a failed invoke answers with its error. It only
+// listens on this machine unless given another address, such as -listen :7050 for every interface.
+
+// JSON-RPC error codes of the peer REST API
+var (
+	rpcParseError        = rpcError{Code: -32700, Message: "Parse error"}
+	rpcInvalidRequest    = rpcError{Code: -32600, Message: "Invalid request"}
+	rpcMethodNotFound    = rpcError{Code: -32601, Message: "Method not found"}
+	rpcInvalidParams     = rpcError{Code: -32602, Message: "Invalid params"}
+	rpcDeploymentFailure = rpcError{Code: -32001, Message: "Deployment failure"}
+	rpcInvokeFailure     = rpcError{Code: -32002, Message: "Invoke failure"}
+	rpcQueryFailure      = rpcError{Code: -32003, Message: "Query failure"}
+)
+
+// rpcRequest is a request to /chaincode
+type rpcRequest struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"` //deploy, invoke or query
+	Params  *chaincodeSpec  `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// chaincodeSpec is the params of a request, the peer's ChaincodeSpec
+type chaincodeSpec struct {
+	Type        int `json:"type"`
+	ChaincodeID struct {
+		Path string `json:"path"`
+		Name string `json:"name"`
+	} `json:"chaincodeID"`
+	CtorMsg struct {
+		Function string   `json:"function"`
+		Args     []string `json:"args"`
+	} `json:"ctorMsg"`
+	SecureContext string `json:"secureContext"`
+}
+
+// rpcResponse is the answer from /chaincode, with either a result or an error
+type rpcResponse struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Result  *rpcResult      `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcResult struct {
+	Status  string `json:"status"`
+	Message string `json:"message"` //chaincode name for deploy, tx id for invoke, the result for query
+}
+
+type rpcError struct {
+	Code    int64  `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data,omitempty"` //for a chaincode error, its {"code", "field", "message"} envelope
+}
+
+// gatewayUser is one user the registrar knows, with the certificate attributes the chaincode reads
+type gatewayUser struct {
+	Secret string `json:"secret"`
+	Role   string `json:"role"`
+	ID     string `json:"id"`
+}
+
+// gateway runs SimpleChaincode for HTTP requests, one transaction at a time
+type gateway struct {
+	lock   sync.Mutex
+	ledger *localLedger
+	users  map[string]gatewayUser //by enroll id
+	cc     shim.Chaincode
+}
+
+// ============================================================================================================================
+// runGateway - the gateway command, serve until the listener fails
+// ============================================================================================================================
+func runGateway(args []string) error {
+	flags := flag.NewFlagSet("gateway", flag.ContinueOnError)
+	listen := flags.String("listen", "localhost:7050", "address to serve the REST API on, \":7050\" to serve other machines")
+	ledgerPath := flags.String("ledger", "ledger.json", "file the world state is kept in")
+	usersPath := flags.String("users", "", "JSON file of users by enroll id, each with a secret, role and id")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	ledger, err := openLedger(*ledgerPath)
+	if err != nil {
+		return err
+	}
+	users := map[string]gatewayUser{}
+	if *usersPath != "" {
+		usersAsBytes, err := ioutil.ReadFile(*usersPath)
+		if err != nil {
+			return errors.New("Failed to read users " + *usersPath + ": " + err.Error())
+		}
+		err = json.Unmarshal(usersAsBytes, &users)
+		if err != nil {
+			return errors.New("Users file " + *usersPath + " is corrupt: " + err.Error())
+		}
+	}
+
+	g := newGateway(ledger, users)
+	fmt.Println("gateway serving " + *listen + " with ledger " + *ledgerPath)
+	return http.ListenAndServe(*listen, g.handler())
+}
+
+func newGateway(ledger *localLedger, users map[string]gatewayUser) *gateway {
+	return &gateway{ledger: ledger, users: users, cc: new(SimpleChaincode)}
+}
+
+// handler - the routes of the REST API
+func (g *gateway) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chaincode", g.serveChaincode)
+	mux.HandleFunc("/registrar", g.serveRegistrar)
+	mux.HandleFunc("/registrar/", g.serveRegistrar)
+	mux.HandleFunc("/chain", g.serveChain)
+	return mux
+}
+
+// writeJSON - send a JSON answer with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ============================================================================================================================
+// serveChaincode - POST /chaincode, deploy, invoke or query as JSON-RPC 2.0
+// ============================================================================================================================
+func (g *gateway) serveChaincode(w http.ResponseWriter, r *http.Request) {
+	var req rpcRequest
+	fail := func(status int, e rpcError, data string) {
+		e.Data = data
+		writeJSON(w, status, rpcResponse{Jsonrpc: "2.0", Error: &e, ID: req.ID})
+	}
+
+	if r.Method != "POST" {
+		fail(http.StatusMethodNotAllowed, rpcInvalidRequest, "Expecting POST")
+		return
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		fail(http.StatusBadRequest, rpcParseError, err.Error())
+		return
+	}
+	if req.Jsonrpc != "2.0" {
+		fail(http.StatusBadRequest, rpcInvalidRequest, "JSON-RPC version must be 2.0")
+		return
+	}
+	if req.Params == nil {
+		fail(http.StatusBadRequest, rpcInvalidParams, "Missing params")
+		return
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	attributes, err := g.callerAttributes(req.Params.SecureContext)
+	if err != nil {
+		fail(http.StatusUnauthorized, rpcInvalidParams, err.Error())
+		return
+	}
+
+	switch req.Method {
+	case "deploy":
+		name, err := g.deploy(req.Params, attributes)
+		if err != nil {
+			fail(http.StatusInternalServerError, rpcDeploymentFailure, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, rpcResponse{Jsonrpc: "2.0", Result: &rpcResult{Status: "OK", Message: name}, ID: req.ID})
+	case "invoke":
+		txID, err := g.invoke(req.Params, attributes)
+		if err != nil {
+			fail(http.StatusInternalServerError, rpcInvokeFailure, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, rpcResponse{Jsonrpc: "2.0", Result: &rpcResult{Status: "OK", Message: txID}, ID: req.ID})
+	case "query":
+		res, err := g.query(req.Params, attributes)
+		if err != nil {
+			fail(http.StatusInternalServerError, rpcQueryFailure, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, rpcResponse{Jsonrpc: "2.0", Result: &rpcResult{Status: "OK", Message: string(res)}, ID: req.ID})
+	default:
+		fail(http.StatusNotFound, rpcMethodNotFound, "Unknown method \""+req.Method+"\", expecting deploy, invoke or query")
+	}
+}
+
+// callerAttributes - the certificate attributes of a logged in user, none when the request has no secure context
+func (g *gateway) callerAttributes(enrollID string) (map[string]string, error) {
+	if enrollID == "" {
+		return map[string]string{}, nil
+	}
+	user, ok := g.users[enrollID]
+	if !ok || !g.ledger.Logins[enrollID] {
+		return nil, errors.New("User " + enrollID + " is not logged in. Use the /registrar endpoint to log in")
+	}
+	return map[string]string{roleAttribute: user.Role, idAttribute: user.ID}, nil
+}
+
+// chaincodeName - the name a chaincode path deploys under, a hash of the path like the peer gives
+func chaincodeName(path string) string {
+	hash := sha512.Sum512([]byte(path))
+	return hex.EncodeToString(hash[:])
+}
+
+// deployed - the chaincode a request names, by name or by the path it was deployed from
+func (g *gateway) deployed(spec *chaincodeSpec) (*localChaincode, error) {
+	name := spec.ChaincodeID.Name
+	if name == "" {
+		name = chaincodeName(spec.ChaincodeID.Path)
+	}
+	cc, ok := g.ledger.Chaincodes[name]
+	if !ok {
+		return nil, errors.New("Chaincode " + name + " is not deployed")
+	}
+	return cc, nil
+}
+
+// commit - keep what a transaction wrote, in memory and in the ledger file
+func (g *gateway) commit(stub *ledgerStub) error {
+	g.ledger.Height++
+	err := g.ledger.save()
+	if err != nil {
+		stub.rollback()
+		g.ledger.Height--
+		return err
+	}
+	if stub.event != nil {
+		fmt.Println("event " + stub.event.Name + " in " + stub.txID + ": " + stub.event.Payload)
+	}
+	return nil
+}
+
+// recoverTransaction - a transaction that panics is rolled back and fails, the gateway keeps serving
+func recoverTransaction(stub *ledgerStub, err *error) {
+	if r := recover(); r != nil {
+		stub.rollback()
+		*err = fmt.Errorf("Transaction %s failed: %v", stub.txID, r)
+	}
+}
+
+// ============================================================================================================================
+// deploy - run Init on a new chaincode, or again on one deployed from the same path
+// ============================================================================================================================
+func (g *gateway) deploy(spec *chaincodeSpec, attributes map[string]string) (_ string, err error) {
+	if spec.ChaincodeID.Path == "" {
+		return "", errors.New("Deploy needs chaincodeID.path")
+	}
+	name := chaincodeName(spec.ChaincodeID.Path)
+	cc, ok := g.ledger.Chaincodes[name]
+	if !ok {
+		cc = &localChaincode{Path: spec.ChaincodeID.Path, State: map[string]string{}}
+	}
+
+	stub := newLedgerStub(cc.State, attributes, false)
+	defer recoverTransaction(stub, &err)
+	_, err = g.cc.Init(stub, spec.CtorMsg.Function, spec.CtorMsg.Args)
+	if err != nil {
+		stub.rollback()
+		return "", err
+	}
+	g.ledger.Chaincodes[name] = cc
+	err = g.commit(stub)
+	if err != nil {
+		if !ok {
+			delete(g.ledger.Chaincodes, name)
+		}
+		return "", err
+	}
+	return name, nil
+}
+
+// ============================================================================================================================
+// invoke - run one transaction, kept only if it succeeds
+// ============================================================================================================================
+func (g *gateway) invoke(spec *chaincodeSpec, attributes map[string]string) (_ string, err error) {
+	cc, err := g.deployed(spec)
+	if err != nil {
+		return "", err
+	}
+	stub := newLedgerStub(cc.State, attributes, false)
+	defer recoverTransaction(stub, &err)
+	_, err = g.cc.Invoke(stub, spec.CtorMsg.Function, spec.CtorMsg.Args)
+	if err != nil {
+		stub.rollback()
+		return "", err
+	}
+	err = g.commit(stub)
+	if err != nil {
+		return "", err
+	}
+	return stub.txID, nil
+}
+
+// ============================================================================================================================
+// query - run a query, which may not write
+// ============================================================================================================================
+func (g *gateway) query(spec *chaincodeSpec, attributes map[string]string) ([]byte, error) {
+	cc, err := g.deployed(spec)
+	if err != nil {
+		return nil, err
+	}
+	stub := newLedgerStub(cc.State, attributes, true)
+	return g.cc.Query(stub, spec.CtorMsg.Function, spec.CtorMsg.Args)
+}
+
+// ============================================================================================================================
+// serveRegistrar - POST /registrar logs a user in, GET /registrar/<id> checks and DELETE /registrar/<id> logs out
+// ============================================================================================================================
+func (g *gateway) serveRegistrar(w http.ResponseWriter, r *http.Request) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	enrollID := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/registrar"), "/")
+
+	switch {
+	case r.Method == "POST" && enrollID == "":
+		var login struct {
+			EnrollID     string `json:"enrollId"`
+			EnrollSecret string `json:"enrollSecret"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&login)
+		if err != nil || login.EnrollID == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"Error": "Expecting enrollId and enrollSecret"})
+			return
+		}
+		user, ok := g.users[login.EnrollID]
+		if !ok || user.Secret != login.EnrollSecret {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"Error": "Login failed for user '" + login.EnrollID + "'"})
+			return
+		}
+		g.ledger.Logins[login.EnrollID] = true
+		err = g.ledger.save()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"OK": "Login successful for user '" + login.EnrollID + "'."})
+	case r.Method == "GET" && enrollID != "":
+		if !g.ledger.Logins[enrollID] {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"Error": "User " + enrollID + " must log in."})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"OK": "User " + enrollID + " is already logged in."})
+	case r.Method == "DELETE" && enrollID != "":
+		delete(g.ledger.Logins, enrollID)
+		err := g.ledger.save()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"OK": "Deleted login token for user " + enrollID + "."})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"Error": "Expecting POST /registrar, GET or DELETE /registrar/<enrollId>"})
+	}
+}
+
+// ============================================================================================================================
+// serveChain - GET /chain, the number of transactions committed so far
+// ============================================================================================================================
+func (g *gateway) serveChain(w http.ResponseWriter, r *http.Request) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	writeJSON(w, http.StatusOK, map[string]int64{"height": g.ledger.Height})
+}
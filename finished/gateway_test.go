@@ -0,0 +1,286 @@
+//go:build tools
+// +build tools
+
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var gatewayUsers = map[string]gatewayUser{
+	"admin": {Secret: "pw", Role: RoleAdmin, ID: "A1"},
+	"bob":   {Secret: "pw", Role: RoleBanker, ID: "B1"},
+}
+
+// startGateway - a gateway on a ledger file in dir, which is kept between calls
+func startGateway(t *testing.T, dir string) *httptest.Server {
+	ledger, err := openLedger(filepath.Join(dir, "ledger.json"))
+	if err != nil {
+		t.Fatalf("open ledger: %v", err)
+	}
+	return httptest.NewServer(newGateway(ledger, gatewayUsers).handler())
+}
+
+// post - send a JSON body and decode the answer into v
+func post(t *testing.T, url string, body string, v interface{}) int {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	return resp.StatusCode
+}
+
+// rpc - call /chaincode with a method, chaincode name, caller and ctorMsg
+func rpc(t *testing.T, server *httptest.Server, method string, name string, user string, function string, args ...string) rpcResponse {
+	var resp rpcResponse
+	req := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params": map[string]interface{}{
+			"type":          1,
+			"chaincodeID":   map[string]string{"name": name},
+			"ctorMsg":       map[string]interface{}{"function": function, "args": args},
+			"secureContext": user,
+		},
+		"id": 7,
+	}
+	body, _ := json.Marshal(req)
+	post(t, server.URL+"/chaincode", string(body), &resp)
+	return resp
+}
+
+func TestGatewayPostmanCollection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gateway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := startGateway(t, dir)
+
+	var collection struct {
+		Item []struct {
+			Name    string `json:"name"`
+			Request struct {
+				URL  string `json:"url"`
+				Body struct {
+					Raw string `json:"raw"`
+				} `json:"body"`
+			} `json:"request"`
+		} `json:"item"`
+	}
+	collectionAsBytes, err := ioutil.ReadFile("../LearnChaincodeREST.postman_collection.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(collectionAsBytes, &collection)
+	requests := map[string]string{}
+	for _, item := range collection.Item {
+		path := item.Request.URL[strings.LastIndex(item.Request.URL, "/"):]
+		requests[item.Name] = path + " " + item.Request.Body.Raw
+	}
+
+	//run the requests in the order a developer would, filling in the placeholders
+	var name string
+	for _, step := range []string{"Registrar Login", "Deploy", "Invoke", "Query"} {
+		request := requests[step]
+		if request == "" {
+			t.Fatalf("collection has no %s request", step)
+		}
+		request = strings.NewReplacer("<YOUR_USER_HERE>", "admin", "<YOUR_SECRET_HERE>", "pw", "<CHAINCODE_HASH_HERE>", name).Replace(request)
+		space := strings.Index(request, " ")
+		url, body := server.URL+request[:space], request[space+1:]
+
+		if step == "Registrar Login" {
+			var login map[string]string
+			if status := post(t, url, body, &login); status != http.StatusOK || login["OK"] == "" {
+				t.Fatalf("login: %d %v", status, login)
+			}
+			continue
+		}
+		var resp rpcResponse
+		status := post(t, url, body, &resp)
+		if status != http.StatusOK || resp.Error != nil || resp.Result.Status != "OK" {
+			t.Fatalf("%s: %d %+v", step, status, resp.Error)
+		}
+		switch step {
+		case "Deploy":
+			name = resp.Result.Message
+		case "Query":
+			if resp.Result.Message != "go away" {
+				t.Errorf("query read %q, want the value the invoke wrote", resp.Result.Message)
+			}
+		}
+	}
+	server.Close()
+
+	//a new gateway on the same file has the state and the login
+	server = startGateway(t, dir)
+	defer server.Close()
+	if resp := rpc(t, server, "query", name, "admin", "read", "hello_world"); resp.Result == nil || resp.Result.Message != "go away" {
+		t.Errorf("after restart: %+v", resp)
+	}
+}
+
+func TestGatewayErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gateway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := startGateway(t, dir)
+	defer server.Close()
+
+	var login map[string]string
+	if status := post(t, server.URL+"/registrar", `{"enrollId": "bob", "enrollSecret": "wrong"}`, &login); status != http.StatusUnauthorized {
+		t.Errorf("login with a wrong secret: %d %v", status, login)
+	}
+	post(t, server.URL+"/registrar", `{"enrollId": "bob", "enrollSecret": "pw"}`, &login)
+
+	deploy := `{"jsonrpc": "2.0", "method": "deploy", "params": {"chaincodeID": {"path": "erp"}, "ctorMsg": {"function": "init", "args": ["1"]}}, "id": 1}`
+	var resp rpcResponse
+	post(t, server.URL+"/chaincode", deploy, &resp)
+	if resp.Result == nil || resp.Result.Message != chaincodeName("erp") {
+		t.Fatalf("deploy: %+v", resp)
+	}
+	name := resp.Result.Message
+
+	cases := []struct {
+		name     string
+		resp     rpcResponse
+		wantCode int64
+		wantData string
+	}{
+		{"not logged in", rpc(t, server, "invoke", name, "admin", "write", "k", "v"), rpcInvalidParams.Code, "not logged in"},
+		{"chaincode error", rpc(t, server, "invoke", name, "bob", "create_account", "C1", "", "customer", "1 Main St", "12345", "555-0101", "B1"), rpcInvokeFailure.Code, `"code":"required","field":"accountname"`},
+		{"not deployed", rpc(t, server, "query", "nope", "bob", "read", "abc"), rpcQueryFailure.Code, "not deployed"},
+		{"unknown method", rpc(t, server, "upgrade", name, "bob", "init"), rpcMethodNotFound.Code, "expecting deploy"},
+	}
+	for _, tc := range cases {
+		if tc.resp.Error == nil || tc.resp.Error.Code != tc.wantCode || !strings.Contains(tc.resp.Error.Data, tc.wantData) {
+			t.Errorf("%s: got %+v, want code %d with %q", tc.name, tc.resp.Error, tc.wantCode, tc.wantData)
+		}
+	}
+
+	//a failed invoke writes nothing, a good one is committed with its own tx id
+	if resp := rpc(t, server, "invoke", name, "bob", "create_account", "C1", "Customer One", "customer", "1 Main St", "12345", "555-0101", "B2"); resp.Error == nil {
+		t.Fatalf("banker B1 opened an account for B2")
+	}
+	if resp := rpc(t, server, "query", name, "bob", "read", accountKey("C1")); resp.Result == nil || resp.Result.Message != "" {
+		t.Errorf("failed invoke left %+v", resp)
+	}
+	resp = rpc(t, server, "invoke", name, "bob", "create_account", "C1", "Customer One", "customer", "1 Main St", "12345", "555-0101", "B1")
+	if resp.Result == nil || len(resp.Result.Message) != 36 {
+		t.Fatalf("invoke: %+v", resp)
+	}
+	var account Account
+	resp = rpc(t, server, "query", name, "bob", "read", accountKey("C1"))
+	if json.Unmarshal([]byte(resp.Result.Message), &account); account.BankerID != "B1" {
+		t.Errorf("account after invoke %+v", resp)
+	}
+
+	var chain map[string]int64
+	getResp, err := http.Get(server.URL + "/chain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(getResp.Body).Decode(&chain)
+	getResp.Body.Close()
+	if chain["height"] != 2 {
+		t.Errorf("height %d, want the deploy and one invoke", chain["height"])
+	}
+
+	//after logging out the user has no access
+	req, _ := http.NewRequest("DELETE", server.URL+"/registrar/bob", &bytes.Buffer{})
+	if delResp, err := http.DefaultClient.Do(req); err != nil || delResp.StatusCode != http.StatusOK {
+		t.Errorf("logout: %v", err)
+	}
+	if resp := rpc(t, server, "query", name, "bob", "read", "abc"); resp.Error == nil || resp.Error.Code != rpcInvalidParams.Code {
+		t.Errorf("query after logout: %+v", resp)
+	}
+}
+
+// panickingChaincode writes a key, then panics on the "panic" invoke
+type panickingChaincode struct {
+	SimpleChaincode
+}
+
+func (t *panickingChaincode) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	if function == "panic" {
+		stub.PutState("half", []byte("written"))
+		panic("runtime error: index out of range")
+	}
+	return t.SimpleChaincode.Invoke(stub, function, args)
+}
+
+func TestGatewayRecoversPanic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gateway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ledger, err := openLedger(filepath.Join(dir, "ledger.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newGateway(ledger, gatewayUsers)
+	g.cc = new(panickingChaincode)
+
+	spec := &chaincodeSpec{}
+	spec.ChaincodeID.Path = "erp"
+	spec.CtorMsg.Function = "init"
+	spec.CtorMsg.Args = []string{"1"}
+	name, err := g.deploy(spec, nil)
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+
+	spec.ChaincodeID.Name = name
+	spec.CtorMsg.Function = "panic"
+	spec.CtorMsg.Args = nil
+	if _, err := g.invoke(spec, nil); err == nil || !strings.Contains(err.Error(), "index out of range") {
+		t.Errorf("invoke that panics: %v", err)
+	}
+	if _, ok := ledger.Chaincodes[name].State["half"]; ok || ledger.Height != 1 {
+		t.Errorf("invoke that panics left height %d and state %v", ledger.Height, ledger.Chaincodes[name].State)
+	}
+
+	spec.CtorMsg.Function = "write"
+	spec.CtorMsg.Args = []string{"k", "v"}
+	if _, err := g.invoke(spec, map[string]string{"role": RoleAdmin, "id": "A1"}); err != nil {
+		t.Errorf("invoke after a panic: %v", err)
+	}
+}
@@ -0,0 +1,557 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// The general ledger keeps double-entry journal entries for the books of every party. Issuing an invoice posts
+// receivable/revenue in the vendor's books and expense/payable in the customer's, settling a payment posts
+// cash/receivable for the owner of the invoice and payable/cash for the customer. Selling an invoice moves the
+// receivable from the seller's books to the buyer's, the discount is an expense of the seller and income of the
+// buyer. Entries are never changed, a cancelled invoice is reversed by a new entry.
+
+var chartOfAccountsStr = "_gl_chart" //name for the key/value that holds the chart of accounts
+
+// what a GL account is used for, the purposes the chart of accounts maps to account codes
+const (
+	GLReceivable = "receivable"
+	GLPayable    = "payable"
+	GLRevenue    = "revenue"
+	GLExpense    = "expense"
+	GLCash       = "cash"
+
+	GLDiscountExpense = "discount_expense" //discount a seller gives up when it sells an invoice
+	GLDiscountIncome  = "discount_income"  //discount a buyer earns on an invoice it bought
+	GLTransfer        = "transfer"         //clearing account for receivables handed over without a price
+)
+
+// where an entry came from, stored in JournalEntry.Source
+const (
+	SourceInvoice    = "invoice"
+	SourcePayment    = "payment"
+	SourceAdjustment = "adjustment"
+	SourceTrade      = "trade"
+	SourceTransfer   = "transfer"
+)
+
+// GLAccount is one account of the chart of accounts
+type GLAccount struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// ChartOfAccounts maps each purpose to the GL account postings for it go to
+type ChartOfAccounts map[string]GLAccount
+
+// defaultChart is used until an admin sets accounts of their own
+var defaultChart = ChartOfAccounts{
+	GLCash:       {Code: "1000", Name: "Cash"},
+	GLReceivable: {Code: "1200", Name: "Accounts receivable"},
+	GLPayable:    {Code: "2000", Name: "Accounts payable"},
+	GLRevenue:    {Code: "4000", Name: "Revenue"},
+	GLExpense:    {Code: "5000", Name: "Expenses"},
+
+	GLDiscountIncome:  {Code: "4200", Name: "Discount income"},
+	GLDiscountExpense: {Code: "5200", Name: "Factoring discount"},
+	GLTransfer:        {Code: "1900", Name: "Receivables transferred"},
+}
+
+// Posting is one line of a journal entry, in the books of one party
+type Posting struct {
+	Entity       string `json:"entity"`       //Account.ID whose books the line is in
+	Account      string `json:"account"`      //GL account code
+	Counterparty string `json:"counterparty"` //Account.ID on the other side of the business
+	Currency     string `json:"currency"`
+	Debit        Money  `json:"debit"`
+	Credit       Money  `json:"credit"`
+}
+
+// JournalEntry is a balanced set of postings made by one business event
+type JournalEntry struct {
+	ID          string    `json:"id"`   //its key, journal~<date>~<tx id>~<seq>
+	Date        string    `json:"date"` //posting date, YYYY-MM-DD
+	TxID        string    `json:"txid"`
+	Source      string    `json:"source"`   //invoice, payment, trade, transfer or adjustment
+	SourceID    string    `json:"sourceid"` //invoice key, payment id, trade id or tx id of an adjustment or transfer
+	Description string    `json:"description"`
+	Lines       []Posting `json:"lines"`
+}
+
+// JournalTotal is the sum of the debits and credits in one currency
+type JournalTotal struct {
+	Currency string `json:"currency"`
+	Debit    Money  `json:"debit"`
+	Credit   Money  `json:"credit"`
+	Balanced bool   `json:"balanced"`
+}
+
+// Journal is the answer of the journal query
+type Journal struct {
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Entity   string         `json:"entity,omitempty"`
+	Entries  []JournalEntry `json:"entries"`
+	Totals   []JournalTotal `json:"totals"`   //by currency
+	Balanced bool           `json:"balanced"` //debits equal credits in every currency
+}
+
+// journalTotals sums postings by currency
+type journalTotals map[string]*JournalTotal
+
+func (totals journalTotals) add(line Posting) error {
+	total, ok := totals[line.Currency]
+	if !ok {
+		total = &JournalTotal{Currency: line.Currency, Debit: ZeroMoney(line.Currency), Credit: ZeroMoney(line.Currency)}
+		totals[line.Currency] = total
+	}
+	var err error
+	total.Debit, err = total.Debit.Add(line.Debit)
+	if err != nil {
+		return err
+	}
+	total.Credit, err = total.Credit.Add(line.Credit)
+	return err
+}
+
+// sorted - the totals in currency order, and whether debits equal credits in all of them
+func (totals journalTotals) sorted() ([]JournalTotal, bool) {
+	var currencies []string
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	list := []JournalTotal{}
+	balanced := true
+	for _, currency := range currencies {
+		total := totals[currency]
+		total.Balanced = total.Debit.Cmp(total.Credit) == 0
+		balanced = balanced && total.Balanced
+		list = append(list, *total)
+	}
+	return list, balanced
+}
+
+// journalKey - entries are keyed by posting date first, so a period is one range query
+func journalKey(date string, txID string, seq int) string {
+	return makeKey(journalType, date, txID, fmt.Sprintf("%03d", seq))
+}
+
+// ============================================================================================================================
+// getChart - the chart of accounts, the default accounts for purposes an admin has not set
+// ============================================================================================================================
+func getChart(stub shim.ChaincodeStubInterface) (ChartOfAccounts, error) {
+	chart := ChartOfAccounts{}
+	for purpose, account := range defaultChart {
+		chart[purpose] = account
+	}
+	chartAsBytes, err := stub.GetState(chartOfAccountsStr)
+	if err != nil {
+		return nil, newError(CodeInternal, "", "Failed to get chart of accounts")
+	}
+	var set ChartOfAccounts
+	json.Unmarshal(chartAsBytes, &set) //un stringify it aka JSON.parse()
+	for purpose, account := range set {
+		chart[purpose] = account
+	}
+	return chart, nil
+}
+
+// ============================================================================================================================
+// postEntry - check that an entry balances in the books of each party and its date is in an open period,
+// then store it under the next key of this transaction
+// ============================================================================================================================
+func postEntry(stub shim.ChaincodeStubInterface, entry JournalEntry) error {
+	var err error
+
+	sums := map[string]Money{} //debits less credits, by entity and currency
+	for _, line := range entry.Lines {
+		key := line.Entity + " " + line.Currency
+		sum, ok := sums[key]
+		if !ok {
+			sum = ZeroMoney(line.Currency)
+		}
+		sum, err = sum.Add(line.Debit)
+		if err != nil {
+			return err
+		}
+		sums[key], err = sum.Sub(line.Credit)
+		if err != nil {
+			return err
+		}
+	}
+	for key, sum := range sums {
+		if !sum.IsZero() {
+			return newError(CodeInvalidArgument, "lines", "Journal entry for "+entry.SourceID+" does not balance for "+key+", off by "+sum.String())
+		}
+	}
+
+	if entry.Date == "" {
+		entry.Date, err = txDate(stub)
+		if err != nil {
+			return err
+		}
+	}
+	err = checkPeriodOpen(stub, "", entry.Date)
+	if err != nil {
+		return err
+	}
+	entry.TxID = stub.GetTxID()
+	for seq := 0; entry.ID == ""; seq++ { //skip the entries this transaction posted already
+		key := journalKey(entry.Date, entry.TxID, seq)
+		existing, err := stub.GetState(key)
+		if err != nil {
+			return newError(CodeInternal, "", "Failed to get journal entry "+key)
+		}
+		if existing == nil {
+			entry.ID = key
+		}
+	}
+
+	jsonAsBytes, _ := json.Marshal(entry)
+	err = stub.PutState(entry.ID, jsonAsBytes)
+	if err != nil {
+		return err
+	}
+	fmt.Println("! journal " + entry.ID + " " + entry.Description)
+	return nil
+}
+
+// pair - a debit to one account and a credit to another, in the books of entity
+func pair(entity string, counterparty string, debit GLAccount, credit GLAccount, amount Money, currency string) []Posting {
+	zero := ZeroMoney(currency)
+	return []Posting{
+		{Entity: entity, Account: debit.Code, Counterparty: counterparty, Currency: currency, Debit: amount, Credit: zero},
+		{Entity: entity, Account: credit.Code, Counterparty: counterparty, Currency: currency, Debit: zero, Credit: amount},
+	}
+}
+
+// ============================================================================================================================
+// postInvoice - the receivable and revenue of the vendor and the expense and payable of the customer for an invoice.
+// A reversal posts the same lines the other way round.
+// ============================================================================================================================
+func postInvoice(stub shim.ChaincodeStubInterface, inv Invoice, amount Money, reverse bool, description string) error {
+	chart, err := getChart(stub)
+	if err != nil {
+		return err
+	}
+	vendorDebit, vendorCredit := chart[GLReceivable], chart[GLRevenue]
+	customerDebit, customerCredit := chart[GLExpense], chart[GLPayable]
+	if reverse {
+		vendorDebit, vendorCredit = vendorCredit, vendorDebit
+		customerDebit, customerCredit = customerCredit, customerDebit
+	}
+
+	entry := JournalEntry{}
+	entry.Source = SourceInvoice
+	entry.SourceID = invoiceKey(inv.VendorID, inv.InvoiceNumber)
+	entry.Description = description
+	entry.Lines = append(pair(inv.VendorID, inv.CustomerID, vendorDebit, vendorCredit, amount, inv.Currency),
+		pair(inv.CustomerID, inv.VendorID, customerDebit, customerCredit, amount, inv.Currency)...)
+	return postEntry(stub, entry)
+}
+
+// ============================================================================================================================
+// postStatusChange - post the latest status change of an invoice if it moves money: issuing a draft posts the invoice,
+// cancelling an issued invoice reverses what is still outstanding
+// ============================================================================================================================
+func postStatusChange(stub shim.ChaincodeStubInterface, inv Invoice) error {
+	if len(inv.StatusHistory) == 0 {
+		return nil
+	}
+	change := inv.StatusHistory[len(inv.StatusHistory)-1]
+	switch {
+	case change.From == StatusDraft && change.To == StatusIssued:
+		return postInvoice(stub, inv, inv.InvoiceAmount, false, "invoice "+inv.InvoiceNumber+" issued")
+	case change.From != StatusDraft && change.To == StatusCancelled && !inv.OutstandingAmount.IsZero():
+		return postInvoice(stub, inv, inv.OutstandingAmount, true, "invoice "+inv.InvoiceNumber+" cancelled")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// postPayment - one entry per invoice a payment settled, cash against the receivable of the payee and the payable
+// of the customer, in the currency of the invoice and dated on the payment date
+// ============================================================================================================================
+func postPayment(stub shim.ChaincodeStubInterface, payment Payment, invoices []Invoice) error {
+	chart, err := getChart(stub)
+	if err != nil {
+		return err
+	}
+	for i, alloc := range payment.Allocations {
+		inv := invoices[i]
+		entry := JournalEntry{}
+		entry.Date, err = dateKey(payment.PaymentDate)
+		if err != nil {
+			return err
+		}
+		entry.Source = SourcePayment
+		entry.SourceID = payment.PaymentID
+		entry.Description = "payment " + payment.PaymentID + " for invoice " + inv.InvoiceNumber
+		shares := alloc.Shares
+		if len(shares) == 0 {
+			shares = []Collection{{Holder: alloc.Payee, Amount: alloc.AppliedAmount}}
+		}
+		entry.Lines = nil
+		for _, share := range shares {
+			entry.Lines = append(entry.Lines, pair(share.Holder, inv.CustomerID, chart[GLCash], chart[GLReceivable], share.Amount, inv.Currency)...)
+		}
+		entry.Lines = append(entry.Lines, pair(inv.CustomerID, inv.VendorID, chart[GLPayable], chart[GLCash], alloc.AppliedAmount, inv.Currency)...)
+		err = postEntry(stub, entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// postTrade - the sale of an invoice: the seller swaps the receivable for cash and the discount, the buyer pays cash
+// for a receivable worth the face value and earns the discount
+// ============================================================================================================================
+func postTrade(stub shim.ChaincodeStubInterface, inv Invoice, purchase Purchase) error {
+	chart, err := getChart(stub)
+	if err != nil {
+		return err
+	}
+	discount, err := purchase.FaceValue.Sub(purchase.Price)
+	if err != nil {
+		return err
+	}
+	zero := ZeroMoney(inv.Currency)
+
+	entry := JournalEntry{}
+	entry.Source = SourceTrade
+	entry.SourceID = purchase.TradeID
+	entry.Description = "invoice " + inv.InvoiceNumber + " sold to " + purchase.Buyer + " at " + purchase.Discount + "% discount"
+	entry.Lines = []Posting{
+		{Entity: purchase.Seller, Account: chart[GLCash].Code, Counterparty: purchase.Buyer, Currency: inv.Currency, Debit: purchase.Price, Credit: zero},
+		{Entity: purchase.Seller, Account: chart[GLReceivable].Code, Counterparty: inv.CustomerID, Currency: inv.Currency, Debit: zero, Credit: purchase.FaceValue},
+		{Entity: purchase.Buyer, Account: chart[GLReceivable].Code, Counterparty: inv.CustomerID, Currency: inv.Currency, Debit: purchase.FaceValue, Credit: zero},
+		{Entity: purchase.Buyer, Account: chart[GLCash].Code, Counterparty: purchase.Seller, Currency: inv.Currency, Debit: zero, Credit: purchase.Price},
+	}
+	if !discount.IsZero() {
+		entry.Lines = append(entry.Lines,
+			Posting{Entity: purchase.Seller, Account: chart[GLDiscountExpense].Code, Counterparty: purchase.Buyer, Currency: inv.Currency, Debit: discount, Credit: zero},
+			Posting{Entity: purchase.Buyer, Account: chart[GLDiscountIncome].Code, Counterparty: purchase.Seller, Currency: inv.Currency, Debit: zero, Credit: discount})
+	}
+	return postEntry(stub, entry)
+}
+
+// ============================================================================================================================
+// postTransfer - a share of an invoice handed over off the trade book. No price is agreed, so nothing is earned or lost:
+// the receivable moves from the books of the giver to the books of the receiver through the transfer clearing account.
+// ============================================================================================================================
+func postTransfer(stub shim.ChaincodeStubInterface, inv Invoice, from string, to string, face Money) error {
+	chart, err := getChart(stub)
+	if err != nil {
+		return err
+	}
+	zero := ZeroMoney(inv.Currency)
+
+	entry := JournalEntry{}
+	entry.Source = SourceTransfer
+	entry.SourceID = stub.GetTxID()
+	entry.Description = "share of invoice " + inv.InvoiceNumber + " given to " + to
+	entry.Lines = []Posting{
+		{Entity: from, Account: chart[GLTransfer].Code, Counterparty: to, Currency: inv.Currency, Debit: face, Credit: zero},
+		{Entity: from, Account: chart[GLReceivable].Code, Counterparty: inv.CustomerID, Currency: inv.Currency, Debit: zero, Credit: face},
+		{Entity: to, Account: chart[GLReceivable].Code, Counterparty: inv.CustomerID, Currency: inv.Currency, Debit: face, Credit: zero},
+		{Entity: to, Account: chart[GLTransfer].Code, Counterparty: from, Currency: inv.Currency, Debit: zero, Credit: face},
+	}
+	return postEntry(stub, entry)
+}
+
+// ============================================================================================================================
+// Post Adjustment - a manual journal entry dated today, the way to correct the books of a closed period.
+// Each line gives a debit or a credit, the entry must balance in the books of each party.
+// ============================================================================================================================
+func (t *SimpleChaincode) post_adjustment(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0				1			2		3				4		5			6			7...
+	// "description", "Entity", "Account", "Counterparty", "Currency", "Debit", "Credit", "Entity"...
+	if len(args) < 7 || (len(args)-1)%6 != 0 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting a description and 6 for each line")
+	}
+
+	fmt.Println("- start post adjustment")
+	if len(args[0]) <= 0 {
+		return nil, argError(CodeRequired, 1, "1st argument must be a non-empty string")
+	}
+	entry := JournalEntry{}
+	entry.Source = SourceAdjustment
+	entry.SourceID = stub.GetTxID()
+	entry.Description = args[0]
+	for i := 1; i < len(args); i += 6 {
+		line := Posting{Entity: args[i], Account: args[i+1], Counterparty: args[i+2], Currency: args[i+3]}
+		if len(line.Entity) <= 0 {
+			return nil, argError(CodeRequired, i+1, "argument "+strconv.Itoa(i+1)+" must be a non-empty entity")
+		}
+		if len(line.Account) <= 0 {
+			return nil, argError(CodeRequired, i+2, "argument "+strconv.Itoa(i+2)+" must be a non-empty GL account")
+		}
+		err := checkCurrency("currency", line.Currency)
+		if err != nil {
+			return nil, err
+		}
+		for j, amount := range []*Money{&line.Debit, &line.Credit} {
+			value := args[i+4+j]
+			if value == "" {
+				value = "0"
+			}
+			*amount, err = ParseMoney(value, line.Currency)
+			if err != nil || amount.Sign() < 0 {
+				return nil, argError(CodeOutOfRange, i+5+j, "argument "+strconv.Itoa(i+5+j)+" must be an amount of zero or more")
+			}
+		}
+		if line.Debit.IsZero() == line.Credit.IsZero() {
+			return nil, argError(CodeInvalidArgument, i+5, "Line "+strconv.Itoa(i/6+1)+" must have either a debit or a credit")
+		}
+		entry.Lines = append(entry.Lines, line)
+	}
+
+	err := postEntry(stub, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end post adjustment")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Set GL Account - point a purpose of the chart of accounts at a GL account
+// ============================================================================================================================
+func (t *SimpleChaincode) set_gl_account(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0			1		2
+	// "revenue", "4100", "Sales of goods"
+	if len(args) != 3 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start set gl account")
+	if _, ok := defaultChart[args[0]]; !ok {
+		return nil, newError(CodeInvalidArgument, "purpose", "Unknown GL account purpose \""+args[0]+"\", expecting cash, receivable, payable, revenue, expense, discount_income, discount_expense or transfer")
+	}
+	if len(args[1]) <= 0 {
+		return nil, argError(CodeRequired, 2, "2nd argument must be a non-empty string")
+	}
+
+	chart, err := getChart(stub)
+	if err != nil {
+		return nil, err
+	}
+	chart[args[0]] = GLAccount{Code: args[1], Name: args[2]}
+	jsonAsBytes, _ := json.Marshal(chart)
+	err = stub.PutState(chartOfAccountsStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end set gl account")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Chart Of Accounts - the GL account for each purpose
+// ============================================================================================================================
+func (t *SimpleChaincode) chart_of_accounts(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 0 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 0")
+	}
+	chart, err := getChart(stub)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(chart)
+}
+
+// ============================================================================================================================
+// Journal - the entries posted from one date to another, both included, with their totals by currency.
+// Given an entity, only the lines in its books are returned.
+// ============================================================================================================================
+func (t *SimpleChaincode) journal(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0				1			2
+	// "2026-10-01", "2026-10-31", *"V1"*
+	if len(args) < 2 || len(args) > 3 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting from date, to date and optional entity")
+	}
+	from, err := dateKey(args[0])
+	if err != nil {
+		return nil, atArgument(err, 1)
+	}
+	to, err := dateKey(args[1])
+	if err != nil {
+		return nil, atArgument(err, 2)
+	}
+	if to < from {
+		return nil, newError(CodeOutOfRange, "to", "Period ends on "+to+" before it starts on "+from)
+	}
+
+	report := Journal{}
+	report.From = from
+	report.To = to
+	if len(args) == 3 {
+		report.Entity = args[2]
+	}
+	report.Entries = []JournalEntry{}
+	totals := journalTotals{}
+
+	startKey := makeKey(journalType, from)
+	endKey := makeKey(journalType, to) + keySeparator + keyRangeEnd
+	err = scanRange(stub, startKey, endKey, func(key string, value []byte) error {
+		entry := JournalEntry{}
+		err := json.Unmarshal(value, &entry)
+		if err != nil {
+			return newError(CodeInternal, "", "Journal entry "+key+" is corrupt")
+		}
+		if report.Entity != "" {
+			var lines []Posting
+			for _, line := range entry.Lines {
+				if line.Entity == report.Entity {
+					lines = append(lines, line)
+				}
+			}
+			if len(lines) == 0 {
+				return nil
+			}
+			entry.Lines = lines
+		}
+		for _, line := range entry.Lines {
+			err := totals.add(line)
+			if err != nil {
+				return err
+			}
+		}
+		report.Entries = append(report.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Totals, report.Balanced = totals.sorted()
+	return json.Marshal(report)
+}
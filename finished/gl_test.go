@@ -0,0 +1,136 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// queryJournal - run the journal query and unmarshal its answer
+func queryJournal(t *testing.T, stub *mockStub, args ...string) Journal {
+	var journal Journal
+	res, err := stub.as(RoleAuditor, "AU1").mockQuery(new(SimpleChaincode), "journal", args...)
+	if err != nil {
+		t.Fatalf("journal %v: %v", args, err)
+	}
+	err = json.Unmarshal(res, &journal)
+	if err != nil {
+		t.Fatalf("journal %v: %v", args, err)
+	}
+	return journal
+}
+
+// balance - debits less credits of one GL account in the books of an entity
+func balance(journal Journal, entity string, account string) string {
+	sum := ZeroMoney("USD")
+	for _, entry := range journal.Entries {
+		for _, line := range entry.Lines {
+			if line.Entity == entity && line.Account == account {
+				sum, _ = sum.Add(line.Debit)
+				sum, _ = sum.Sub(line.Credit)
+			}
+		}
+	}
+	return sum.String()
+}
+
+func TestJournalPostings(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub)
+
+	//an invoice created as issued is posted in the books of both parties
+	journal := queryJournal(t, stub, "2026-10-01", "2026-10-31")
+	if len(journal.Entries) != 1 || len(journal.Entries[0].Lines) != 4 || journal.Entries[0].SourceID != invoiceKey("V1", "INV-1") {
+		t.Fatalf("journal after create_invoice %+v", journal.Entries)
+	}
+	if !journal.Balanced || len(journal.Totals) != 1 || journal.Totals[0].Debit.String() != "200.00" {
+		t.Errorf("totals %+v, want 200.00 of debits and credits", journal.Totals)
+	}
+	if got := balance(journal, "V1", "1200"); got != "100.00" {
+		t.Errorf("V1 receivable %s, want 100.00", got)
+	}
+	if got := balance(journal, "C1", "2000"); got != "-100.00" {
+		t.Errorf("C1 payable %s, want -100.00", got)
+	}
+
+	//a draft is posted when it is issued, and reversed when it is cancelled
+	draft := invoiceArgs("V1", "C1", "INV-2", "30.00", "steel", "4")
+	draft[9] = StatusDraft
+	mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", draft...)
+	if journal = queryJournal(t, stub, "2026-10-01", "2026-10-31"); len(journal.Entries) != 1 {
+		t.Errorf("draft invoice posted %d entries", len(journal.Entries)-1)
+	}
+	mustInvoke(t, stub, RoleVendor, "V1", "issue_invoice", invoiceKey("V1", "INV-2"))
+	mustInvoke(t, stub, RoleVendor, "V1", "cancel_invoice", invoiceKey("V1", "INV-2"), "wrong customer")
+	journal = queryJournal(t, stub, "2026-10-01", "2026-10-31")
+	if len(journal.Entries) != 3 || balance(journal, "V1", "4000") != "-100.00" {
+		t.Errorf("after issue and cancel %d entries, V1 revenue %s, want 3 and -100.00", len(journal.Entries), balance(journal, "V1", "4000"))
+	}
+
+	//settling a payment moves the receivable to cash on the payment date
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", "P1", "V1", "C1", invoiceKey("V1", "INV-1"), "40.00", "USD", "B1", "2026-11-02", "T1", "")
+	if journal = queryJournal(t, stub, "2026-11-01", "2026-11-30"); len(journal.Entries) != 0 {
+		t.Errorf("pending payment posted %+v", journal.Entries)
+	}
+	mustInvoke(t, stub, RoleBanker, "B1", "confirm_payment", "P1")
+	journal = queryJournal(t, stub, "2026-10-01", "2026-11-30", "V1")
+	if !journal.Balanced || balance(journal, "V1", "1200") != "60.00" || balance(journal, "V1", "1000") != "40.00" {
+		t.Errorf("V1 after payment: receivable %s cash %s", balance(journal, "V1", "1200"), balance(journal, "V1", "1000"))
+	}
+	for _, entry := range journal.Entries {
+		for _, line := range entry.Lines {
+			if line.Entity != "V1" {
+				t.Errorf("journal for V1 has a line of %s", line.Entity)
+			}
+		}
+	}
+	if last := journal.Entries[len(journal.Entries)-1]; last.Date != "2026-11-02" || last.Source != SourcePayment {
+		t.Errorf("payment entry %+v, want dated 2026-11-02", last)
+	}
+
+	if _, err := stub.mockQuery(new(SimpleChaincode), "journal", "2026-11-01", "2026-10-01"); errorOf(err).Code != CodeOutOfRange {
+		t.Errorf("period ending before it starts: %v", err)
+	}
+}
+
+func TestChartOfAccounts(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub)
+
+	runInvokeCases(t, "set_gl_account", setupLedger, []invokeCase{
+		{name: "admin", role: RoleAdmin, id: "A1", args: []string{GLRevenue, "4100", "Sales of goods"}},
+		{name: "vendor", role: RoleVendor, id: "V1", args: []string{GLRevenue, "4100", "Sales of goods"}, wantErr: "not allowed"},
+		{name: "unknown purpose", role: RoleAdmin, id: "A1", args: []string{"equity", "3000", "Equity"}, wantErr: "Unknown GL account purpose"},
+	})
+
+	mustInvoke(t, stub, RoleAdmin, "A1", "set_gl_account", GLRevenue, "4100", "Sales of goods")
+	res, err := stub.mockQuery(new(SimpleChaincode), "chart_of_accounts")
+	var chart ChartOfAccounts
+	if err != nil || json.Unmarshal(res, &chart) != nil || chart[GLRevenue].Code != "4100" || chart[GLCash].Code != "1000" {
+		t.Fatalf("chart of accounts %s (%v)", res, err)
+	}
+
+	mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", invoiceArgs("V1", "C1", "INV-2", "30.00", "steel", "4")...)
+	journal := queryJournal(t, stub, "2026-10-01", "2026-10-31")
+	if balance(journal, "V1", "4100") != "-30.00" || balance(journal, "V1", "4000") != "-100.00" {
+		t.Errorf("revenue after the chart changed: 4100 %s, 4000 %s", balance(journal, "V1", "4100"), balance(journal, "V1", "4000"))
+	}
+}
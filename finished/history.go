@@ -0,0 +1,174 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// The peer keeps no history of a key, so every write of a record also stores the new version under
+// "hist~<record key>~<tx timestamp>~<tx id>". A second write in the same transaction replaces the first.
+var historyPrefix = "hist"
+
+// HistoryEntry is one version of a record, as left by one transaction
+type HistoryEntry struct {
+	TxID          string          `json:"txid"`
+	Timestamp     int64           `json:"timestamp"` //transaction timestamp in ms
+	Caller        string          `json:"caller"`
+	Role          string          `json:"role,omitempty"`
+	Deleted       bool            `json:"deleted,omitempty"`       //the transaction removed the record
+	Value         json.RawMessage `json:"value,omitempty"`         //the record after the transaction
+	Changes       []FieldChange   `json:"changes,omitempty"`       //filled in by the history query
+	PreviousOwner string          `json:"previousowner,omitempty"` //set when an invoice changed hands
+	NewOwner      string          `json:"newowner,omitempty"`
+}
+
+// FieldChange is one top level field that differs between two versions of a record
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// RecordHistory is the answer of the history query, oldest version first
+type RecordHistory struct {
+	Key      string         `json:"key"`
+	Versions []HistoryEntry `json:"versions"`
+}
+
+// ============================================================================================================================
+// recordHistory - store the version of a record written by this transaction, nil for a deleted record
+// ============================================================================================================================
+func recordHistory(stub shim.ChaincodeStubInterface, recordKey string, valueAsBytes []byte) error {
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+
+	entry := HistoryEntry{}
+	entry.TxID = stub.GetTxID()
+	entry.Timestamp = timestamp
+	entry.Caller = getCaller(stub)
+	if caller, err := getIdentity(stub); err == nil {
+		entry.Role = caller.Role
+	}
+	entry.Deleted = valueAsBytes == nil
+	entry.Value = valueAsBytes
+
+	jsonAsBytes, _ := json.Marshal(&entry)
+	key := makeKey(historyPrefix, recordKey, fmt.Sprintf("%016d", timestamp), entry.TxID)
+	return stub.PutState(key, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// diffFields - the top level fields that differ between two JSON objects, in field name order
+// ============================================================================================================================
+func diffFields(before []byte, after []byte) []FieldChange {
+	old := map[string]interface{}{}
+	cur := map[string]interface{}{}
+	json.Unmarshal(before, &old) //un stringify it aka JSON.parse()
+	json.Unmarshal(after, &cur)
+
+	var names []string
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range cur {
+		if _, ok := old[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []FieldChange
+	for _, name := range names {
+		if !reflect.DeepEqual(old[name], cur[name]) {
+			changes = append(changes, FieldChange{name, old[name], cur[name]})
+		}
+	}
+	return changes
+}
+
+// ============================================================================================================================
+// History - every version of an invoice, account, payment or trade, with who changed what and when
+// ============================================================================================================================
+func (t *SimpleChaincode) history(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var recordKey string
+
+	//	0			1
+	// "invoice", "invoice~V1~INV-001"
+	// "account", "C1"
+	// "trade", "<tx id of open_trade>"
+	// "encumbrance", "<fingerprint>"
+	if len(args) != 2 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting record type and id")
+	}
+	switch args[0] {
+	case invoiceType:
+		if !isInvoiceKey(args[1]) {
+			return nil, argError(CodeInvalidArgument, 2, "Invoice id must look like invoice~vendor~number")
+		}
+		recordKey = args[1]
+	case accountType:
+		recordKey = accountKey(args[1])
+	case paymentType:
+		recordKey = paymentKey(args[1])
+	case tradeType:
+		recordKey = makeKey(tradeType, args[1])
+	case encumbranceType:
+		recordKey = encumbranceKey(args[1])
+	default:
+		return nil, argError(CodeInvalidArgument, 1, "Unknown record type \""+args[0]+"\", expecting invoice, account, payment, trade or encumbrance")
+	}
+
+	fmt.Println("- start history of " + recordKey)
+	report := RecordHistory{Key: recordKey, Versions: []HistoryEntry{}}
+	var previous []byte
+	err := scanPrefix(stub, makeKey(historyPrefix, recordKey)+keySeparator, func(key string, value []byte) error {
+		entry := HistoryEntry{}
+		err := json.Unmarshal(value, &entry)
+		if err != nil {
+			return newError(CodeInternal, "", "History entry "+key+" is corrupt")
+		}
+		entry.Changes = diffFields(previous, entry.Value)
+		if args[0] == invoiceType {
+			for _, change := range entry.Changes {
+				if change.Field == "owner" {
+					entry.PreviousOwner, _ = change.From.(string)
+					entry.NewOwner, _ = change.To.(string)
+				}
+			}
+		}
+		previous = entry.Value
+		report.Versions = append(report.Versions, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end history")
+	return json.Marshal(&report)
+}
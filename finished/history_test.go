@@ -0,0 +1,94 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// queryHistory - run the history query and unmarshal its answer
+func queryHistory(t *testing.T, stub *mockStub, args ...string) RecordHistory {
+	var report RecordHistory
+	res, err := stub.as(RoleAuditor, "AU1").mockQuery(new(SimpleChaincode), "history", args...)
+	if err != nil {
+		t.Fatalf("history %v: %v", args, err)
+	}
+	err = json.Unmarshal(res, &report)
+	if err != nil {
+		t.Fatalf("history %v: %v", args, err)
+	}
+	return report
+}
+
+func TestHistory(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub)
+	created := stub.txID
+	mustInvoke(t, stub, RoleVendor, "V1", "set_user", invoiceKey("V1", "INV-1"), "F1")
+	if _, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "issue_invoice", invoiceKey("V1", "INV-1")); err == nil {
+		t.Fatalf("issuing an issued invoice succeeded") //rejected, so nothing is recorded
+	}
+	mustInvoke(t, stub, RoleCustomer, "C1", "acknowledge_invoice", invoiceKey("V1", "INV-1"))
+
+	report := queryHistory(t, stub, "invoice", invoiceKey("V1", "INV-1"))
+	if len(report.Versions) != 3 {
+		t.Fatalf("invoice has %d versions, want 3", len(report.Versions))
+	}
+	first, moved, acked := report.Versions[0], report.Versions[1], report.Versions[2]
+	if first.TxID != created || first.Caller != "V1" || first.Role != RoleVendor {
+		t.Errorf("created by %s as %s in %s, want V1 as vendor in %s", first.Caller, first.Role, first.TxID, created)
+	}
+	if moved.PreviousOwner != "V1" || moved.NewOwner != "F1" {
+		t.Errorf("set_user moved the invoice from %q to %q, want V1 to F1", moved.PreviousOwner, moved.NewOwner)
+	}
+	if len(moved.Changes) != 2 || moved.Changes[0].Field != "captable" || moved.Changes[1].Field != "owner" {
+		t.Errorf("set_user changed %+v, want the cap table and the owner", moved.Changes)
+	}
+	if acked.Timestamp <= moved.Timestamp || acked.Caller != "C1" || acked.PreviousOwner != "" {
+		t.Errorf("acknowledge entry %+v", acked)
+	}
+	fields := map[string]bool{}
+	for _, change := range acked.Changes {
+		fields[change.Field] = true
+	}
+	if !fields["status"] || !fields["statushistory"] || len(fields) != 2 {
+		t.Errorf("acknowledge changed %v, want status and statushistory", fields)
+	}
+
+	//trades are recorded when opened and when they close
+	mustInvoke(t, stub, RoleFinancier, "F1", "open_trade", invoiceKey("V1", "INV-1"), "2.5")
+	id := readTrades(t, stub).OpenTrades[0].ID
+	mustInvoke(t, stub, RoleFinancier, "F1", "remove_trade", id)
+	report = queryHistory(t, stub, "trade", id)
+	if len(report.Versions) != 2 || report.Versions[0].Deleted || !report.Versions[1].Deleted {
+		t.Errorf("trade history %+v, want opened then deleted", report.Versions)
+	}
+
+	if report = queryHistory(t, stub, "account", "C1"); len(report.Versions) != 1 {
+		t.Errorf("account has %d versions, want 1", len(report.Versions))
+	}
+	if report = queryHistory(t, stub, "payment", "P404"); len(report.Versions) != 0 {
+		t.Errorf("unknown payment has %d versions", len(report.Versions))
+	}
+	if _, err := stub.mockQuery(new(SimpleChaincode), "history", "marble", "m1"); !errorMatches(err, "Unknown record type") {
+		t.Errorf("unknown record type: got error %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Secondary indexes are one key per entry, "idx~<type>~<index>~<value>~<primary key attrs>", holding the primary key.
+// Listing by vendor needs no index, invoice keys already start with the vendor: "invoice~<vendor>~<number>".
+var indexPrefix = "idx"
+
+// names of the secondary indexes
+const (
+	byCustomer = "customer"
+	byVendor   = "vendor"
+	byStatus   = "status"
+	byDueDate  = "due"
+	byBanker   = "banker"
+	byDate     = "date"   //payments by payment date
+	byAmount   = "amount" //invoices and payments by amount, see amountKey
+)
+
+// amounts in the amount index are written with amountKeyScale decimal places and amountKeyWidth digits, enough for
+// any Money, which has at most 18 digits
+const (
+	amountKeyScale = 18
+	amountKeyWidth = 40
+)
+
+// keyRangeEnd is appended to a prefix to get the end of a range scan over every key under it
+var keyRangeEnd = "\xff"
+
+// ============================================================================================================================
+// indexKey - the key of one secondary index entry
+// ============================================================================================================================
+func indexKey(objectType string, index string, value string, primary ...string) string {
+	return makeKey(indexPrefix, append([]string{objectType, index, value}, primary...)...)
+}
+
+// ============================================================================================================================
+// invoiceIndexKeys - every secondary index entry an invoice should have
+// ============================================================================================================================
+func invoiceIndexKeys(inv Invoice) []string {
+	keys := []string{
+		indexKey(invoiceType, byCustomer, inv.CustomerID, inv.VendorID, inv.InvoiceNumber),
+		indexKey(invoiceType, byStatus, inv.Status, inv.VendorID, inv.InvoiceNumber),
+	}
+	if day, err := dateKey(inv.PaymentDate); err == nil { //the payment date is when the invoice falls due
+		keys = append(keys, indexKey(invoiceType, byDueDate, day, inv.VendorID, inv.InvoiceNumber))
+	}
+	return append(keys, indexKey(invoiceType, byAmount, amountKey(inv.InvoiceAmount), inv.VendorID, inv.InvoiceNumber))
+}
+
+// accountIndexKeys - every secondary index entry an account should have
+func accountIndexKeys(account Account) []string {
+	return []string{indexKey(accountType, byBanker, account.BankerID, account.ID)}
+}
+
+// paymentIndexKeys - every secondary index entry a payment should have
+func paymentIndexKeys(payment Payment) []string {
+	keys := []string{
+		indexKey(paymentType, byVendor, payment.VendorID, payment.PaymentID),
+		indexKey(paymentType, byCustomer, payment.CustomerID, payment.PaymentID),
+	}
+	if day, err := dateKey(payment.PaymentDate); err == nil {
+		keys = append(keys, indexKey(paymentType, byDate, day, payment.PaymentID))
+	}
+	return append(keys, indexKey(paymentType, byAmount, amountKey(payment.Amount), payment.PaymentID))
+}
+
+// ============================================================================================================================
+// amountKey - an amount as a fixed width string that sorts the way amounts compare, whatever their scale.
+// "p" and the digits for zero and up, "n" and the digits of 10^amountKeyWidth less the magnitude below zero.
+// ============================================================================================================================
+func amountKey(m Money) string {
+	v := big.NewInt(m.minor)
+	v.Mul(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(amountKeyScale-m.scale)), nil))
+	sign := "p"
+	if v.Sign() < 0 {
+		sign = "n"
+		v.Add(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(amountKeyWidth), nil))
+	}
+	digits := v.String()
+	return sign + strings.Repeat("0", amountKeyWidth-len(digits)) + digits
+}
+
+// ============================================================================================================================
+// updateIndexes - remove index entries a record no longer has and add the ones it gained
+// ============================================================================================================================
+func updateIndexes(stub shim.ChaincodeStubInterface, oldKeys []string, newKeys []string, primaryKey string) error {
+	for _, old := range oldKeys {
+		if !containsKey(newKeys, old) {
+			err := stub.DelState(old)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range newKeys {
+		if !containsKey(oldKeys, key) {
+			err := stub.PutState(key, []byte(primaryKey))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// scanRange - call fn for every key from startKey to endKey, in key order
+// ============================================================================================================================
+func scanRange(stub shim.ChaincodeStubInterface, startKey string, endKey string, fn func(key string, value []byte) error) error {
+	iter, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return newError(CodeInternal, "", "Failed to scan "+startKey+" to "+endKey)
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		key, value, err := iter.Next()
+		if err != nil {
+			return newError(CodeInternal, "", "Failed to scan "+startKey+" to "+endKey)
+		}
+		err = fn(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// scanPrefix - call fn for every key that starts with prefix, in key order
+// ============================================================================================================================
+func scanPrefix(stub shim.ChaincodeStubInterface, prefix string, fn func(key string, value []byte) error) error {
+	return scanRange(stub, prefix, prefix+keyRangeEnd, fn)
+}
+
+// ============================================================================================================================
+// indexedKeys - the primary keys of the entries of an index with exactly a value, "C1" does not match "C10" or "C1-A"
+// ============================================================================================================================
+func indexedKeys(stub shim.ChaincodeStubInterface, objectType string, index string, value string) ([]string, error) {
+	var keys []string
+	err := scanPrefix(stub, makeKey(indexPrefix, objectType, index, value)+keySeparator, func(key string, primary []byte) error {
+		keys = append(keys, string(primary))
+		return nil
+	})
+	return keys, err
+}
+
+// ============================================================================================================================
+// indexedKeysBetween - the primary keys of the entries of an index between two values, both inclusive. Only for
+// values of one length, such as dates, that sort the way they compare.
+// ============================================================================================================================
+func indexedKeysBetween(stub shim.ChaincodeStubInterface, objectType string, index string, from string, to string) ([]string, error) {
+	var keys []string
+	startKey := makeKey(indexPrefix, objectType, index, from)
+	endKey := makeKey(indexPrefix, objectType, index, to) + keySeparator + keyRangeEnd
+	err := scanRange(stub, startKey, endKey, func(key string, value []byte) error {
+		keys = append(keys, string(value))
+		return nil
+	})
+	return keys, err
+}
+
+// ============================================================================================================================
+// invoiceKeysBy - keys of the invoices with a given vendor, customer or status, or due between two dates
+// ============================================================================================================================
+func invoiceKeysBy(stub shim.ChaincodeStubInterface, index string, from string, to string) ([]string, error) {
+	switch index {
+	case byVendor:
+		var keys []string
+		prefix := invoiceType + keySeparator //every invoice
+		if from != "" {
+			prefix = makeKey(invoiceType, from) + keySeparator
+		}
+		err := scanPrefix(stub, prefix, func(key string, value []byte) error {
+			keys = append(keys, key)
+			return nil
+		})
+		return keys, err
+	case byCustomer, byStatus:
+		return indexedKeys(stub, invoiceType, index, from)
+	case byDueDate:
+		fromDay, err := dateKey(from)
+		if err != nil {
+			return nil, atArgument(err, 2)
+		}
+		toDay, err := dateKey(to)
+		if err != nil {
+			return nil, atArgument(err, 3)
+		}
+		return indexedKeysBetween(stub, invoiceType, byDueDate, fromDay, toDay)
+	}
+	return nil, argError(CodeInvalidArgument, 1, "Unknown invoice index \""+index+"\", expecting vendor, customer, status or due")
+}
+
+// ============================================================================================================================
+// Invoices By - list the invoices of a vendor, a customer, a status, or due between two dates
+// ============================================================================================================================
+func (t *SimpleChaincode) invoices_by(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0			1			2
+	// "vendor", "V1"
+	// "due", "2026-10-01", "2026-10-31"
+	if len(args) < 2 || len(args) > 3 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting index, value and optional end value")
+	}
+	to := args[1]
+	if len(args) == 3 {
+		to = args[2]
+	}
+
+	fmt.Println("- start invoices by " + args[0])
+	keys, err := invoiceKeysBy(stub, args[0], args[1], to)
+	if err != nil {
+		return nil, err
+	}
+	invoices := []Invoice{}
+	for _, key := range keys {
+		inv, err := getInvoice(stub, key)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, inv)
+	}
+
+	fmt.Println("- end invoices by")
+	return json.Marshal(invoices)
+}
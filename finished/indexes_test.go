@@ -0,0 +1,94 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// queryInvoicesBy - the numbers of the invoices invoices_by returns, in key order
+func queryInvoicesBy(t *testing.T, stub *mockStub, args ...string) []string {
+	var invoices []Invoice
+	res, err := stub.as(RoleAuditor, "AU1").mockQuery(new(SimpleChaincode), "invoices_by", args...)
+	if err != nil {
+		t.Fatalf("invoices_by %v: %v", args, err)
+	}
+	err = json.Unmarshal(res, &invoices)
+	if err != nil {
+		t.Fatalf("invoices_by %v: %v", args, err)
+	}
+	numbers := []string{}
+	for _, inv := range invoices {
+		numbers = append(numbers, inv.InvoiceNumber)
+	}
+	return numbers
+}
+
+func TestInvoicesByExactValue(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub)
+	mustInvoke(t, stub, RoleBanker, "B1", "create_account", "C10", "Customer Ten", "customer", "10 Main St", "12345", "555-0110", "B1")
+	mustInvoke(t, stub, RoleBanker, "B1", "create_account", "C1-A", "Customer One A", "customer", "1A Main St", "12345", "555-0111", "B1")
+	mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", invoiceArgs("V1", "C10", "INV-2", "20.00", "steel", "4")...)
+	mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", invoiceArgs("V1", "C1-A", "INV-3", "30.00", "steel", "6")...)
+	mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", invoiceArgs("V1", "C1", "INV-4", "40.00", "steel", "8")...)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{byCustomer, "C1"}, "[INV-1 INV-4]"},
+		{[]string{byCustomer, "C10"}, "[INV-2]"},
+		{[]string{byCustomer, "C1-A"}, "[INV-3]"},
+		{[]string{byCustomer, "C"}, "[]"},
+		{[]string{byStatus, StatusIssued}, "[INV-1 INV-2 INV-3 INV-4]"},
+		{[]string{byDueDate, "2026-11-01", "2026-11-01"}, "[INV-1 INV-2 INV-3 INV-4]"},
+		{[]string{byDueDate, "2026-10-01", "2026-10-31"}, "[]"},
+	}
+	for _, tc := range cases {
+		got := queryInvoicesBy(t, stub, tc.args...)
+		if fmt.Sprint(got) != tc.want {
+			t.Errorf("invoices_by %v: got %v, want %s", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestAmountKeyOrder(t *testing.T) {
+	amounts := []string{"-999999999999999999", "-5.5", "-0.01", "-0.001", "0", "0.001", "0.01", "1", "10.00", "999999999999999999"}
+	previous := ""
+	for _, amount := range amounts {
+		m, err := parseDecimal(amount)
+		if err != nil {
+			t.Fatalf("%s: %v", amount, err)
+		}
+		key := amountKey(m)
+		if len(key) != amountKeyWidth+1 || key <= previous {
+			t.Errorf("%s: key %q does not sort after %q", amount, key, previous)
+		}
+		previous = key
+	}
+	a, _ := parseDecimal("1.5")
+	b, _ := parseDecimal("1.500")
+	if amountKey(a) != amountKey(b) {
+		t.Errorf("1.5 and 1.500 have different keys %q and %q", amountKey(a), amountKey(b))
+	}
+}
@@ -0,0 +1,290 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// invoice lifecycle states, stored in Invoice.Status
+const (
+	StatusDraft         = "draft"
+	StatusIssued        = "issued"
+	StatusAcknowledged  = "acknowledged"
+	StatusPartiallyPaid = "partially_paid"
+	StatusPaid          = "paid"
+	StatusClosed        = "closed"
+	StatusDisputed      = "disputed"
+	StatusCancelled     = "cancelled"
+)
+
+// invoiceTransitions lists, for each status, the statuses an invoice may move to next
+var invoiceTransitions = map[string][]string{
+	StatusDraft:         {StatusIssued, StatusCancelled},
+	StatusIssued:        {StatusAcknowledged, StatusPartiallyPaid, StatusPaid, StatusDisputed, StatusCancelled},
+	StatusAcknowledged:  {StatusPartiallyPaid, StatusPaid, StatusDisputed},
+	StatusPartiallyPaid: {StatusPaid, StatusDisputed},
+	StatusPaid:          {StatusClosed},
+	StatusDisputed:      {StatusIssued, StatusAcknowledged, StatusPartiallyPaid, StatusCancelled},
+	StatusClosed:        {},
+	StatusCancelled:     {},
+}
+
+// StatusChange records a single lifecycle transition of an invoice
+type StatusChange struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	By        string `json:"by"`        //caller that made the transition
+	Timestamp int64  `json:"timestamp"` //ms since epoch
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ============================================================================================================================
+// canTransition - true if an invoice in status "from" may move to status "to"
+// ============================================================================================================================
+func canTransition(from string, to string) bool {
+	for _, next := range invoiceTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// Get Invoice - read an invoice from chaincode state, the id is its key "invoice~<vendor>~<number>"
+// ============================================================================================================================
+func getInvoice(stub shim.ChaincodeStubInterface, id string) (Invoice, error) {
+	var inv Invoice
+	if !isInvoiceKey(id) {
+		return inv, newError(CodeInvalidArgument, "", "\""+id+"\" is not an invoice id, expecting "+invoiceKey("<vendor>", "<number>"))
+	}
+	invoiceAsBytes, err := stub.GetState(id)
+	if err != nil {
+		return inv, newError(CodeInternal, "", "Failed to get invoice "+id)
+	}
+	if invoiceAsBytes == nil {
+		return inv, newError(CodeNotFound, "", "Invoice does not exist: "+id)
+	}
+	err = json.Unmarshal(invoiceAsBytes, &inv) //un stringify it aka JSON.parse()
+	if err != nil {
+		return inv, newError(CodeInternal, "", "Invoice "+id+" is corrupt")
+	}
+	return inv, nil
+}
+
+// ============================================================================================================================
+// Put Invoice - write an invoice to chaincode state and bring its secondary indexes up to date
+// ============================================================================================================================
+func putInvoice(stub shim.ChaincodeStubInterface, inv Invoice) error {
+	key := invoiceKey(inv.VendorID, inv.InvoiceNumber)
+	var oldIndexKeys []string
+	oldAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return newError(CodeInternal, "", "Failed to get invoice "+key)
+	}
+	if oldAsBytes != nil {
+		old := Invoice{}
+		json.Unmarshal(oldAsBytes, &old) //un stringify it aka JSON.parse()
+		oldIndexKeys = invoiceIndexKeys(old)
+	}
+
+	jsonAsBytes, _ := json.Marshal(inv)
+	err = stub.PutState(key, jsonAsBytes) //rewrite the invoice under its key
+	if err != nil {
+		return err
+	}
+	err = recordHistory(stub, key, jsonAsBytes)
+	if err != nil {
+		return err
+	}
+	return updateIndexes(stub, oldIndexKeys, invoiceIndexKeys(inv), key)
+}
+
+// ============================================================================================================================
+// setInvoiceStatus - move an invoice to a new status if the lifecycle allows it, recording who did it and when
+// ============================================================================================================================
+func setInvoiceStatus(stub shim.ChaincodeStubInterface, inv *Invoice, to string, reason string) error {
+	if !canTransition(inv.Status, to) {
+		return newError(CodeRejected, "", "Invoice "+inv.InvoiceNumber+" cannot move from \""+inv.Status+"\" to \""+to+"\"")
+	}
+
+	timestamp, err := txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+
+	change := StatusChange{}
+	change.From = inv.Status
+	change.To = to
+	change.By = getCaller(stub)
+	change.Timestamp = timestamp
+	change.Reason = reason
+
+	inv.Status = to
+	inv.StatusHistory = append(inv.StatusHistory, change)
+	fmt.Println("! invoice " + inv.InvoiceNumber + " " + change.From + " -> " + change.To + " by " + change.By)
+	return nil
+}
+
+// statusEvent - the event for the latest status change of an invoice
+func statusEvent(inv Invoice) Event {
+	change := inv.StatusHistory[len(inv.StatusHistory)-1]
+	return Event{Name: EventInvoiceStatus, InvoiceID: invoiceKey(inv.VendorID, inv.InvoiceNumber), PreviousStatus: change.From, NewStatus: change.To}
+}
+
+// ============================================================================================================================
+// transition_invoice - shared body of the lifecycle invoke functions
+// ============================================================================================================================
+func (t *SimpleChaincode) transition_invoice(stub shim.ChaincodeStubInterface, args []string, to string) ([]byte, error) {
+	var reason string
+
+	//	0		1
+	// "id", *"reason"*
+	if len(args) < 1 || len(args) > 2 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting invoice id and optional reason")
+	}
+	if len(args[0]) <= 0 {
+		return nil, argError(CodeRequired, 1, "1st argument must be a non-empty string")
+	}
+	if len(args) == 2 {
+		reason = args[1]
+	}
+
+	fmt.Println("- start invoice transition to " + to)
+	inv, err := getInvoice(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	err = checkParty(stub, inv)
+	if err != nil {
+		return nil, err
+	}
+	if to == StatusCancelled && percentOf(inv, inv.VendorID).Cmp(hundredPercent()) != 0 { //the other holders have the right to collect it
+		return nil, newError(CodeRejected, "invoiceid", "Invoice "+inv.InvoiceNumber+" is held by "+holderNames(inv)+" and cannot be cancelled")
+	}
+	err = setInvoiceStatus(stub, &inv, to, reason)
+	if err != nil {
+		return nil, err
+	}
+	err = putInvoice(stub, inv)
+	if err != nil {
+		return nil, err
+	}
+	err = postStatusChange(stub, inv)
+	if err != nil {
+		return nil, err
+	}
+	emitEvent(stub, statusEvent(inv))
+
+	fmt.Println("- end invoice transition")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Issue Invoice - send a draft invoice to the customer
+// ============================================================================================================================
+func (t *SimpleChaincode) issue_invoice(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.transition_invoice(stub, args, StatusIssued)
+}
+
+// ============================================================================================================================
+// Acknowledge Invoice - customer confirms receipt of an issued invoice
+// ============================================================================================================================
+func (t *SimpleChaincode) acknowledge_invoice(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.transition_invoice(stub, args, StatusAcknowledged)
+}
+
+// ============================================================================================================================
+// Close Invoice - archive a paid invoice, no further changes allowed
+// ============================================================================================================================
+func (t *SimpleChaincode) close_invoice(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.transition_invoice(stub, args, StatusClosed)
+}
+
+// ============================================================================================================================
+// Cancel Invoice - void an invoice that has not been paid
+// ============================================================================================================================
+func (t *SimpleChaincode) cancel_invoice(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.transition_invoice(stub, args, StatusCancelled)
+}
+
+// ============================================================================================================================
+// Dispute Invoice - put an open invoice on hold, a reason is recommended
+// ============================================================================================================================
+func (t *SimpleChaincode) dispute_invoice(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.transition_invoice(stub, args, StatusDisputed)
+}
+
+// ============================================================================================================================
+// Resolve Dispute - return a disputed invoice to the status it had before the dispute
+// ============================================================================================================================
+func (t *SimpleChaincode) resolve_dispute(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var reason string
+
+	//	0		1
+	// "id", *"reason"*
+	if len(args) < 1 || len(args) > 2 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting invoice id and optional reason")
+	}
+	if len(args) == 2 {
+		reason = args[1]
+	}
+
+	fmt.Println("- start resolve dispute")
+	inv, err := getInvoice(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	err = checkParty(stub, inv)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Status != StatusDisputed {
+		return nil, newError(CodeRejected, "invoiceid", "Invoice "+inv.InvoiceNumber+" is not disputed")
+	}
+
+	previous := ""
+	for i := len(inv.StatusHistory) - 1; i >= 0; i-- { //find the most recent move into dispute
+		if inv.StatusHistory[i].To == StatusDisputed {
+			previous = inv.StatusHistory[i].From
+			break
+		}
+	}
+	if previous == "" {
+		return nil, newError(CodeInternal, "", "Invoice "+inv.InvoiceNumber+" has no record of entering dispute")
+	}
+
+	err = setInvoiceStatus(stub, &inv, previous, reason)
+	if err != nil {
+		return nil, err
+	}
+	err = putInvoice(stub, inv)
+	if err != nil {
+		return nil, err
+	}
+	emitEvent(stub, statusEvent(inv))
+
+	fmt.Println("- end resolve dispute")
+	return nil, nil
+}
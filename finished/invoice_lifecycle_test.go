@@ -0,0 +1,150 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+// payInvoice - C1 pays an amount of INV-1 and B1 confirms it
+func payInvoice(t *testing.T, stub *mockStub, amount string) {
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", paymentArgs("P1", amount, "2026-10-02")...)
+	mustInvoke(t, stub, RoleBanker, "B1", "confirm_payment", "P1")
+}
+
+// lifecycleSetups - for each status, how to bring an invoice of setupLedger into it, returning the invoice id
+var lifecycleSetups = map[string]func(t *testing.T, stub *mockStub) string{
+	StatusDraft: func(t *testing.T, stub *mockStub) string {
+		mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", append(invoiceArgs("V1", "C1", "INV-D", "10.00", "tin", "1")[:9], StatusDraft, "2026-11-01")...)
+		return invoiceKey("V1", "INV-D")
+	},
+	StatusIssued: func(t *testing.T, stub *mockStub) string {
+		return invoiceKey("V1", "INV-1")
+	},
+	StatusAcknowledged: func(t *testing.T, stub *mockStub) string {
+		mustInvoke(t, stub, RoleCustomer, "C1", "acknowledge_invoice", invoiceKey("V1", "INV-1"))
+		return invoiceKey("V1", "INV-1")
+	},
+	StatusPartiallyPaid: func(t *testing.T, stub *mockStub) string {
+		payInvoice(t, stub, "40.00")
+		return invoiceKey("V1", "INV-1")
+	},
+	StatusPaid: func(t *testing.T, stub *mockStub) string {
+		payInvoice(t, stub, "100.00")
+		return invoiceKey("V1", "INV-1")
+	},
+	StatusClosed: func(t *testing.T, stub *mockStub) string {
+		payInvoice(t, stub, "100.00")
+		mustInvoke(t, stub, RoleVendor, "V1", "close_invoice", invoiceKey("V1", "INV-1"))
+		return invoiceKey("V1", "INV-1")
+	},
+	StatusDisputed: func(t *testing.T, stub *mockStub) string {
+		mustInvoke(t, stub, RoleCustomer, "C1", "dispute_invoice", invoiceKey("V1", "INV-1"), "short delivery")
+		return invoiceKey("V1", "INV-1")
+	},
+	StatusCancelled: func(t *testing.T, stub *mockStub) string {
+		mustInvoke(t, stub, RoleVendor, "V1", "cancel_invoice", invoiceKey("V1", "INV-1"))
+		return invoiceKey("V1", "INV-1")
+	},
+}
+
+func TestInvoiceTransitions(t *testing.T) {
+	functions := map[string]string{ //the status each lifecycle function moves an invoice to
+		"issue_invoice":       StatusIssued,
+		"acknowledge_invoice": StatusAcknowledged,
+		"close_invoice":       StatusClosed,
+		"dispute_invoice":     StatusDisputed,
+		"cancel_invoice":      StatusCancelled,
+	}
+	for from, setup := range lifecycleSetups {
+		for function, to := range functions {
+			stub := newMockStub()
+			setupLedger(t, stub)
+			id := setup(t, stub)
+			var inv Invoice
+			if readJSON(t, stub, id, &inv); inv.Status != from {
+				t.Fatalf("setup for %s left the invoice %s", from, inv.Status)
+			}
+			_, err := stub.as(RoleAdmin, "A1").mockInvoke(new(SimpleChaincode), function, id)
+			if canTransition(from, to) {
+				if err != nil {
+					t.Errorf("%s from %s: %v", function, from, err)
+				}
+				continue
+			}
+			if !errorMatches(err, "cannot move from \""+from+"\" to \""+to+"\"") {
+				t.Errorf("%s from %s: got %v, want the transition refused", function, from, err)
+			}
+		}
+	}
+}
+
+func TestResolveDispute(t *testing.T) {
+	for _, from := range []string{StatusIssued, StatusAcknowledged, StatusPartiallyPaid} {
+		stub := newMockStub()
+		setupLedger(t, stub)
+		id := lifecycleSetups[from](t, stub)
+		mustInvoke(t, stub, RoleCustomer, "C1", "dispute_invoice", id, "short delivery")
+		mustInvoke(t, stub, RoleVendor, "V1", "resolve_dispute", id, "credit note sent")
+
+		inv := readInvoice(t, stub, "V1", "INV-1")
+		if inv.Status != from {
+			t.Errorf("resolved dispute of a %s invoice: status %s, want %s", from, inv.Status, from)
+		}
+		last := inv.StatusHistory[len(inv.StatusHistory)-1]
+		if last.From != StatusDisputed || last.To != from || last.By != "V1" || last.Reason != "credit note sent" {
+			t.Errorf("resolved dispute of a %s invoice: recorded %+v", from, last)
+		}
+	}
+
+	runInvokeCases(t, "resolve_dispute", setupLedger, []invokeCase{
+		{name: "not disputed", role: RoleVendor, id: "V1", args: []string{invoiceKey("V1", "INV-1")}, wantErr: "is not disputed"},
+		{name: "unknown invoice", role: RoleVendor, id: "V1", args: []string{invoiceKey("V1", "INV-404")}, wantErr: "does not exist"},
+		{name: "wrong argument count", role: RoleVendor, id: "V1", args: []string{}, wantErr: "Expecting invoice id"},
+	})
+	runInvokeCases(t, "resolve_dispute", func(t *testing.T, stub *mockStub) {
+		setupLedger(t, stub)
+		lifecycleSetups[StatusDisputed](t, stub)
+	}, []invokeCase{
+		{name: "by the customer", role: RoleCustomer, id: "C1", args: []string{invoiceKey("V1", "INV-1")}},
+		{name: "by another vendor", role: RoleVendor, id: "V2", args: []string{invoiceKey("V1", "INV-1")}, wantErr: "not the vendor"},
+		{name: "twice", role: RoleVendor, id: "V1", args: []string{invoiceKey("V1", "INV-1")}, check: func(t *testing.T, stub *mockStub) {
+			_, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "resolve_dispute", invoiceKey("V1", "INV-1"))
+			if !errorMatches(err, "is not disputed") {
+				t.Errorf("resolved twice: got %v", err)
+			}
+		}},
+	})
+}
+
+func TestDisputeAgain(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub)
+	id := lifecycleSetups[StatusAcknowledged](t, stub)
+	mustInvoke(t, stub, RoleCustomer, "C1", "dispute_invoice", id, "short delivery")
+	mustInvoke(t, stub, RoleVendor, "V1", "resolve_dispute", id)
+	payInvoice(t, stub, "40.00")
+	mustInvoke(t, stub, RoleCustomer, "C1", "dispute_invoice", id, "damaged goods")
+	mustInvoke(t, stub, RoleVendor, "V1", "resolve_dispute", id)
+
+	if inv := readInvoice(t, stub, "V1", "INV-1"); inv.Status != StatusPartiallyPaid {
+		t.Errorf("second dispute resolved to %s, want the status before it, %s", inv.Status, StatusPartiallyPaid)
+	}
+}
@@ -0,0 +1,308 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// every record is stored under "<type>~<attr>~<attr>...", so records of different types can never share a key
+var keySeparator = "~"
+
+// record types, the first part of every composite key
+const (
+	invoiceType = "invoice"
+	accountType = "account"
+	paymentType = "payment"
+	tradeType   = "trade" //only used for history, open trades live together under openTradesStr
+	journalType = "journal"
+	periodType  = "period"
+
+	encumbranceType = "encumbrance" //registry of financed invoices, keyed by fingerprint
+	closedTradeType = "closedtrade" //orders that left the book, keyed by when they closed
+	fxRateType      = "fxrate"      //exchange rates, keyed by currency pair and effective date
+)
+
+// ============================================================================================================================
+// makeKey - join a record type and its identifying attributes into a composite key
+// ============================================================================================================================
+func makeKey(objectType string, attributes ...string) string {
+	return objectType + keySeparator + strings.Join(attributes, keySeparator)
+}
+
+// ============================================================================================================================
+// splitKey - the record type and attributes of a composite key
+// ============================================================================================================================
+func splitKey(key string) (string, []string) {
+	parts := strings.Split(key, keySeparator)
+	return parts[0], parts[1:]
+}
+
+// ============================================================================================================================
+// checkKeyPart - an attribute used in a key must be non-empty and must not contain the separator
+// ============================================================================================================================
+func checkKeyPart(name string, value string) error {
+	if len(value) == 0 {
+		return newError(CodeRequired, "", name+" must be a non-empty string")
+	}
+	if strings.Contains(value, keySeparator) {
+		return newError(CodeInvalidArgument, "", name+" must not contain \""+keySeparator+"\"")
+	}
+	return nil
+}
+
+// invoiceKey - invoice numbers are unique per vendor, so an invoice is keyed by both
+func invoiceKey(vendorID string, invoiceNumber string) string {
+	return makeKey(invoiceType, vendorID, invoiceNumber)
+}
+
+// accountKey - an account is keyed by its id
+func accountKey(id string) string {
+	return makeKey(accountType, id)
+}
+
+// paymentKey - a payment is keyed by its id
+func paymentKey(id string) string {
+	return makeKey(paymentType, id)
+}
+
+// isInvoiceKey - true if the key is in the invoice namespace
+func isInvoiceKey(key string) bool {
+	objectType, attributes := splitKey(key)
+	return objectType == invoiceType && len(attributes) == 2
+}
+
+// ============================================================================================================================
+// Migrate Keys - one-off move of invoices, accounts, payments and exchange rates from their bare ids and JSON arrays
+// to namespaced keys
+// ============================================================================================================================
+func (t *SimpleChaincode) migrate_keys(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 0 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 0")
+	}
+	fmt.Println("- start migrate keys")
+
+	//invoices were stored under their vendor id, remember where each one went so payments can follow
+	invoiceKeys := map[string]string{}
+	invoiceIndex, err := getIndex(stub, invoiceIndexStr)
+	if err != nil {
+		return nil, err
+	}
+	var migrated []Invoice
+	for _, oldKey := range invoiceIndex {
+		invoiceAsBytes, err := stub.GetState(oldKey)
+		if err != nil {
+			return nil, newError(CodeInternal, "", "Failed to get "+oldKey)
+		}
+		inv := Invoice{}
+		json.Unmarshal(invoiceAsBytes, &inv) //un stringify it aka JSON.parse()
+		if inv.InvoiceNumber == "" {
+			fmt.Println("! " + oldKey + " does not hold an invoice, skipping")
+			continue
+		}
+		if checkKeyPart("vendor id", inv.VendorID) != nil || checkKeyPart("customer id", inv.CustomerID) != nil || checkKeyPart("invoice number", inv.InvoiceNumber) != nil {
+			return nil, newError(CodeRejected, "", "Invoice "+inv.InvoiceNumber+" of vendor "+inv.VendorID+" cannot be keyed, fix it first")
+		}
+		invoiceKeys[oldKey] = invoiceKey(inv.VendorID, inv.InvoiceNumber)
+		err = stub.DelState(oldKey)
+		if err != nil {
+			return nil, err
+		}
+		migrated = append(migrated, inv)
+	}
+
+	//accounts were stored under their id
+	accountIndex, err := getIndex(stub, accountIndexStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, oldKey := range accountIndex {
+		accountAsBytes, err := stub.GetState(oldKey)
+		if err != nil {
+			return nil, newError(CodeInternal, "", "Failed to get "+oldKey)
+		}
+		account := Account{}
+		json.Unmarshal(accountAsBytes, &account) //un stringify it aka JSON.parse()
+		if account.ID == "" {
+			fmt.Println("! " + oldKey + " does not hold an account, skipping")
+			continue
+		}
+		err = stub.DelState(oldKey)
+		if err != nil {
+			return nil, err
+		}
+		err = putAccount(stub, account)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("! moved account " + oldKey + " -> " + accountKey(account.ID))
+	}
+
+	//payments were stored under their id, and point at invoices by their old keys
+	paymentIndex, err := getIndex(stub, paymentIndexStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, oldKey := range paymentIndex {
+		paymentAsBytes, err := stub.GetState(oldKey)
+		if err != nil {
+			return nil, newError(CodeInternal, "", "Failed to get "+oldKey)
+		}
+		payment := Payment{}
+		json.Unmarshal(paymentAsBytes, &payment) //un stringify it aka JSON.parse()
+		if payment.PaymentID == "" {
+			fmt.Println("! " + oldKey + " does not hold a payment, skipping")
+			continue
+		}
+		if newKey, ok := invoiceKeys[payment.InvoiceID]; ok {
+			payment.InvoiceID = newKey
+		}
+		for i := range payment.Allocations {
+			if newKey, ok := invoiceKeys[payment.Allocations[i].InvoiceID]; ok {
+				payment.Allocations[i].InvoiceID = newKey
+			}
+		}
+		err = stub.DelState(oldKey)
+		if err != nil {
+			return nil, err
+		}
+		err = putPayment(stub, payment)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("! moved payment " + oldKey + " -> " + paymentKey(payment.PaymentID))
+	}
+
+	//invoices list the payments that settled them by invoice key too
+	for _, inv := range migrated {
+		for i := range inv.Payments {
+			if newKey, ok := invoiceKeys[inv.Payments[i].InvoiceID]; ok {
+				inv.Payments[i].InvoiceID = newKey
+			}
+		}
+		err = putInvoice(stub, inv)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("! moved invoice -> " + invoiceKey(inv.VendorID, inv.InvoiceNumber))
+	}
+
+	//rates were kept in one JSON array per currency pair, each now has a key of its own
+	var tables []string
+	var rates []FXRate
+	err = scanPrefix(stub, fxRatePrefix, func(key string, value []byte) error {
+		var table []FXRate
+		err := json.Unmarshal(value, &table)
+		if err != nil {
+			return newError(CodeInternal, "", "FX rates "+key+" are corrupt")
+		}
+		tables = append(tables, key)
+		rates = append(rates, table...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, rate := range rates {
+		day, err := dateKey(rate.EffectiveDate)
+		if err != nil {
+			fmt.Println("! " + rate.From + "/" + rate.To + " rate effective " + rate.EffectiveDate + " has no date, skipping")
+			continue
+		}
+		rate.EffectiveDate = day
+		err = putFXRate(stub, rate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range tables {
+		err = stub.DelState(key)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("! moved fx rates " + key + " -> " + makeKey(fxRateType))
+	}
+
+	//the list queries page over the date and amount indexes, records written before they existed get their entries now
+	var indexKeys, primaryKeys []string
+	err = scanPrefix(stub, invoiceType+keySeparator, func(key string, value []byte) error {
+		var inv Invoice
+		err := json.Unmarshal(value, &inv)
+		if err != nil {
+			return newError(CodeInternal, "", "Invoice "+key+" is corrupt")
+		}
+		for _, indexKey := range invoiceIndexKeys(inv) {
+			indexKeys, primaryKeys = append(indexKeys, indexKey), append(primaryKeys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = scanPrefix(stub, paymentType+keySeparator, func(key string, value []byte) error {
+		var payment Payment
+		err := json.Unmarshal(value, &payment)
+		if err != nil {
+			return newError(CodeInternal, "", "Payment "+key+" is corrupt")
+		}
+		for _, indexKey := range paymentIndexKeys(payment) {
+			indexKeys, primaryKeys = append(indexKeys, indexKey), append(primaryKeys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, indexKey := range indexKeys {
+		err = stub.PutState(indexKey, []byte(primaryKeys[i]))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//the records now have one index key per entry, the JSON array indexes are retired
+	for _, indexStr := range []string{invoiceIndexStr, accountIndexStr, paymentIndexStr} {
+		err = stub.DelState(indexStr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Println("- end migrate keys")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// getIndex - read one of the legacy JSON array indexes
+// ============================================================================================================================
+func getIndex(stub shim.ChaincodeStubInterface, indexStr string) ([]string, error) {
+	var index []string
+	indexAsBytes, err := stub.GetState(indexStr)
+	if err != nil {
+		return nil, newError(CodeInternal, "", "Failed to get "+indexStr)
+	}
+	json.Unmarshal(indexAsBytes, &index) //un stringify it aka JSON.parse()
+	return index, nil
+}
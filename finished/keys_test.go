@@ -0,0 +1,130 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// putLegacy - write a record the way the chaincode did before namespaced keys, under a bare key
+func putLegacy(t *testing.T, stub *mockStub, key string, v interface{}) {
+	valueAsBytes, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("%s: %v", key, err)
+	}
+	stub.state[key] = string(valueAsBytes)
+}
+
+func TestMigrateKeys(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub) //already has INV-1 and C1 under namespaced keys
+	for _, key := range []string{invoiceKey("V1", "INV-1"), accountKey("C1")} {
+		delete(stub.state, key)
+	}
+	for key := range stub.state {
+		if strings.HasPrefix(key, indexPrefix+keySeparator) {
+			delete(stub.state, key) //the indexes are rebuilt from the records
+		}
+	}
+
+	amount := usd("40.00")
+	putLegacy(t, stub, "V1", Invoice{VendorID: "V1", CustomerID: "C1", InvoiceNumber: "INV-1", InvoiceAmount: usd("100.00"), OutstandingAmount: usd("60.00"),
+		Currency: "USD", Status: StatusPartiallyPaid, PaymentDate: "2026-11-01", Payments: []Allocation{{PaymentID: "P1", InvoiceID: "V1", Amount: amount}}})
+	putLegacy(t, stub, "V2", Invoice{VendorID: "V2", CustomerID: "C10", InvoiceNumber: "INV-7", InvoiceAmount: usd("70.00"), OutstandingAmount: usd("70.00"),
+		Currency: "USD", Status: StatusIssued, PaymentDate: "2026-12-01"})
+	putLegacy(t, stub, "C1", Account{ID: "C1", AccountType: "customer", BankerID: "B1"})
+	putLegacy(t, stub, "C10", Account{ID: "C10", AccountType: "customer", BankerID: "B2"})
+	putLegacy(t, stub, "P1", Payment{PaymentID: "P1", VendorID: "V1", CustomerID: "C1", InvoiceID: "V1", Amount: amount, Currency: "USD",
+		PaymentDate: "2026-10-02", Status: PaymentConfirmed, Allocations: []Allocation{{PaymentID: "P1", InvoiceID: "V1", Amount: amount}}})
+	putLegacy(t, stub, paymentKey("P2"), Payment{PaymentID: "P2", VendorID: "V2", CustomerID: "C10", Amount: usd("5.00"), Currency: "USD",
+		PaymentDate: "2026-10-03", Status: PaymentConfirmed}) //already under its key, written before the date and amount indexes
+	putLegacy(t, stub, "junk", "not a record")
+	putLegacy(t, stub, invoiceIndexStr, []string{"V1", "V2", "junk"})
+	putLegacy(t, stub, accountIndexStr, []string{"C1", "C10"})
+	putLegacy(t, stub, paymentIndexStr, []string{"P1"})
+	october, _ := ParseRate("1.0845")
+	november, _ := ParseRate("1.1")
+	putLegacy(t, stub, fxRatePrefix+"EUR_USD", []FXRate{{From: "EUR", To: "USD", Rate: october, EffectiveDate: "2026-10-01"},
+		{From: "EUR", To: "USD", Rate: november, EffectiveDate: "2026-11-01"}})
+
+	mustInvoke(t, stub, RoleAdmin, "A1", "migrate_keys")
+
+	for _, key := range []string{"V1", "V2", "C1", "C10", "P1", invoiceIndexStr, accountIndexStr, paymentIndexStr, fxRatePrefix + "EUR_USD"} {
+		if _, ok := stub.state[key]; ok {
+			t.Errorf("%s is still on the ledger", key)
+		}
+	}
+	if _, ok := stub.state["junk"]; !ok {
+		t.Errorf("junk, which is not a record, was removed")
+	}
+
+	inv := readInvoice(t, stub, "V1", "INV-1")
+	if inv.CustomerID != "C1" || len(inv.Payments) != 1 || inv.Payments[0].InvoiceID != invoiceKey("V1", "INV-1") {
+		t.Errorf("moved invoice %+v, want its payments pointing at its new key", inv)
+	}
+	readInvoice(t, stub, "V2", "INV-7")
+	var payment Payment
+	readJSON(t, stub, paymentKey("P1"), &payment)
+	if payment.InvoiceID != invoiceKey("V1", "INV-1") || payment.Allocations[0].InvoiceID != invoiceKey("V1", "INV-1") {
+		t.Errorf("moved payment %+v, want it pointing at the new invoice key", payment)
+	}
+	var account Account
+	readJSON(t, stub, accountKey("C10"), &account)
+	for day, want := range map[string]string{"2026-10-31": "1.0845", "2026-11-01": "1.1"} {
+		if rate, err := getFXRate(stub, "EUR", "USD", day); err != nil || rate.Rate.String() != want {
+			t.Errorf("EUR/USD on %s after migrating: %+v %v, want %s", day, rate, err, want)
+		}
+	}
+
+	indexes := []struct {
+		key     string
+		primary string
+	}{
+		{indexKey(invoiceType, byCustomer, "C1", "V1", "INV-1"), invoiceKey("V1", "INV-1")},
+		{indexKey(invoiceType, byStatus, StatusPartiallyPaid, "V1", "INV-1"), invoiceKey("V1", "INV-1")},
+		{indexKey(invoiceType, byDueDate, "2026-11-01", "V1", "INV-1"), invoiceKey("V1", "INV-1")},
+		{indexKey(invoiceType, byCustomer, "C10", "V2", "INV-7"), invoiceKey("V2", "INV-7")},
+		{indexKey(invoiceType, byStatus, StatusIssued, "V2", "INV-7"), invoiceKey("V2", "INV-7")},
+		{indexKey(invoiceType, byDueDate, "2026-12-01", "V2", "INV-7"), invoiceKey("V2", "INV-7")},
+		{indexKey(accountType, byBanker, "B1", "C1"), accountKey("C1")},
+		{indexKey(accountType, byBanker, "B2", "C10"), accountKey("C10")},
+		{indexKey(paymentType, byVendor, "V1", "P1"), paymentKey("P1")},
+		{indexKey(paymentType, byCustomer, "C1", "P1"), paymentKey("P1")},
+		{indexKey(invoiceType, byAmount, amountKey(usd("100.00")), "V1", "INV-1"), invoiceKey("V1", "INV-1")},
+		{indexKey(paymentType, byDate, "2026-10-02", "P1"), paymentKey("P1")},
+		{indexKey(paymentType, byDate, "2026-10-03", "P2"), paymentKey("P2")},
+		{indexKey(paymentType, byAmount, amountKey(usd("5.00")), "P2"), paymentKey("P2")},
+	}
+	for _, index := range indexes {
+		if got := stub.state[index.key]; got != index.primary {
+			t.Errorf("index %s holds %q, want %s", index.key, got, index.primary)
+		}
+	}
+	if got := queryInvoicesBy(t, stub, byCustomer, "C1"); len(got) != 1 || got[0] != "INV-1" {
+		t.Errorf("invoices of C1 after migrating: %v, want [INV-1]", got)
+	}
+
+	_, err := stub.as(RoleAdmin, "A1").mockInvoke(new(SimpleChaincode), "migrate_keys", "now")
+	if !errorMatches(err, "Expecting 0") {
+		t.Errorf("migrate_keys with an argument: got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+//go:build tools
+// +build tools
+
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+// localLedger is the world state the gateway runs the chaincode against, kept in one JSON file.
+// The file is rewritten after every transaction that succeeds, so a restart picks up where it left off.
+type localLedger struct {
+	path       string
+	Chaincodes map[string]*localChaincode `json:"chaincodes"` //by chaincode name
+	Logins     map[string]bool            `json:"logins"`     //enroll ids logged in through the registrar
+	Height     int64                      `json:"height"`     //transactions committed so far
+}
+
+// localChaincode is one deployed chaincode and its state. Values are kept as strings so the file stays readable.
+type localChaincode struct {
+	Path  string            `json:"path"`
+	State map[string]string `json:"state"`
+}
+
+// ============================================================================================================================
+// openLedger - read the ledger file, or start an empty ledger if there is none yet
+// ============================================================================================================================
+func openLedger(path string) (*localLedger, error) {
+	ledger := &localLedger{path: path, Chaincodes: map[string]*localChaincode{}, Logins: map[string]bool{}}
+	ledgerAsBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, errors.New("Failed to read ledger " + path + ": " + err.Error())
+	}
+	err = json.Unmarshal(ledgerAsBytes, ledger)
+	if err != nil {
+		return nil, errors.New("Ledger " + path + " is corrupt: " + err.Error())
+	}
+	if ledger.Chaincodes == nil {
+		ledger.Chaincodes = map[string]*localChaincode{}
+	}
+	if ledger.Logins == nil {
+		ledger.Logins = map[string]bool{}
+	}
+	return ledger, nil
+}
+
+// ============================================================================================================================
+// save - write the ledger file, through a temporary file so a crash never leaves half a ledger behind
+// ============================================================================================================================
+func (l *localLedger) save() error {
+	ledgerAsBytes, _ := json.MarshalIndent(l, "", "  ")
+	tmp := l.path + ".tmp"
+	err := ioutil.WriteFile(tmp, ledgerAsBytes, 0600)
+	if err != nil {
+		return errors.New("Failed to write ledger " + l.path + ": " + err.Error())
+	}
+	err = os.Rename(tmp, l.path)
+	if err != nil {
+		return errors.New("Failed to write ledger " + l.path + ": " + err.Error())
+	}
+	return nil
+}
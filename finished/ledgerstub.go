@@ -0,0 +1,203 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ledgerStub is an in-memory ChaincodeStubInterface for one transaction at a time, which the gateway runs against
+// its ledger file and the tests run against a fresh state. It implements the calls the chaincode makes, anything else
+// panics through the nil embedded interface. Values are kept as strings so the ledger file stays readable.
+type ledgerStub struct {
+	shim.ChaincodeStubInterface
+
+	state      map[string]string
+	undo       map[string]*string //value of each key before this transaction wrote it, nil if it was not set
+	readOnly   bool               //queries may not write
+	attributes map[string]string  //certificate attributes of the caller
+	cert       []byte             //caller certificate, PEM or DER, nil when security is off
+	txID       string
+	txTime     time.Time
+	event      *localEvent
+}
+
+// localEvent is the chaincode event a transaction set
+type localEvent struct {
+	Name    string `json:"name"`
+	TxID    string `json:"txid"`
+	Payload string `json:"payload"`
+}
+
+// ============================================================================================================================
+// newLedgerStub - a transaction against a state, run by a caller with the given attributes
+// ============================================================================================================================
+func newLedgerStub(state map[string]string, attributes map[string]string, readOnly bool) *ledgerStub {
+	return &ledgerStub{
+		state:      state,
+		undo:       map[string]*string{},
+		readOnly:   readOnly,
+		attributes: attributes,
+		txID:       newTxID(),
+		txTime:     time.Now().UTC(),
+	}
+}
+
+// newTxID - a random UUID, which is what the peer uses for transaction ids
+func newTxID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	s := hex.EncodeToString(b)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+// rollback - put back every key this transaction wrote and drop its event
+func (s *ledgerStub) rollback() {
+	for key, value := range s.undo {
+		if value == nil {
+			delete(s.state, key)
+		} else {
+			s.state[key] = *value
+		}
+	}
+	s.undo = map[string]*string{}
+	s.event = nil
+}
+
+// write - change a key, remembering its old value the first time, nil deletes it
+func (s *ledgerStub) write(key string, value []byte) error {
+	if s.readOnly {
+		return errors.New("Cannot write state in a query")
+	}
+	if _, seen := s.undo[key]; !seen {
+		if old, ok := s.state[key]; ok {
+			s.undo[key] = &old
+		} else {
+			s.undo[key] = nil
+		}
+	}
+	if value == nil {
+		delete(s.state, key)
+	} else {
+		s.state[key] = string(value)
+	}
+	return nil
+}
+
+// GetState returns nil for a key that was never written, like the peer
+func (s *ledgerStub) GetState(key string) ([]byte, error) {
+	value, ok := s.state[key]
+	if !ok {
+		return nil, nil
+	}
+	return []byte(value), nil
+}
+
+func (s *ledgerStub) PutState(key string, value []byte) error {
+	if key == "" {
+		return errors.New("Key must not be empty")
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return s.write(key, value)
+}
+
+// DelState removes a key, deleting a missing key is not an error
+func (s *ledgerStub) DelState(key string) error {
+	return s.write(key, nil)
+}
+
+// RangeQueryState - the keys from startKey to endKey, both included, in key order, as they were when the query started
+func (s *ledgerStub) RangeQueryState(startKey string, endKey string) (shim.StateRangeQueryIteratorInterface, error) {
+	var keys []string
+	for key := range s.state {
+		if key >= startKey && key <= endKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	it := &ledgerIterator{keys: keys}
+	for _, key := range keys {
+		it.values = append(it.values, s.state[key])
+	}
+	return it, nil
+}
+
+func (s *ledgerStub) ReadCertAttribute(attributeName string) ([]byte, error) {
+	value, ok := s.attributes[attributeName]
+	if !ok {
+		return nil, errors.New("Caller certificate has no attribute " + attributeName)
+	}
+	return []byte(value), nil
+}
+
+func (s *ledgerStub) GetCallerCertificate() ([]byte, error) {
+	return s.cert, nil
+}
+
+func (s *ledgerStub) GetTxID() string {
+	return s.txID
+}
+
+func (s *ledgerStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.txTime.Unix(), Nanos: int32(s.txTime.Nanosecond())}, nil
+}
+
+// SetEvent - like the peer, a later event of the same transaction replaces an earlier one
+func (s *ledgerStub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return errors.New("Event name must not be empty")
+	}
+	s.event = &localEvent{Name: name, TxID: s.txID, Payload: string(payload)}
+	return nil
+}
+
+// ledgerIterator walks the keys and values a range query found
+type ledgerIterator struct {
+	keys   []string
+	values []string
+	next   int
+}
+
+func (it *ledgerIterator) HasNext() bool {
+	return it.next < len(it.keys)
+}
+
+func (it *ledgerIterator) Next() (string, []byte, error) {
+	if !it.HasNext() {
+		return "", nil, errors.New("No more keys")
+	}
+	it.next++
+	return it.keys[it.next-1], []byte(it.values[it.next-1]), nil
+}
+
+func (it *ledgerIterator) Close() error {
+	return nil
+}
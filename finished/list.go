@@ -0,0 +1,384 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// page sizes of the list queries
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// ListQuery is the one JSON argument of list_invoices, list_accounts and list_payments, every field is optional
+type ListQuery struct {
+	Vendor      string `json:"vendor"`      //invoices, payments
+	Customer    string `json:"customer"`    //invoices, payments
+	Status      string `json:"status"`      //invoices, payments
+	Currency    string `json:"currency"`    //invoices, payments
+	FromDate    string `json:"fromdate"`    //invoices by due date, payments by payment date, inclusive
+	ToDate      string `json:"todate"`      //inclusive
+	Banker      string `json:"banker"`      //accounts
+	AccountType string `json:"accounttype"` //accounts
+	SortBy      string `json:"sortby"`      //"id" (default), "date" or "amount"
+	Order       string `json:"order"`       //"asc" (default) or "desc"
+	PageSize    int    `json:"pagesize"`    //default 50, at most 500
+	Token       string `json:"token"`       //"next" from the previous page
+}
+
+// ListPage is one page of a list query
+type ListPage struct {
+	Items []interface{} `json:"items"`
+	Next  string        `json:"next,omitempty"` //pass as "token" to get the next page, empty on the last page
+}
+
+// listCursor is what the opaque continuation token holds: the query it belongs to and the last key it returned
+type listCursor struct {
+	Query string `json:"q"` //queryID of the list function and filters
+	Key   string `json:"k"` //index or record key of the last item on the page
+}
+
+// listScan is the range of keys a list query reads, in the order of the requested sort
+type listScan struct {
+	start   string
+	end     string
+	indexed bool //the keys are index entries holding the primary key, otherwise they are the records themselves
+}
+
+// errPageFull stops a scan once it has found one row more than a page
+var errPageFull = newError(CodeInternal, "", "page is full")
+
+// ============================================================================================================================
+// parseListQuery - read and check the JSON argument of a list query
+// ============================================================================================================================
+func parseListQuery(args []string) (ListQuery, error) {
+	var q ListQuery
+	if len(args) > 1 {
+		return q, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 1 JSON object or none")
+	}
+	if len(args) == 1 && len(args[0]) > 0 {
+		err := json.Unmarshal([]byte(args[0]), &q)
+		if err != nil {
+			return q, newError(CodeInvalidArgument, "", "Argument must be a JSON object: "+err.Error())
+		}
+	}
+
+	if q.SortBy == "" {
+		q.SortBy = "id"
+	}
+	if q.SortBy != "id" && q.SortBy != "date" && q.SortBy != "amount" {
+		return q, newError(CodeInvalidArgument, "sortby", "sortby must be \"id\", \"date\" or \"amount\"")
+	}
+	if q.Order == "" {
+		q.Order = "asc"
+	}
+	if q.Order != "asc" && q.Order != "desc" {
+		return q, newError(CodeInvalidArgument, "order", "order must be \"asc\" or \"desc\"")
+	}
+	if q.PageSize == 0 {
+		q.PageSize = defaultPageSize
+	}
+	if q.PageSize < 0 || q.PageSize > maxPageSize {
+		return q, newError(CodeOutOfRange, "pagesize", "pagesize must be between 1 and "+strconv.Itoa(maxPageSize))
+	}
+	if q.FromDate != "" {
+		day, err := dateKey(q.FromDate)
+		if err != nil {
+			return q, newError(CodeInvalidDate, "fromdate", "fromdate: "+err.Error())
+		}
+		q.FromDate = day
+	}
+	if q.ToDate != "" {
+		day, err := dateKey(q.ToDate)
+		if err != nil {
+			return q, newError(CodeInvalidDate, "todate", "todate: "+err.Error())
+		}
+		q.ToDate = day
+	}
+	return q, nil
+}
+
+// ============================================================================================================================
+// inDateRange - true if date falls within the query's date range, or the query has none
+// ============================================================================================================================
+func (q ListQuery) inDateRange(date string) bool {
+	if q.FromDate == "" && q.ToDate == "" {
+		return true
+	}
+	day, err := dateKey(date)
+	if err != nil {
+		return false
+	}
+	return (q.FromDate == "" || day >= q.FromDate) && (q.ToDate == "" || day <= q.ToDate)
+}
+
+// ============================================================================================================================
+// queryID - the list function and every filter and sort of a query, so a token cannot be replayed with other ones
+// ============================================================================================================================
+func (q ListQuery) queryID(function string) string {
+	q.PageSize = 0 //pages of another size can carry on from the same key
+	q.Token = ""
+	queryAsBytes, _ := json.Marshal(q)
+	sum := sha256.Sum256(append([]byte(function+"\x00"), queryAsBytes...))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ============================================================================================================================
+// readCursor - the last key of the previous page from the continuation token, "" on the first page
+// ============================================================================================================================
+func readCursor(q ListQuery, function string, scan listScan) (string, error) {
+	if q.Token == "" {
+		return "", nil
+	}
+	tokenAsBytes, err := base64.URLEncoding.DecodeString(q.Token)
+	if err != nil {
+		return "", newError(CodeInvalidArgument, "token", "token is not valid")
+	}
+	var cursor listCursor
+	err = json.Unmarshal(tokenAsBytes, &cursor)
+	if err != nil {
+		return "", newError(CodeInvalidArgument, "token", "token is not valid")
+	}
+	if cursor.Query != q.queryID(function) {
+		return "", newError(CodeInvalidArgument, "token", "token belongs to a query with different filters or sort order")
+	}
+	if cursor.Key < scan.start || cursor.Key > scan.end {
+		return "", newError(CodeInvalidArgument, "token", "token is not valid")
+	}
+	return cursor.Key, nil
+}
+
+// ============================================================================================================================
+// pageKeys - one page of the records of a scan that match, in key order or its reverse, starting after the token.
+// match reads the record of a primary key and returns it with true if it passes the filters.
+// ============================================================================================================================
+func pageKeys(stub shim.ChaincodeStubInterface, q ListQuery, function string, scan listScan,
+	match func(primaryKey string) (interface{}, bool, error)) (ListPage, error) {
+	last, err := readCursor(q, function, scan)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	page := ListPage{Items: []interface{}{}}
+	lastKey := ""
+	add := func(key string, primaryKey string) error {
+		record, ok, err := match(primaryKey)
+		if err != nil || !ok {
+			return err
+		}
+		if len(page.Items) == q.PageSize { //a row past the page, there is a next one
+			tokenAsBytes, _ := json.Marshal(listCursor{q.queryID(function), lastKey})
+			page.Next = base64.URLEncoding.EncodeToString(tokenAsBytes)
+			return errPageFull
+		}
+		page.Items = append(page.Items, record)
+		lastKey = key
+		return nil
+	}
+	primaryOf := func(key string, value []byte) string {
+		if scan.indexed {
+			return string(value)
+		}
+		return key
+	}
+
+	if q.Order == "asc" {
+		start := scan.start
+		if last != "" {
+			start = last + "\x00" //the first key after the last one returned
+		}
+		err = scanRange(stub, start, scan.end, func(key string, value []byte) error {
+			return add(key, primaryOf(key, value))
+		})
+	} else {
+		//there is no reverse range scan, so collect the keys up to the token and read records from the end back
+		end := scan.end
+		if last != "" {
+			end = last
+		}
+		var keys, primaryKeys []string
+		err = scanRange(stub, scan.start, end, func(key string, value []byte) error {
+			if key != last {
+				keys = append(keys, key)
+				primaryKeys = append(primaryKeys, primaryOf(key, value))
+			}
+			return nil
+		})
+		for i := len(keys) - 1; i >= 0 && err == nil; i-- {
+			err = add(keys[i], primaryKeys[i])
+		}
+	}
+	if err != nil && err != errPageFull {
+		return ListPage{}, err
+	}
+	return page, nil
+}
+
+// ============================================================================================================================
+// indexScan - a scan over the entries of an index with values from one to another, both inclusive, "" for no bound
+// ============================================================================================================================
+func indexScan(objectType string, index string, from string, to string) listScan {
+	scan := listScan{start: makeKey(indexPrefix, objectType, index) + keySeparator, indexed: true}
+	scan.end = scan.start + keyRangeEnd
+	if from != "" {
+		scan.start = makeKey(indexPrefix, objectType, index, from) + keySeparator
+	}
+	if to != "" {
+		scan.end = makeKey(indexPrefix, objectType, index, to) + keySeparator + keyRangeEnd
+	}
+	return scan
+}
+
+// prefixScan - a scan over every key that starts with a prefix
+func prefixScan(prefix string, indexed bool) listScan {
+	return listScan{prefix, prefix + keyRangeEnd, indexed}
+}
+
+// ============================================================================================================================
+// List Invoices - one page of invoices matching the filters of a ListQuery
+// ============================================================================================================================
+func (t *SimpleChaincode) list_invoices(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	q, err := parseListQuery(args)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- start list invoices")
+
+	//page over the index that is in the order of the sort, the other filters are applied to the invoices it holds.
+	//Invoices without a due date are not in the due date index, so sorting by date leaves them out.
+	var scan listScan
+	switch {
+	case q.SortBy == "date":
+		scan = indexScan(invoiceType, byDueDate, q.FromDate, q.ToDate)
+	case q.SortBy == "amount":
+		scan = indexScan(invoiceType, byAmount, "", "")
+	case q.Vendor != "":
+		scan = prefixScan(makeKey(invoiceType, q.Vendor)+keySeparator, false)
+	case q.Customer != "":
+		scan = indexScan(invoiceType, byCustomer, q.Customer, q.Customer)
+	case q.Status != "":
+		scan = indexScan(invoiceType, byStatus, q.Status, q.Status)
+	default:
+		scan = prefixScan(invoiceType+keySeparator, false)
+	}
+
+	page, err := pageKeys(stub, q, "list_invoices", scan, func(key string) (interface{}, bool, error) {
+		inv, err := getInvoice(stub, key)
+		if err != nil {
+			return nil, false, err
+		}
+		return inv, (q.Vendor == "" || inv.VendorID == q.Vendor) &&
+			(q.Customer == "" || inv.CustomerID == q.Customer) &&
+			(q.Status == "" || inv.Status == q.Status) &&
+			(q.Currency == "" || inv.Currency == q.Currency) &&
+			q.inDateRange(inv.PaymentDate), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end list invoices")
+	return json.Marshal(page)
+}
+
+// ============================================================================================================================
+// List Accounts - one page of accounts matching the filters of a ListQuery
+// ============================================================================================================================
+func (t *SimpleChaincode) list_accounts(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	q, err := parseListQuery(args)
+	if err != nil {
+		return nil, err
+	}
+	if q.SortBy != "id" {
+		return nil, newError(CodeInvalidArgument, "sortby", "accounts can only be sorted by id")
+	}
+	fmt.Println("- start list accounts")
+
+	scan := prefixScan(accountType+keySeparator, false)
+	if q.Banker != "" {
+		scan = indexScan(accountType, byBanker, q.Banker, q.Banker)
+	}
+
+	page, err := pageKeys(stub, q, "list_accounts", scan, func(key string) (interface{}, bool, error) {
+		_, attributes := splitKey(key)
+		account, err := getAccount(stub, attributes[0])
+		if err != nil {
+			return nil, false, err
+		}
+		return account, (q.Banker == "" || account.BankerID == q.Banker) &&
+			(q.AccountType == "" || account.AccountType == q.AccountType), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end list accounts")
+	return json.Marshal(page)
+}
+
+// ============================================================================================================================
+// List Payments - one page of payments matching the filters of a ListQuery
+// ============================================================================================================================
+func (t *SimpleChaincode) list_payments(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	q, err := parseListQuery(args)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- start list payments")
+
+	var scan listScan
+	switch {
+	case q.SortBy == "date":
+		scan = indexScan(paymentType, byDate, q.FromDate, q.ToDate)
+	case q.SortBy == "amount":
+		scan = indexScan(paymentType, byAmount, "", "")
+	case q.Vendor != "":
+		scan = indexScan(paymentType, byVendor, q.Vendor, q.Vendor)
+	case q.Customer != "":
+		scan = indexScan(paymentType, byCustomer, q.Customer, q.Customer)
+	default:
+		scan = prefixScan(paymentType+keySeparator, false)
+	}
+
+	page, err := pageKeys(stub, q, "list_payments", scan, func(key string) (interface{}, bool, error) {
+		_, attributes := splitKey(key)
+		payment, err := getPayment(stub, attributes[0])
+		if err != nil {
+			return nil, false, err
+		}
+		return payment, (q.Vendor == "" || payment.VendorID == q.Vendor) &&
+			(q.Customer == "" || payment.CustomerID == q.Customer) &&
+			(q.Status == "" || payment.Status == q.Status) &&
+			(q.Currency == "" || payment.Currency == q.Currency) &&
+			q.inDateRange(payment.PaymentDate), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end list payments")
+	return json.Marshal(page)
+}
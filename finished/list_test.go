@@ -0,0 +1,163 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// listCase is one row of a table driven test of a list query
+type listCase struct {
+	name    string
+	query   ListQuery
+	pages   int    //how many pages to follow "next" through before the page that is checked
+	wantErr string //substring of the expected error, empty when the query should succeed
+	want    string //the ids on the page
+	more    bool   //whether the page has a next token
+}
+
+// runListCases - run each case of a list query against one ledger, id is the JSON field that names a record
+func runListCases(t *testing.T, stub *mockStub, function string, id string, cases []listCase) {
+	for _, tc := range cases {
+		q := tc.query
+		var page struct {
+			Items []map[string]interface{} `json:"items"`
+			Next  string                   `json:"next"`
+		}
+		var err error
+		for i := 0; i <= tc.pages && err == nil; i++ {
+			if i > 0 {
+				q.Token = page.Next
+			}
+			queryAsBytes, _ := json.Marshal(q)
+			var res []byte
+			res, err = stub.as(RoleAuditor, "AU1").mockQuery(new(SimpleChaincode), function, string(queryAsBytes))
+			if err == nil {
+				page.Next = ""
+				err = json.Unmarshal(res, &page)
+			}
+		}
+		if !errorMatches(err, tc.wantErr) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		ids := []string{}
+		for _, item := range page.Items {
+			ids = append(ids, fmt.Sprint(item[id]))
+		}
+		if got := fmt.Sprint(ids); got != tc.want || (page.Next != "") != tc.more {
+			t.Errorf("%s: got %s, next %q, want %s, more %v", tc.name, got, page.Next, tc.want, tc.more)
+		}
+	}
+}
+
+// tokenFor - a well formed token for a query, as the list function would hand it out after key
+func tokenFor(function string, query ListQuery, key string) string {
+	queryAsBytes, _ := json.Marshal(query)
+	q, _ := parseListQuery([]string{string(queryAsBytes)})
+	token, _ := json.Marshal(listCursor{q.queryID(function), key})
+	return base64.URLEncoding.EncodeToString(token)
+}
+
+func TestListInvoices(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub) //INV-1, 100.00 due 2026-11-01
+	due := func(args []string, date string) []string {
+		args[8] = date
+		return args
+	}
+	mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", due(invoiceArgs("V1", "C1", "INV-2", "20.00", "steel", "4"), "2026-10-15")...)
+	mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", due(invoiceArgs("V1", "C1", "INV-3", "300.00", "steel", "6"), "2026-12-01")...)
+	mustInvoke(t, stub, RoleVendor, "V2", "create_invoice", due(invoiceArgs("V2", "C1", "INV-4", "40.00", "tin", "8"), "2026-11-20")...)
+	mustInvoke(t, stub, RoleVendor, "V2", "create_invoice", append(due(invoiceArgs("V2", "C1", "INV-5", "50.00", "tin", "1"), "2026-10-20")[:9], StatusDraft, "2026-10-20")...)
+
+	runListCases(t, stub, "list_invoices", "invoicenumber", []listCase{
+		{name: "everything", want: "[INV-1 INV-2 INV-3 INV-4 INV-5]"},
+		{name: "first page", query: ListQuery{PageSize: 2}, want: "[INV-1 INV-2]", more: true},
+		{name: "second page", query: ListQuery{PageSize: 2}, pages: 1, want: "[INV-3 INV-4]", more: true},
+		{name: "last page", query: ListQuery{PageSize: 2}, pages: 2, want: "[INV-5]"},
+		{name: "page ends with the last row", query: ListQuery{PageSize: 5}, want: "[INV-1 INV-2 INV-3 INV-4 INV-5]"},
+		{name: "by amount, descending", query: ListQuery{SortBy: "amount", Order: "desc", PageSize: 3}, want: "[INV-3 INV-1 INV-5]", more: true},
+		{name: "by amount, descending, continued", query: ListQuery{SortBy: "amount", Order: "desc", PageSize: 3}, pages: 1, want: "[INV-4 INV-2]"},
+		{name: "by due date, continued", query: ListQuery{SortBy: "date", PageSize: 2}, pages: 1, want: "[INV-1 INV-4]", more: true},
+		{name: "due in a date range", query: ListQuery{FromDate: "2026-10-20", ToDate: "2026-11-20", SortBy: "date"}, want: "[INV-5 INV-1 INV-4]"},
+		{name: "due from a date", query: ListQuery{FromDate: "2026-11-02"}, want: "[INV-3 INV-4]"},
+		{name: "due until a date", query: ListQuery{ToDate: "2026-10-31T23:59:59Z"}, want: "[INV-2 INV-5]"},
+		{name: "date range with a vendor", query: ListQuery{Vendor: "V2", ToDate: "2026-11-01"}, want: "[INV-5]"},
+		{name: "by status", query: ListQuery{Status: StatusDraft}, want: "[INV-5]"},
+		{name: "token that is not base64", query: ListQuery{Token: "not a token!"}, wantErr: "token is not valid"},
+		{name: "token that is not a cursor", query: ListQuery{Token: base64.URLEncoding.EncodeToString([]byte("[1,2]"))}, wantErr: "token is not valid"},
+		{name: "token of another sort order", query: ListQuery{Token: tokenFor("list_invoices", ListQuery{SortBy: "amount", Order: "desc"}, invoiceKey("V1", "INV-1"))}, wantErr: "different filters"},
+		{name: "token of other filters", query: ListQuery{Vendor: "V2", Token: tokenFor("list_invoices", ListQuery{Vendor: "V1"}, invoiceKey("V1", "INV-1"))}, wantErr: "different filters"},
+		{name: "token outside the scan", query: ListQuery{Vendor: "V1", Token: tokenFor("list_invoices", ListQuery{Vendor: "V1"}, invoiceKey("V2", "INV-4"))}, wantErr: "token is not valid"},
+		{name: "token with a larger page", query: ListQuery{PageSize: 10, Token: tokenFor("list_invoices", ListQuery{PageSize: 2}, invoiceKey("V1", "INV-2"))}, want: "[INV-3 INV-4 INV-5]"},
+		{name: "by customer, continued", query: ListQuery{Customer: "C1", PageSize: 4}, pages: 1, want: "[INV-5]"},
+		{name: "by due date, descending, continued", query: ListQuery{SortBy: "date", Order: "desc", PageSize: 2}, pages: 1, want: "[INV-1 INV-5]", more: true},
+		{name: "bad date", query: ListQuery{FromDate: "2026-13-01"}, wantErr: "fromdate"},
+		{name: "page too large", query: ListQuery{PageSize: maxPageSize + 1}, wantErr: "pagesize"},
+	})
+}
+
+func TestListAccounts(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub) //C1 banked by B1
+	mustInvoke(t, stub, RoleBanker, "B1", "create_account", "C2", "Customer Two", "customer", "2 Main St", "12345", "555-0102", "B1")
+	mustInvoke(t, stub, RoleBanker, "B2", "create_account", "C3", "Customer Three", "customer", "3 Main St", "12345", "555-0103", "B2")
+	mustInvoke(t, stub, RoleBanker, "B1", "create_account", "C10", "Customer Ten", "customer", "10 Main St", "12345", "555-0110", "B1")
+
+	runListCases(t, stub, "list_accounts", "id", []listCase{
+		{name: "everything", want: "[C1 C10 C2 C3]"},
+		{name: "first page", query: ListQuery{PageSize: 3}, want: "[C1 C10 C2]", more: true},
+		{name: "second page", query: ListQuery{PageSize: 3}, pages: 1, want: "[C3]"},
+		{name: "descending, continued", query: ListQuery{Order: "desc", PageSize: 2}, pages: 1, want: "[C10 C1]"},
+		{name: "by banker", query: ListQuery{Banker: "B1", PageSize: 2}, want: "[C1 C10]", more: true},
+		{name: "by banker, continued", query: ListQuery{Banker: "B1", PageSize: 2}, pages: 1, want: "[C2]"},
+		{name: "by another banker", query: ListQuery{Banker: "B2"}, want: "[C3]"},
+		{name: "tampered token", query: ListQuery{Token: base64.URLEncoding.EncodeToString([]byte("{\"s\":\"id\",\"o\":\"asc\""))}, wantErr: "token is not valid"},
+		{name: "by date", query: ListQuery{SortBy: "date"}, wantErr: "only be sorted by id"},
+	})
+}
+
+func TestListPayments(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub)
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", paymentArgs("P1", "10.00", "2026-10-05")...)
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", paymentArgs("P2", "30.00", "2026-10-02")...)
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", paymentArgs("P3", "20.00", "2026-10-09")...)
+
+	runListCases(t, stub, "list_payments", "paymentId", []listCase{
+		{name: "everything", want: "[P1 P2 P3]"},
+		{name: "first page", query: ListQuery{PageSize: 2}, want: "[P1 P2]", more: true},
+		{name: "second page", query: ListQuery{PageSize: 2}, pages: 1, want: "[P3]"},
+		{name: "by date, continued", query: ListQuery{SortBy: "date", PageSize: 1}, pages: 2, want: "[P3]"},
+		{name: "paid in a date range", query: ListQuery{FromDate: "2026-10-03", ToDate: "2026-10-09"}, want: "[P1 P3]"},
+		{name: "paid before a date", query: ListQuery{Customer: "C1", ToDate: "2026-10-04", SortBy: "amount"}, want: "[P2]"},
+		{name: "by vendor", query: ListQuery{Vendor: "V1", SortBy: "amount", Order: "desc"}, want: "[P2 P3 P1]"},
+		{name: "by another vendor", query: ListQuery{Vendor: "V2"}, want: "[]"},
+		{name: "by amount, descending, continued", query: ListQuery{SortBy: "amount", Order: "desc", PageSize: 2}, pages: 1, want: "[P1]"},
+		{name: "token of another list", query: ListQuery{Token: tokenFor("list_invoices", ListQuery{}, paymentKey("P1"))}, wantErr: "different filters"},
+	})
+}
@@ -0,0 +1,112 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// mockStub runs the chaincode offline on a ledgerStub, as a peer would: one transaction after another, each on a
+// clock one second after the last, keeping the events of those that succeed.
+type mockStub struct {
+	*ledgerStub
+
+	txCount  int
+	events   []mockEvent     //events of committed transactions, oldest first
+	failKeys map[string]bool //keys PutState refuses to write, to test what a failed write does
+}
+
+// mockEvent is one event raised with SetEvent
+type mockEvent struct {
+	Name    string
+	Payload []byte
+}
+
+// ============================================================================================================================
+// newMockStub - an empty ledger, with the clock at a fixed time so runs are repeatable
+// ============================================================================================================================
+func newMockStub() *mockStub {
+	stub := newLedgerStub(map[string]string{}, map[string]string{}, false)
+	stub.txID = ""
+	stub.txTime = time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	return &mockStub{ledgerStub: stub}
+}
+
+// as - make the following transactions come from a caller with this role and id, an empty role means no attributes
+func (s *mockStub) as(role string, id string) *mockStub {
+	s.attributes = map[string]string{}
+	if role != "" {
+		s.attributes[roleAttribute] = role
+	}
+	if id != "" {
+		s.attributes[idAttribute] = id
+	}
+	return s
+}
+
+// nextTx - start a new transaction, with its own id and a timestamp one second after the last
+func (s *mockStub) nextTx() {
+	s.txCount++
+	s.txID = "tx" + strconv.Itoa(s.txCount)
+	s.txTime = s.txTime.Add(time.Second)
+	s.undo = map[string]*string{}
+	s.event = nil
+}
+
+// ============================================================================================================================
+// run - run one transaction, its writes and event are thrown away if it fails, the same as a peer would
+// ============================================================================================================================
+func (s *mockStub) run(fn func() ([]byte, error)) ([]byte, error) {
+	s.nextTx()
+	res, err := fn()
+	if err != nil {
+		s.rollback()
+		return res, err
+	}
+	if s.event != nil {
+		s.events = append(s.events, mockEvent{s.event.Name, []byte(s.event.Payload)})
+	}
+	return res, nil
+}
+
+// mockInit, mockInvoke, mockQuery - call the chaincode as a peer would, each in its own transaction
+func (s *mockStub) mockInit(cc *SimpleChaincode, function string, args ...string) ([]byte, error) {
+	return s.run(func() ([]byte, error) { return cc.Init(s, function, args) })
+}
+
+func (s *mockStub) mockInvoke(cc *SimpleChaincode, function string, args ...string) ([]byte, error) {
+	return s.run(func() ([]byte, error) { return cc.Invoke(s, function, args) })
+}
+
+func (s *mockStub) mockQuery(cc *SimpleChaincode, function string, args ...string) ([]byte, error) {
+	s.readOnly = true //queries must not write
+	defer func() { s.readOnly = false }()
+	return s.run(func() ([]byte, error) { return cc.Query(s, function, args) })
+}
+
+// PutState fails for the keys in failKeys
+func (s *mockStub) PutState(key string, value []byte) error {
+	if s.failKeys[key] {
+		return errors.New("Failed to write " + key)
+	}
+	return s.ledgerStub.PutState(key, value)
+}
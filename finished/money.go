@@ -0,0 +1,291 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact decimal amount, held as an integer count of minor units (cents, fils...).
+// It serializes as a decimal string such as "1234.50", never as a float.
+type Money struct {
+	minor int64 //amount in units of 10^-scale
+	scale int   //number of digits after the decimal point
+}
+
+// errOverflow is returned by rescale, Add and Sub when the result does not fit in an int64
+var errOverflow = newError(CodeOutOfRange, "", "Amount is too large")
+
+// currencyMinorUnits lists the ISO 4217 currencies that do not use 2 minor unit digits
+var currencyMinorUnits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// currencyCodes lists the active ISO 4217 currencies that use 2 minor unit digits
+var currencyCodes = strings.Fields(`
+	AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BOV BRL BSD BTN BWP BYN BZD
+	CAD CDF CHE CHF CHW CNY COP COU CRC CUC CUP CVE CZK DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL
+	GHS GIP GMD GTQ GYD HKD HNL HTG HUF IDR ILS INR IRR JMD KES KGS KHR KPW KYD KZT LAK LBP LKR LRD
+	LSL MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MXV MYR MZN NAD NGN NIO NOK NPR NZD PAB PEN
+	PGK PHP PKR PLN QAR RON RSD RUB SAR SBD SCR SDG SEK SGD SHP SLE SLL SOS SRD SSP STN SVC SYP SZL
+	THB TJS TMT TOP TRY TTD TWD TZS UAH USD USN UYU UZS VES WST XCD YER ZAR ZMW ZWL`)
+
+func init() {
+	for _, code := range currencyCodes {
+		currencyMinorUnits[code] = 2
+	}
+}
+
+// ============================================================================================================================
+// currencyDigits - number of minor unit digits for an ISO 4217 currency code
+// ============================================================================================================================
+func currencyDigits(currency string) (int, error) {
+	digits, ok := currencyMinorUnits[currency]
+	if !ok {
+		return 0, newError(CodeInvalidCurrency, "currency", "Unknown currency \""+currency+"\"")
+	}
+	return digits, nil
+}
+
+// ============================================================================================================================
+// ParseMoney - read a decimal string such as "1234.5" as an amount of the given currency
+// ============================================================================================================================
+func ParseMoney(s string, currency string) (Money, error) {
+	digits, err := currencyDigits(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	m, err := parseDecimal(s)
+	if err != nil {
+		return Money{}, err
+	}
+	if m.scale > digits {
+		return Money{}, newError(CodeInvalidArgument, "", "Amount "+s+" has more than "+strconv.Itoa(digits)+" decimal places for "+currency)
+	}
+	m, ok := m.scaledTo(digits)
+	if !ok {
+		return Money{}, newError(CodeOutOfRange, "", "Amount "+s+" is too large for "+currency)
+	}
+	return m, nil
+}
+
+// ============================================================================================================================
+// ZeroMoney - a zero amount printed with the minor units of the given currency
+// ============================================================================================================================
+func ZeroMoney(currency string) Money {
+	digits, err := currencyDigits(currency)
+	if err != nil {
+		digits = 2
+	}
+	return Money{0, digits}
+}
+
+// ============================================================================================================================
+// parseDecimal - read a plain decimal string, keeping exactly the digits given
+// ============================================================================================================================
+func parseDecimal(s string) (Money, error) {
+	text := s
+	negative := false
+	if strings.HasPrefix(text, "-") {
+		negative = true
+		text = text[1:]
+	}
+
+	whole, fraction := text, ""
+	if dot := strings.Index(text, "."); dot >= 0 {
+		whole, fraction = text[:dot], text[dot+1:]
+	}
+	if len(whole) == 0 || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, newError(CodeInvalidArgument, "", "Amount \""+s+"\" is not a decimal number")
+	}
+	if len(whole)+len(fraction) > 18 {
+		return Money{}, newError(CodeOutOfRange, "", "Amount \""+s+"\" has too many digits")
+	}
+
+	minor, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, newError(CodeInvalidArgument, "", "Amount \""+s+"\" is not a decimal number")
+	}
+	if negative {
+		minor = -minor
+	}
+	return Money{minor, len(fraction)}, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ============================================================================================================================
+// rescale - the same amount with a larger number of decimal places, errOverflow if it does not fit
+// ============================================================================================================================
+func (m Money) rescale(scale int) (Money, error) {
+	m, ok := m.scaledTo(scale)
+	if !ok {
+		return m, errOverflow
+	}
+	return m, nil
+}
+
+// scaledTo - the same amount with a larger number of decimal places, false if it does not fit in an int64
+func (m Money) scaledTo(scale int) (Money, bool) {
+	for m.scale < scale {
+		if m.minor > math.MaxInt64/10 || m.minor < math.MinInt64/10 {
+			return m, false
+		}
+		m.minor *= 10
+		m.scale++
+	}
+	return m, true
+}
+
+// align - both amounts expressed with the same number of decimal places
+func align(a Money, b Money) (Money, Money, error) {
+	var err error
+	if a.scale < b.scale {
+		a, err = a.rescale(b.scale)
+	} else {
+		b, err = b.rescale(a.scale)
+	}
+	return a, b, err
+}
+
+// ============================================================================================================================
+// roundBig - round an integer count of 10^-scale units to the given number of decimal places, half away from zero
+// ============================================================================================================================
+func roundBig(v *big.Int, scale int, digits int) (Money, error) {
+	ten := big.NewInt(10)
+	q := new(big.Int).Set(v)
+	if scale < digits {
+		q.Mul(q, new(big.Int).Exp(ten, big.NewInt(int64(digits-scale)), nil))
+	} else if scale > digits {
+		divisor := new(big.Int).Exp(ten, big.NewInt(int64(scale-digits)), nil)
+		r := new(big.Int)
+		q.QuoRem(v, divisor, r)
+		if r.Abs(r).Lsh(r, 1).Cmp(divisor) >= 0 {
+			q.Add(q, big.NewInt(int64(v.Sign())))
+		}
+	}
+	if q.BitLen() > 63 {
+		return Money{}, errOverflow
+	}
+	return Money{q.Int64(), digits}, nil
+}
+
+// Add returns m + o, errOverflow if it does not fit
+func (m Money) Add(o Money) (Money, error) {
+	m, o, err := align(m, o)
+	if err != nil {
+		return Money{}, err
+	}
+	sum := m.minor + o.minor
+	if (o.minor > 0 && sum < m.minor) || (o.minor < 0 && sum > m.minor) {
+		return Money{}, errOverflow
+	}
+	return Money{sum, m.scale}, nil
+}
+
+// Sub returns m - o, errOverflow if it does not fit
+func (m Money) Sub(o Money) (Money, error) {
+	m, o, err := align(m, o)
+	if err != nil {
+		return Money{}, err
+	}
+	diff := m.minor - o.minor
+	if (o.minor > 0 && diff > m.minor) || (o.minor < 0 && diff < m.minor) {
+		return Money{}, errOverflow
+	}
+	return Money{diff, m.scale}, nil
+}
+
+// Cmp returns -1, 0 or +1 as m is less than, equal to or greater than o, it works at any scale
+func (m Money) Cmp(o Money) int {
+	a, b := big.NewInt(m.minor), big.NewInt(o.minor)
+	ten := big.NewInt(10)
+	for scale := m.scale; scale < o.scale; scale++ {
+		a.Mul(a, ten)
+	}
+	for scale := o.scale; scale < m.scale; scale++ {
+		b.Mul(b, ten)
+	}
+	return a.Cmp(b)
+}
+
+// Sign returns -1, 0 or +1 for a negative, zero or positive amount
+func (m Money) Sign() int {
+	return m.Cmp(Money{})
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.minor == 0
+}
+
+// String prints the amount as a canonical decimal string, e.g. "1234.50"
+func (m Money) String() string {
+	minor := m.minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	digits := strconv.FormatInt(minor, 10)
+	if m.scale == 0 {
+		return sign + digits
+	}
+	for len(digits) <= m.scale {
+		digits = "0" + digits
+	}
+	return sign + digits[:len(digits)-m.scale] + "." + digits[len(digits)-m.scale:]
+}
+
+// MarshalJSON writes the amount as a JSON string
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(m.String())), nil
+}
+
+// UnmarshalJSON reads an amount from a JSON string, or from a JSON number written before amounts were strings
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		*m = Money{}
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	parsed, err := parseDecimal(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
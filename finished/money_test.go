@@ -0,0 +1,98 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		s        string
+		currency string
+		want     string
+		wantCode string //empty when the amount should parse
+	}{
+		{"100", "USD", "100.00", ""},
+		{"-12.5", "USD", "-12.50", ""},
+		{"1000", "JPY", "1000", ""},
+		{"9999999999999999.99", "USD", "9999999999999999.99", ""},
+		{"999999999999999999", "JPY", "999999999999999999", ""},
+		{"99999999999999999", "USD", "", CodeOutOfRange},
+		{"9999999999999999999", "JPY", "", CodeOutOfRange},
+		{"1.005", "USD", "", CodeInvalidArgument},
+	}
+	for _, tc := range cases {
+		m, err := ParseMoney(tc.s, tc.currency)
+		if tc.wantCode != "" {
+			if err == nil || codeOf(err, CodeInvalidArgument) != tc.wantCode {
+				t.Errorf("ParseMoney(%q, %s): got %s, %v, want code %s", tc.s, tc.currency, m, err, tc.wantCode)
+			}
+			continue
+		}
+		if err != nil || m.String() != tc.want {
+			t.Errorf("ParseMoney(%q, %s): got %s, %v, want %s", tc.s, tc.currency, m, err, tc.want)
+		}
+	}
+}
+
+func TestMoneyOverflow(t *testing.T) {
+	largest := Money{math.MaxInt64, 2}
+	smallest := Money{math.MinInt64, 2}
+	if _, err := largest.Add(Money{1, 2}); err != errOverflow {
+		t.Errorf("max + 0.01: got %v, want overflow", err)
+	}
+	if _, err := smallest.Sub(Money{1, 2}); err != errOverflow {
+		t.Errorf("min - 0.01: got %v, want overflow", err)
+	}
+	if _, err := largest.Sub(Money{-1, 2}); err != errOverflow {
+		t.Errorf("max - -0.01: got %v, want overflow", err)
+	}
+	if _, err := (Money{math.MaxInt64 / 5, 0}).rescale(1); err != errOverflow {
+		t.Errorf("rescale: got %v, want overflow", err)
+	}
+	if _, err := largest.Add(Money{1, 0}); err != errOverflow {
+		t.Errorf("max + 1 at another scale: got %v, want overflow", err)
+	}
+	less, err := largest.Sub(Money{1, 2})
+	if err == nil {
+		_, err = less.Add(Money{1, 2})
+	}
+	if err != nil {
+		t.Errorf("max - 0.01 + 0.01: got %v, want no overflow", err)
+	}
+	if largest.Cmp(Money{1, 0}) != 1 || (Money{1, 0}).Cmp(largest) != -1 {
+		t.Errorf("max compared with 1 at a smaller scale")
+	}
+	if _, err := roundBig(new(big.Int).Lsh(big.NewInt(1), 64), 0, 0); err != errOverflow {
+		t.Errorf("roundBig 2^64: got %v, want overflow", err)
+	}
+}
+
+func TestCreateInvoiceAmountTooLarge(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub)
+	_, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "create_invoice", invoiceArgs("V1", "C1", "INV-2", "99999999999999999", "steel", "16")...)
+	if err == nil || errorOf(err).Code != CodeOutOfRange {
+		t.Errorf("create_invoice 99999999999999999 USD: got %v, want code %s", err, CodeOutOfRange)
+	}
+}
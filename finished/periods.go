@@ -0,0 +1,192 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Fiscal periods are calendar months. A period is open until an admin closes it, nothing can be posted
+// into a closed period. A soft close can be undone by opening the period again, a hard close is final.
+// Mistakes found after a close are corrected with post_adjustment, which posts in the current period.
+
+// fiscal period states, stored in FiscalPeriod.Status
+const (
+	PeriodOpen       = "open"
+	PeriodSoftClosed = "soft_closed"
+	PeriodHardClosed = "hard_closed"
+)
+
+// periodTransitions lists, for each status, the statuses a period may move to next
+var periodTransitions = map[string][]string{
+	PeriodOpen:       {PeriodSoftClosed, PeriodHardClosed},
+	PeriodSoftClosed: {PeriodOpen, PeriodHardClosed},
+	PeriodHardClosed: {},
+}
+
+// FiscalPeriod is the status of one month, periods never closed are not stored
+type FiscalPeriod struct {
+	Period        string         `json:"period"` //YYYY-MM
+	Status        string         `json:"status"`
+	StatusHistory []StatusChange `json:"statushistory"` //every open and close, oldest first
+}
+
+// periodKey - a period is keyed by its month
+func periodKey(period string) string {
+	return makeKey(periodType, period)
+}
+
+// ============================================================================================================================
+// getPeriod - the status of a month, open if it was never closed
+// ============================================================================================================================
+func getPeriod(stub shim.ChaincodeStubInterface, period string) (FiscalPeriod, error) {
+	fp := FiscalPeriod{Period: period, Status: PeriodOpen}
+	periodAsBytes, err := stub.GetState(periodKey(period))
+	if err != nil {
+		return fp, newError(CodeInternal, "", "Failed to get fiscal period "+period)
+	}
+	if periodAsBytes == nil {
+		return fp, nil
+	}
+	err = json.Unmarshal(periodAsBytes, &fp) //un stringify it aka JSON.parse()
+	if err != nil {
+		return fp, newError(CodeInternal, "", "Fiscal period "+period+" is corrupt")
+	}
+	return fp, nil
+}
+
+// ============================================================================================================================
+// checkPeriodOpen - an error naming the field if the date falls in a closed period
+// ============================================================================================================================
+func checkPeriodOpen(stub shim.ChaincodeStubInterface, field string, date string) error {
+	day, err := dateKey(date)
+	if err != nil {
+		return atField(err, field)
+	}
+	fp, err := getPeriod(stub, day[:7])
+	if err != nil {
+		return err
+	}
+	if fp.Status != PeriodOpen {
+		return newError(CodePeriodClosed, field, "Fiscal period "+fp.Period+" is "+fp.Status+", "+day+" cannot be posted to, correct it with an adjusting entry in the current period")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// setPeriodStatus - shared body of open_period, soft_close_period and hard_close_period
+// ============================================================================================================================
+func (t *SimpleChaincode) setPeriodStatus(stub shim.ChaincodeStubInterface, args []string, to string) ([]byte, error) {
+	var reason string
+
+	//	0			1
+	// "2026-10", *"reason"*
+	if len(args) < 1 || len(args) > 2 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting period and optional reason")
+	}
+	if _, err := time.Parse("2006-01", args[0]); err != nil {
+		return nil, newError(CodeInvalidDate, "period", "Period \""+args[0]+"\" is not a month (YYYY-MM)")
+	}
+	if len(args) == 2 {
+		reason = args[1]
+	}
+
+	fmt.Println("- start fiscal period " + args[0] + " to " + to)
+	fp, err := getPeriod(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	allowed := false
+	for _, next := range periodTransitions[fp.Status] {
+		allowed = allowed || next == to
+	}
+	if !allowed {
+		return nil, newError(CodeRejected, "period", "Fiscal period "+fp.Period+" cannot move from \""+fp.Status+"\" to \""+to+"\"")
+	}
+
+	change := StatusChange{}
+	change.From = fp.Status
+	change.To = to
+	change.By = getCaller(stub)
+	change.Timestamp, err = txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	change.Reason = reason
+	fp.Status = to
+	fp.StatusHistory = append(fp.StatusHistory, change)
+
+	jsonAsBytes, _ := json.Marshal(fp)
+	err = stub.PutState(periodKey(fp.Period), jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end fiscal period")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Open Period - reopen a soft-closed period
+// ============================================================================================================================
+func (t *SimpleChaincode) open_period(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.setPeriodStatus(stub, args, PeriodOpen)
+}
+
+// ============================================================================================================================
+// Soft Close Period - stop postings into a period, it can still be opened again
+// ============================================================================================================================
+func (t *SimpleChaincode) soft_close_period(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.setPeriodStatus(stub, args, PeriodSoftClosed)
+}
+
+// ============================================================================================================================
+// Hard Close Period - close a period for good
+// ============================================================================================================================
+func (t *SimpleChaincode) hard_close_period(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	return t.setPeriodStatus(stub, args, PeriodHardClosed)
+}
+
+// ============================================================================================================================
+// Fiscal Periods - every period that was ever closed, oldest first, months not listed are open
+// ============================================================================================================================
+func (t *SimpleChaincode) fiscal_periods(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 0 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 0")
+	}
+	periods := []FiscalPeriod{}
+	err := scanPrefix(stub, periodType+keySeparator, func(key string, value []byte) error {
+		fp := FiscalPeriod{}
+		err := json.Unmarshal(value, &fp)
+		if err != nil {
+			return newError(CodeInternal, "", "Fiscal period "+key+" is corrupt")
+		}
+		periods = append(periods, fp)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(periods)
+}
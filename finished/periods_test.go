@@ -0,0 +1,105 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// paymentArgs - create_payment arguments for a USD payment of INV-1 by C1
+func paymentArgs(id string, amount string, date string) []string {
+	return []string{id, "V1", "C1", invoiceKey("V1", "INV-1"), amount, "USD", "B1", date, "T1", ""}
+}
+
+func TestFiscalPeriods(t *testing.T) {
+	stub := newMockStub() //the clock is in October 2026
+	setupLedger(t, stub)
+
+	runInvokeCases(t, "soft_close_period", setupLedger, []invokeCase{
+		{name: "admin", role: RoleAdmin, id: "A1", args: []string{"2026-09", "month end"}},
+		{name: "vendor", role: RoleVendor, id: "V1", args: []string{"2026-09"}, wantErr: "not allowed"},
+		{name: "not a month", role: RoleAdmin, id: "A1", args: []string{"2026-13"}, wantErr: "not a month"},
+	})
+
+	//nothing can be dated in a closed period
+	mustInvoke(t, stub, RoleAdmin, "A1", "hard_close_period", "2026-09")
+	_, err := stub.as(RoleCustomer, "C1").mockInvoke(new(SimpleChaincode), "create_payment", paymentArgs("P1", "10.00", "2026-09-30")...)
+	if e := errorOf(err); e.Code != CodePeriodClosed || e.Field != "paymentdate" {
+		t.Errorf("payment back-dated into September: %+v", e)
+	}
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", paymentArgs("P1", "10.00", "2026-10-15")...)
+
+	//a soft close stops invoices and the confirmation of a payment created before it
+	mustInvoke(t, stub, RoleAdmin, "A1", "soft_close_period", "2026-10")
+	_, err = stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "create_invoice", invoiceArgs("V1", "C1", "INV-2", "30.00", "steel", "4")...)
+	if errorOf(err).Code != CodePeriodClosed {
+		t.Errorf("invoice in a soft-closed period: %v", err)
+	}
+	if _, err = stub.as(RoleBanker, "B1").mockInvoke(new(SimpleChaincode), "confirm_payment", "P1"); errorOf(err).Code != CodePeriodClosed {
+		t.Errorf("payment confirmed into a soft-closed period: %v", err)
+	}
+
+	//a soft close can be undone, a hard close cannot
+	mustInvoke(t, stub, RoleAdmin, "A1", "open_period", "2026-10", "late invoices")
+	mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", invoiceArgs("V1", "C1", "INV-2", "30.00", "steel", "4")...)
+	mustInvoke(t, stub, RoleBanker, "B1", "confirm_payment", "P1")
+	if _, err = stub.as(RoleAdmin, "A1").mockInvoke(new(SimpleChaincode), "open_period", "2026-09"); !errorMatches(err, "cannot move") {
+		t.Errorf("reopening a hard-closed period: %v", err)
+	}
+
+	res, err := stub.mockQuery(new(SimpleChaincode), "fiscal_periods")
+	var periods []FiscalPeriod
+	if err != nil || json.Unmarshal(res, &periods) != nil || len(periods) != 2 {
+		t.Fatalf("fiscal periods %s (%v)", res, err)
+	}
+	if periods[0].Period != "2026-09" || periods[0].Status != PeriodHardClosed || periods[1].Status != PeriodOpen || len(periods[1].StatusHistory) != 2 {
+		t.Errorf("fiscal periods %+v", periods)
+	}
+}
+
+func TestPostAdjustment(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub)
+
+	//write off 5.00 of the receivable, as named arguments
+	adjustment := `{"description": "write off", "lines": [
+		{"entity": "V1", "account": "6100", "counterparty": "C1", "currency": "USD", "debit": "5.00"},
+		{"entity": "V1", "account": "1200", "counterparty": "C1", "currency": "USD", "credit": "5.00"}]}`
+	mustInvoke(t, stub, RoleAdmin, "A1", "post_adjustment", adjustment)
+	journal := queryJournal(t, stub, "2026-10-01", "2026-10-31", "V1")
+	last := journal.Entries[len(journal.Entries)-1]
+	if last.Source != SourceAdjustment || last.Date != "2026-10-01" || balance(journal, "V1", "1200") != "95.00" || !journal.Balanced {
+		t.Errorf("after the write off %+v, receivable %s", last, balance(journal, "V1", "1200"))
+	}
+
+	runInvokeCases(t, "post_adjustment", setupLedger, []invokeCase{
+		{name: "not balanced", role: RoleAdmin, id: "A1", args: []string{"typo", "V1", "6100", "C1", "USD", "5.00", "", "V1", "1200", "C1", "USD", "", "4.00"}, wantErr: "does not balance"},
+		{name: "debit and credit", role: RoleAdmin, id: "A1", args: []string{"typo", "V1", "6100", "C1", "USD", "5.00", "5.00"}, wantErr: "either a debit or a credit"},
+		{name: "negative", role: RoleAdmin, id: "A1", args: []string{"typo", "V1", "6100", "C1", "USD", "-5.00", ""}, wantErr: "zero or more"},
+		{name: "vendor", role: RoleVendor, id: "V1", args: []string{"typo", "V1", "6100", "C1", "USD", "5.00", ""}, wantErr: "not allowed"},
+	})
+
+	//the current period has to be open for an adjustment too
+	mustInvoke(t, stub, RoleAdmin, "A1", "soft_close_period", "2026-10")
+	if _, err := stub.as(RoleAdmin, "A1").mockInvoke(new(SimpleChaincode), "post_adjustment", adjustment); errorOf(err).Code != CodePeriodClosed {
+		t.Errorf("adjustment into a closed period: %v", err)
+	}
+}
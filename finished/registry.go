@@ -0,0 +1,328 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// The registry stops a receivable being financed twice. Every invoice has a fingerprint made from its vendor,
+// customer, number, amount and date, written the same way however they were keyed in, so "INV-001" and "inv 001"
+// of the same amount to the same customer are one receivable. Listing, pledging or selling an invoice encumbers
+// its fingerprint, and nothing else can list, pledge or sell a receivable with that fingerprint until it is released.
+// A sale is never released, only the buyer can go on to list or pledge what it bought.
+
+// encumbrance states, stored in Encumbrance.Status
+const (
+	EncumbranceFree    = "unencumbered"
+	EncumbranceListed  = "listed"  //open trade, the holder is the seller
+	EncumbrancePledged = "pledged" //collateral for a loan, the holder is the lender
+	EncumbranceSold    = "sold"    //the holder bought the right to collect
+)
+
+// Encumbrance is the registry entry for one fingerprint, fingerprints never encumbered are not stored
+type Encumbrance struct {
+	Fingerprint string `json:"fingerprint"`
+	InvoiceID   string `json:"invoiceid"` //invoice that encumbered the fingerprint
+	Status      string `json:"status"`
+	Holder      string `json:"holder"`    //seller of a listing, lender of a pledge, buyer of a sale
+	Reference   string `json:"reference"` //trade id of a listing or sale, tx id of a pledge
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// normalizeID - an id as letters and digits only, upper case, so spacing and punctuation do not make a new receivable
+func normalizeID(id string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, id)
+}
+
+// ============================================================================================================================
+// fingerprint - sha256 of the normalized vendor, customer, invoice number, amount with currency and date of an invoice
+// ============================================================================================================================
+func fingerprint(vendorID string, customerID string, number string, amount Money, currency string, date string) string {
+	day, err := dateKey(date)
+	if err != nil {
+		day = strings.TrimSpace(date)
+	}
+	fields := []string{normalizeID(vendorID), normalizeID(customerID), normalizeID(number),
+		amount.String() + " " + strings.ToUpper(strings.TrimSpace(currency)), day}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// invoiceFingerprint - the fingerprint of an invoice, dated on its payment date
+func invoiceFingerprint(inv Invoice) string {
+	return fingerprint(inv.VendorID, inv.CustomerID, inv.InvoiceNumber, inv.InvoiceAmount, inv.Currency, inv.PaymentDate)
+}
+
+// encumbranceKey - registry entries are keyed by fingerprint
+func encumbranceKey(fp string) string {
+	return makeKey(encumbranceType, fp)
+}
+
+// ============================================================================================================================
+// getEncumbrance - the registry entry of a fingerprint, unencumbered if there is none
+// ============================================================================================================================
+func getEncumbrance(stub shim.ChaincodeStubInterface, fp string) (Encumbrance, error) {
+	enc := Encumbrance{Fingerprint: fp, Status: EncumbranceFree}
+	encAsBytes, err := stub.GetState(encumbranceKey(fp))
+	if err != nil {
+		return enc, newError(CodeInternal, "", "Failed to get encumbrance "+fp)
+	}
+	if encAsBytes == nil {
+		return enc, nil
+	}
+	err = json.Unmarshal(encAsBytes, &enc) //un stringify it aka JSON.parse()
+	if err != nil {
+		return enc, newError(CodeInternal, "", "Encumbrance "+fp+" is corrupt")
+	}
+	return enc, nil
+}
+
+// ============================================================================================================================
+// checkEncumbrance - the registry entry of an invoice, or an error if its fingerprint is held by anything but
+// its sale to the current holders or the listing of the trade given
+// ============================================================================================================================
+func checkEncumbrance(stub shim.ChaincodeStubInterface, inv Invoice, tradeID string) (Encumbrance, error) {
+	enc, err := getEncumbrance(stub, invoiceFingerprint(inv))
+	if err != nil {
+		return enc, err
+	}
+	if enc.Status == EncumbranceFree {
+		return enc, nil
+	}
+	id := invoiceKey(inv.VendorID, inv.InvoiceNumber)
+	if enc.InvoiceID == id && enc.Status == EncumbranceSold {
+		return enc, nil //a holder finances what it holds
+	}
+	if enc.InvoiceID == id && enc.Status == EncumbranceListed && tradeID != "" && enc.Reference == tradeID {
+		return enc, nil //the listing being sold
+	}
+	msg := "Invoice " + inv.InvoiceNumber + " is already " + enc.Status
+	if enc.InvoiceID != id {
+		msg = "Invoice " + inv.InvoiceNumber + " is the same receivable as " + enc.InvoiceID + ", which is already " + enc.Status
+	}
+	return enc, newError(CodeEncumbered, "invoiceid", msg+", it cannot be financed again")
+}
+
+// ============================================================================================================================
+// encumber - hold the fingerprint of an invoice for a listing, pledge or sale
+// ============================================================================================================================
+func encumber(stub shim.ChaincodeStubInterface, inv Invoice, status string, holder string, reference string) error {
+	var err error
+	enc := Encumbrance{}
+	enc.Fingerprint = invoiceFingerprint(inv)
+	enc.InvoiceID = invoiceKey(inv.VendorID, inv.InvoiceNumber)
+	enc.Status = status
+	enc.Holder = holder
+	enc.Reference = reference
+	enc.Timestamp, err = txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+	return putEncumbrance(stub, enc)
+}
+
+// ============================================================================================================================
+// releaseEncumbrance - end the listing or pledge with this reference, an invoice that changed hands goes back to its holders
+// ============================================================================================================================
+func releaseEncumbrance(stub shim.ChaincodeStubInterface, inv Invoice, reference string) error {
+	enc, err := getEncumbrance(stub, invoiceFingerprint(inv))
+	if err != nil {
+		return err
+	}
+	if enc.Reference != reference || enc.Status == EncumbranceSold || enc.Status == EncumbranceFree {
+		return nil
+	}
+	if len(inv.Purchases) > 0 {
+		last := inv.Purchases[len(inv.Purchases)-1]
+		return encumber(stub, inv, EncumbranceSold, last.Buyer, last.TradeID)
+	}
+	if len(capTable(inv)) > 1 || invoiceOwner(inv) != inv.VendorID { //given away off the trade book
+		return encumber(stub, inv, EncumbranceSold, invoiceOwner(inv), stub.GetTxID())
+	}
+	enc.Status = EncumbranceFree
+	enc.Holder = ""
+	enc.Reference = ""
+	enc.Timestamp, err = txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+	return putEncumbrance(stub, enc)
+}
+
+// putEncumbrance - write a registry entry, recording its history
+func putEncumbrance(stub shim.ChaincodeStubInterface, enc Encumbrance) error {
+	key := encumbranceKey(enc.Fingerprint)
+	jsonAsBytes, _ := json.Marshal(enc)
+	err := stub.PutState(key, jsonAsBytes)
+	if err != nil {
+		return err
+	}
+	fmt.Println("! encumbrance " + enc.InvoiceID + " " + enc.Status)
+	return recordHistory(stub, key, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// Pledge Invoice - the owner of an invoice gives it to a lender as collateral
+// ============================================================================================================================
+func (t *SimpleChaincode) pledge_invoice(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0						1
+	// "invoice~V1~INV-001", "B1"
+	if len(args) != 2 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting invoice id and lender")
+	}
+	err := atArgument(checkKeyPart("lender", args[1]), 2)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- start pledge invoice")
+	inv, err := getInvoice(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(capTable(inv)) > 1 {
+		return nil, newError(CodeRejected, "invoiceid", "Invoice "+inv.InvoiceNumber+" is held in pieces by "+holderNames(inv)+" and cannot be pledged whole")
+	}
+	caller, err := getIdentity(stub)
+	if err != nil {
+		return nil, err
+	}
+	owner := invoiceOwner(inv)
+	if caller.Role != RoleAdmin && caller.ID != owner {
+		return nil, newError(CodePermissionDenied, "invoiceid", "Invoice "+inv.InvoiceNumber+" belongs to "+owner+", not "+caller.ID)
+	}
+	if args[1] == owner {
+		return nil, newError(CodeInvalidArgument, "lender", "Invoice "+inv.InvoiceNumber+" cannot be pledged to its owner")
+	}
+	err = checkTradable(inv)
+	if err != nil {
+		return nil, err
+	}
+	_, err = checkEncumbrance(stub, inv, "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = encumber(stub, inv, EncumbrancePledged, args[1], stub.GetTxID())
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end pledge invoice")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Release Pledge - the lender gives a pledged invoice back, its owner may finance it again
+// ============================================================================================================================
+func (t *SimpleChaincode) release_pledge(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0
+	// "invoice~V1~INV-001"
+	if len(args) != 1 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting invoice id")
+	}
+
+	fmt.Println("- start release pledge")
+	inv, err := getInvoice(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	enc, err := getEncumbrance(stub, invoiceFingerprint(inv))
+	if err != nil {
+		return nil, err
+	}
+	if enc.Status != EncumbrancePledged || enc.InvoiceID != args[0] {
+		return nil, newError(CodeRejected, "invoiceid", "Invoice "+inv.InvoiceNumber+" is not pledged")
+	}
+	caller, err := getIdentity(stub)
+	if err != nil {
+		return nil, err
+	}
+	if caller.Role != RoleAdmin && caller.ID != enc.Holder {
+		return nil, newError(CodePermissionDenied, "invoiceid", "Invoice "+inv.InvoiceNumber+" is pledged to "+enc.Holder+", not "+caller.ID)
+	}
+
+	err = releaseEncumbrance(stub, inv, enc.Reference)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end release pledge")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Encumbrance Status - whether an invoice on the ledger may be financed, and if not who holds it
+// ============================================================================================================================
+func (t *SimpleChaincode) encumbrance_status(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0
+	// "invoice~V1~INV-001"
+	if len(args) != 1 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting invoice id")
+	}
+	inv, err := getInvoice(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	enc, err := getEncumbrance(stub, invoiceFingerprint(inv))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(enc)
+}
+
+// ============================================================================================================================
+// Fingerprint Status - the same check for an invoice a lender was shown, from the fields printed on it
+// ============================================================================================================================
+func (t *SimpleChaincode) fingerprint_status(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0		1		2			3		4		5
+	// "V1", "C1", "INV-001", "100.00", "USD", "2026-11-01"
+	if len(args) != 6 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 6")
+	}
+	err := checkCurrency("currency", args[4])
+	if err != nil {
+		return nil, err
+	}
+	amount, err := ParseMoney(args[3], args[4])
+	if err != nil {
+		return nil, argError(codeOf(err, CodeInvalidArgument), 4, "4th argument must be a decimal amount: "+err.Error())
+	}
+	_, err = dateKey(args[5])
+	if err != nil {
+		return nil, atArgument(err, 6)
+	}
+	enc, err := getEncumbrance(stub, fingerprint(args[0], args[1], args[2], amount, args[4], args[5]))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(enc)
+}
@@ -0,0 +1,182 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// queryEncumbrance - the registry entry of an invoice, as a lender would check it
+func queryEncumbrance(t *testing.T, stub *mockStub, invoiceID string) Encumbrance {
+	var enc Encumbrance
+	res, err := stub.as(RoleFinancier, "F1").mockQuery(new(SimpleChaincode), "encumbrance_status", invoiceID)
+	if err != nil {
+		t.Fatalf("encumbrance_status %s: %v", invoiceID, err)
+	}
+	err = json.Unmarshal(res, &enc)
+	if err != nil {
+		t.Fatalf("encumbrance_status %s: %v", invoiceID, err)
+	}
+	return enc
+}
+
+func TestFingerprint(t *testing.T) {
+	base := fingerprint("V1", "C1", "INV-001", usd("100.00"), "USD", "2026-11-01")
+	cases := []struct {
+		name     string
+		fp       string
+		wantSame bool
+	}{
+		{"case, spacing and punctuation", fingerprint(" v1", "c1", "inv 001", usd("100"), "usd", "2026-11-01"), true},
+		{"timestamp instead of date", fingerprint("V1", "C1", "INV/001", usd("100.00"), "USD", "2026-11-01T10:00:00Z"), true},
+		{"other amount", fingerprint("V1", "C1", "INV-001", usd("100.01"), "USD", "2026-11-01"), false},
+		{"other customer", fingerprint("V1", "C2", "INV-001", usd("100.00"), "USD", "2026-11-01"), false},
+		{"other date", fingerprint("V1", "C1", "INV-001", usd("100.00"), "USD", "2026-11-02"), false},
+		{"other number", fingerprint("V1", "C1", "INV-0010", usd("100.00"), "USD", "2026-11-01"), false},
+	}
+	for _, tc := range cases {
+		if same := tc.fp == base; same != tc.wantSame {
+			t.Errorf("%s: same fingerprint = %v, want %v", tc.name, same, tc.wantSame)
+		}
+	}
+}
+
+func TestPledgeInvoice(t *testing.T) {
+	inv1 := invoiceKey("V1", "INV-1")
+	runInvokeCases(t, "pledge_invoice", setupLedger, []invokeCase{
+		{name: "owner pledges", role: RoleVendor, id: "V1", args: []string{inv1, "B1"}, check: func(t *testing.T, stub *mockStub) {
+			if enc := queryEncumbrance(t, stub, inv1); enc.Status != EncumbrancePledged || enc.Holder != "B1" || enc.InvoiceID != inv1 {
+				t.Errorf("owner pledges: %+v", enc)
+			}
+		}},
+		{name: "not the owner", role: RoleVendor, id: "V2", args: []string{inv1, "B1"}, wantErr: "belongs to V1"},
+		{name: "to the owner", role: RoleVendor, id: "V1", args: []string{inv1, "V1"}, wantErr: "to its owner"},
+		{name: "by a customer", role: RoleCustomer, id: "C1", args: []string{inv1, "B1"}, wantErr: "not allowed"},
+	})
+
+	stub := newMockStub()
+	setupLedger(t, stub)
+	mustInvoke(t, stub, RoleVendor, "V1", "pledge_invoice", inv1, "B1")
+	if _, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "release_pledge", inv1); !errorMatches(err, "not allowed") {
+		t.Errorf("pledge released by its owner: %v", err)
+	}
+	if _, err := stub.as(RoleBanker, "B2").mockInvoke(new(SimpleChaincode), "release_pledge", inv1); !errorMatches(err, "pledged to B1") {
+		t.Errorf("pledge released by another banker: %v", err)
+	}
+	mustInvoke(t, stub, RoleBanker, "B1", "release_pledge", inv1)
+	if enc := queryEncumbrance(t, stub, inv1); enc.Status != EncumbranceFree {
+		t.Errorf("after release %+v", enc)
+	}
+	if _, err := stub.as(RoleBanker, "B1").mockInvoke(new(SimpleChaincode), "release_pledge", inv1); !errorMatches(err, "is not pledged") {
+		t.Errorf("releasing twice: %v", err)
+	}
+}
+
+func TestDoubleFinancing(t *testing.T) {
+	inv1 := invoiceKey("V1", "INV-1")
+	stub := newMockStub()
+	setupTradeLedger(t, stub)
+
+	//the same receivable keyed in again under another number
+	mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", invoiceArgs("V1", "C1", "inv 1", "100", "steel", "16")...)
+	copy1 := invoiceKey("V1", "inv 1")
+
+	mustInvoke(t, stub, RoleVendor, "V1", "pledge_invoice", inv1, "B1")
+	attempts := []struct {
+		name     string
+		role     string
+		id       string
+		function string
+		args     []string
+	}{
+		{"list the pledged invoice", RoleVendor, "V1", "open_trade", []string{inv1, "2"}},
+		{"pledge it twice", RoleVendor, "V1", "pledge_invoice", []string{inv1, "B2"}},
+		{"list the copy", RoleVendor, "V1", "open_trade", []string{copy1, "2"}},
+		{"pledge the copy", RoleVendor, "V1", "pledge_invoice", []string{copy1, "B2"}},
+		{"sell the copy", RoleVendor, "V1", "set_user", []string{copy1, "F2"}},
+		{"give a share of the copy", RoleVendor, "V1", "transfer_share", []string{copy1, "V1", "F2", "50"}},
+	}
+	for _, tc := range attempts {
+		_, err := stub.as(tc.role, tc.id).mockInvoke(new(SimpleChaincode), tc.function, tc.args...)
+		if e := errorOf(err); err == nil || e.Code != CodeEncumbered || e.Field != "invoiceid" {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+	if _, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "open_trade", copy1, "2"); !errorMatches(err, "same receivable as "+inv1) {
+		t.Errorf("listing the copy: %v", err)
+	}
+
+	//a lender holding only the paper invoice checks it by its printed fields
+	res, err := stub.mockQuery(new(SimpleChaincode), "fingerprint_status", "v1", "C1", "INV 1", "100.00", "USD", "2026-11-01")
+	var enc Encumbrance
+	if err != nil || json.Unmarshal(res, &enc) != nil || enc.Status != EncumbrancePledged || enc.InvoiceID != inv1 {
+		t.Errorf("fingerprint_status %s (%v)", res, err)
+	}
+
+	//sold, the buyer may pledge what it bought, and gets it back as sold when the pledge ends
+	mustInvoke(t, stub, RoleBanker, "B1", "release_pledge", inv1)
+	id := openTrade(t, stub)
+	if enc = queryEncumbrance(t, stub, inv1); enc.Status != EncumbranceListed || enc.Reference != id {
+		t.Errorf("listed %+v", enc)
+	}
+	mustInvoke(t, stub, RoleFinancier, "F1", "perform_trade", id, "F1")
+	if _, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "open_trade", copy1, "2"); errorOf(err).Code != CodeEncumbered {
+		t.Errorf("listing the copy of a sold invoice: %v", err)
+	}
+	for _, copied := range [][]string{{"set_user", copy1, "F2"}, {"transfer_share", copy1, "V1", "F2", "50"}} {
+		if _, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), copied[0], copied[1:]...); errorOf(err).Code != CodeEncumbered {
+			t.Errorf("%s of the copy of a sold invoice: %v", copied[0], err)
+		}
+	}
+	mustInvoke(t, stub, RoleFinancier, "F1", "pledge_invoice", inv1, "B1")
+	mustInvoke(t, stub, RoleBanker, "B1", "release_pledge", inv1)
+	if enc = queryEncumbrance(t, stub, inv1); enc.Status != EncumbranceSold || enc.Holder != "F1" {
+		t.Errorf("after the buyer's pledge ended %+v, want sold to F1", enc)
+	}
+
+	//sold off the trade book, the copy cannot be sold again and the registry keeps the first sale
+	sold := newMockStub()
+	setupLedger(t, sold)
+	mustInvoke(t, sold, RoleVendor, "V1", "set_user", inv1, "F1")
+	mustInvoke(t, sold, RoleVendor, "V1", "create_invoice", invoiceArgs("V1", "C1", "inv 1", "100", "steel", "16")...)
+	if _, err := sold.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "set_user", copy1, "F2"); !errorMatches(err, "same receivable as "+inv1) {
+		t.Errorf("selling the copy of an invoice sold with set_user: %v", err)
+	}
+	if _, err := sold.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "transfer_share", copy1, "V1", "F2", "50"); errorOf(err).Code != CodeEncumbered {
+		t.Errorf("giving a share of the copy of an invoice sold with set_user: %v", err)
+	}
+	if enc = queryEncumbrance(t, sold, inv1); enc.Status != EncumbranceSold || enc.InvoiceID != inv1 || enc.Holder != "F1" {
+		t.Errorf("registry after selling the copy %+v, want sold to F1 as %s", enc, inv1)
+	}
+
+	//a listing taken down, by its seller or by clean up, frees the receivable
+	inv2 := invoiceKey("V2", "INV-2")
+	mustInvoke(t, stub, RoleVendor, "V2", "open_trade", inv2, "1")
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", "P1", "V2", "C1", inv2, "10.00", "USD", "B1", "", "T1", "")
+	mustInvoke(t, stub, RoleBanker, "B1", "confirm_payment", "P1")
+	if enc = queryEncumbrance(t, stub, inv2); enc.Status != EncumbranceFree {
+		t.Errorf("after clean up %+v", enc)
+	}
+	report := queryHistory(t, stub, encumbranceType, enc.Fingerprint)
+	if len(report.Versions) != 2 {
+		t.Errorf("encumbrance history has %d versions, want listed then released", len(report.Versions))
+	}
+}
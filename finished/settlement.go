@@ -0,0 +1,434 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// payment states, stored in Payment.Status
+const (
+	PaymentPending   = "pending"
+	PaymentConfirmed = "confirmed"
+)
+
+// ============================================================================================================================
+// Get Payment - read a payment from chaincode state
+// ============================================================================================================================
+func getPayment(stub shim.ChaincodeStubInterface, id string) (Payment, error) {
+	var payment Payment
+	paymentAsBytes, err := stub.GetState(paymentKey(id))
+	if err != nil {
+		return payment, newError(CodeInternal, "", "Failed to get payment "+id)
+	}
+	if paymentAsBytes == nil {
+		return payment, newError(CodeNotFound, "", "Payment does not exist: "+id)
+	}
+	err = json.Unmarshal(paymentAsBytes, &payment) //un stringify it aka JSON.parse()
+	if err != nil {
+		return payment, newError(CodeInternal, "", "Payment "+id+" is corrupt")
+	}
+	return payment, nil
+}
+
+// ============================================================================================================================
+// Put Payment - write a payment to chaincode state and bring its secondary indexes up to date
+// ============================================================================================================================
+func putPayment(stub shim.ChaincodeStubInterface, payment Payment) error {
+	key := paymentKey(payment.PaymentID)
+	var oldIndexKeys []string
+	oldAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return newError(CodeInternal, "", "Failed to get payment "+key)
+	}
+	if oldAsBytes != nil {
+		old := Payment{}
+		json.Unmarshal(oldAsBytes, &old) //un stringify it aka JSON.parse()
+		oldIndexKeys = paymentIndexKeys(old)
+	}
+
+	jsonAsBytes, _ := json.Marshal(payment)
+	err = stub.PutState(key, jsonAsBytes) //store payment under its key
+	if err != nil {
+		return err
+	}
+	err = recordHistory(stub, key, jsonAsBytes)
+	if err != nil {
+		return err
+	}
+	return updateIndexes(stub, oldIndexKeys, paymentIndexKeys(payment), key)
+}
+
+// ============================================================================================================================
+// Record Payment - check a payment against every invoice it covers, then store it as pending
+// ============================================================================================================================
+func recordPayment(stub shim.ChaincodeStubInterface, payment Payment) error {
+	var err error
+	fmt.Println("- start record payment " + payment.PaymentID)
+
+	err = atField(checkKeyPart("payment id", payment.PaymentID), "paymentId")
+	if err != nil {
+		return err
+	}
+	err = atField(checkKeyPart("vendor id", payment.VendorID), "vendorid")
+	if err != nil {
+		return err
+	}
+	err = atField(checkKeyPart("customer id", payment.CustomerID), "customerid")
+	if err != nil {
+		return err
+	}
+
+	//check if payment already exists
+	paymentAsBytes, err := stub.GetState(paymentKey(payment.PaymentID))
+	if err != nil {
+		return newError(CodeInternal, "", "Failed to get payment")
+	}
+	res := Payment{}
+	json.Unmarshal(paymentAsBytes, &res)
+	if res.PaymentID == payment.PaymentID {
+		fmt.Println("This payment arleady exists: " + payment.PaymentID)
+		return newError(CodeAlreadyExists, "paymentId", "This payment arleady exists")
+	}
+
+	//customers may only pay their own invoices, through the banker on their account
+	caller, err := getIdentity(stub)
+	if err != nil {
+		return err
+	}
+	if caller.Role == RoleCustomer && caller.ID != payment.CustomerID {
+		return newError(CodePermissionDenied, "customerid", "Customer "+caller.ID+" cannot pay for customer "+payment.CustomerID)
+	}
+	account, err := getAccount(stub, payment.CustomerID)
+	if err != nil {
+		return err
+	}
+	if payment.BankerID != account.BankerID {
+		return newError(CodePermissionDenied, "bankerid", "Payment banker "+payment.BankerID+" is not the banker on account "+account.ID)
+	}
+
+	//a payment without a date is paid on the day of the transaction, it picks the fx rate
+	if payment.PaymentDate == "" {
+		payment.PaymentDate, err = txDate(stub)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = validatePayment(payment)
+	if err != nil {
+		return err
+	}
+	err = checkPeriodOpen(stub, "paymentdate", payment.PaymentDate)
+	if err != nil {
+		return err
+	}
+
+	//the parts must add up to the whole payment
+	total := ZeroMoney(payment.Currency)
+	for _, alloc := range payment.Allocations {
+		total, err = total.Add(alloc.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	if total.Cmp(payment.Amount) != 0 {
+		return newError(CodeInvalidArgument, "amount", "Allocated amounts add up to "+total.String()+" but the payment amount is "+payment.Amount.String())
+	}
+
+	//dry run the settlement now so a bad payment is rejected before the banker sees it
+	_, err = settleInvoices(stub, &payment)
+	if err != nil {
+		return err
+	}
+
+	payment.Status = PaymentPending
+	err = putPayment(stub, payment)
+	if err != nil {
+		return err
+	}
+	emitEvent(stub, Event{Name: EventPaymentCreated, Payment: &payment})
+
+	fmt.Println("- end record payment")
+	return nil
+}
+
+// ============================================================================================================================
+// settleInvoices - apply every allocation of a payment to a copy of its invoice, nothing is written
+// ============================================================================================================================
+func settleInvoices(stub shim.ChaincodeStubInterface, payment *Payment) ([]Invoice, error) {
+	var err error
+	invoices := make([]Invoice, len(payment.Allocations))
+	for i, alloc := range payment.Allocations {
+		for _, prev := range payment.Allocations[:i] {
+			if prev.InvoiceID == alloc.InvoiceID {
+				return nil, newError(CodeInvalidArgument, "allocations["+strconv.Itoa(i)+"].invoiceid", "Invoice "+alloc.InvoiceID+" is listed more than once")
+			}
+		}
+		invoices[i], err = getInvoice(stub, alloc.InvoiceID)
+		if err != nil {
+			return nil, err
+		}
+		err = applyPayment(stub, &invoices[i], *payment, &payment.Allocations[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return invoices, nil
+}
+
+// ============================================================================================================================
+// Confirm Payment - the banker on the paying customer's account confirms the funds moved, the payment is then settled
+// ============================================================================================================================
+func (t *SimpleChaincode) confirm_payment(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0
+	// "PaymentID"
+	if len(args) != 1 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting payment id")
+	}
+
+	fmt.Println("- start confirm payment")
+	payment, err := getPayment(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != PaymentPending {
+		return nil, newError(CodeRejected, "paymentId", "Payment "+payment.PaymentID+" is not pending")
+	}
+
+	caller, err := getIdentity(stub)
+	if err != nil {
+		return nil, err
+	}
+	account, err := getAccount(stub, payment.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	if caller.ID != account.BankerID {
+		return nil, newError(CodePermissionDenied, "paymentId", "Only banker "+account.BankerID+" on account "+account.ID+" can confirm this payment")
+	}
+
+	//settle every invoice before anything is written, so one bad invoice fails the whole payment
+	invoices, err := settleInvoices(stub, &payment)
+	if err != nil {
+		return nil, err
+	}
+	for _, inv := range invoices {
+		err = putInvoice(stub, inv)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = postPayment(stub, payment, invoices)
+	if err != nil {
+		return nil, err
+	}
+
+	payment.Status = PaymentConfirmed
+	payment.ConfirmedBy = caller.ID
+	payment.ConfirmedAt, err = txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	err = putPayment(stub, payment)
+	if err != nil {
+		return nil, err
+	}
+	emitEvent(stub, Event{Name: EventPaymentConfirmed, Payment: &payment})
+
+	fmt.Println("- end confirm payment")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Apply Payment - check one allocation of a payment against its invoice, then update the running balance and status of the invoice
+// ============================================================================================================================
+func applyPayment(stub shim.ChaincodeStubInterface, inv *Invoice, payment Payment, alloc *Allocation) error {
+	fmt.Println("- start apply payment " + payment.PaymentID + " to invoice " + inv.InvoiceNumber)
+
+	if payment.VendorID != inv.VendorID {
+		return newError(CodeInvalidArgument, "vendorid", "Payment vendor "+payment.VendorID+" does not match invoice vendor "+inv.VendorID)
+	}
+	if payment.CustomerID != inv.CustomerID {
+		return newError(CodeInvalidArgument, "customerid", "Payment customer "+payment.CustomerID+" does not match invoice customer "+inv.CustomerID)
+	}
+	if inv.Status != StatusIssued && inv.Status != StatusAcknowledged && inv.Status != StatusPartiallyPaid {
+		return newError(CodeRejected, "invoiceid", "Invoice "+inv.InvoiceNumber+" cannot take payments while \""+inv.Status+"\"")
+	}
+	if alloc.Amount.Sign() <= 0 {
+		return newError(CodeOutOfRange, "amount", "Payment amount for invoice "+alloc.InvoiceID+" must be greater than zero")
+	}
+
+	//payments in another currency are converted at the rate for the payment date
+	applied, rate, err := convertAmount(stub, alloc.Amount, payment.Currency, inv.Currency, payment.PaymentDate)
+	if err != nil {
+		return err
+	}
+	alloc.AppliedAmount = applied
+	alloc.Payee = invoiceOwner(*inv) //a sold invoice is paid to whoever bought it
+	alloc.Shares = nil
+	if rate.From != "" {
+		alloc.FXRate = rate.Rate.String()
+	}
+
+	if inv.PaidAmount.IsZero() && inv.OutstandingAmount.IsZero() {
+		inv.OutstandingAmount = inv.InvoiceAmount //invoice was stored before balances were tracked
+	}
+	if applied.Cmp(inv.OutstandingAmount) > 0 {
+		return newError(CodeOutOfRange, "amount", "Payment amount "+applied.String()+" "+inv.Currency+" is more than the outstanding balance "+inv.OutstandingAmount.String()+" of invoice "+alloc.InvoiceID)
+	}
+
+	if len(capTable(*inv)) > 1 { //an invoice with more than one holder pays each its percentage
+		alloc.Payee = ""
+		alloc.Shares, err = shareOut(*inv, applied)
+		if err != nil {
+			return err
+		}
+	}
+
+	next := StatusPartiallyPaid
+	if applied.Cmp(inv.OutstandingAmount) == 0 {
+		next = StatusPaid
+	}
+	if inv.Status != next { //partially paid -> partially paid is not a transition
+		err = setInvoiceStatus(stub, inv, next, "payment "+payment.PaymentID)
+		if err != nil {
+			return err
+		}
+	}
+
+	inv.PaidAmount, err = inv.PaidAmount.Add(applied)
+	if err != nil {
+		return err
+	}
+	inv.OutstandingAmount, err = inv.OutstandingAmount.Sub(applied)
+	if err != nil {
+		return err
+	}
+	inv.Payments = append(inv.Payments, *alloc)
+	fmt.Println("- end apply payment, outstanding " + inv.OutstandingAmount.String())
+	return nil
+}
+
+// ============================================================================================================================
+// Create Payment Multi - create one payment that settles several invoices
+// ============================================================================================================================
+func (t *SimpleChaincode) create_payment_multi(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+
+	//	0			1			2			3		4			5			6				7			8				9			10
+	// "PaymentID", "VendorID", "CustomerID", "Amount", "Currency", "BankerID", "PaymentDate", "TradeID", "NewPaymentDate", "InvoiceID", "Amount" *, "InvoiceID", "Amount"...*
+	// an empty "PaymentDate" is the day of the transaction
+	if len(args) < 11 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting at least 11")
+	}
+	if len(args)%2 == 0 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting an odd number")
+	}
+
+	fmt.Println("- start create payment multi")
+	if len(args[0]) <= 0 {
+		return nil, argError(CodeRequired, 1, "1st argument must be a non-empty string")
+	}
+	err = checkCurrency("currency", args[4])
+	if err != nil {
+		return nil, err
+	}
+	amount, err := ParseMoney(args[3], args[4])
+	if err != nil {
+		return nil, argError(codeOf(err, CodeInvalidArgument), 4, "4th argument must be a decimal amount: "+err.Error())
+	}
+
+	payment := Payment{}
+	payment.PaymentID = args[0]
+	payment.VendorID = args[1]
+	payment.CustomerID = args[2]
+	payment.Amount = amount
+	payment.Currency = args[4]
+	payment.BankerID = args[5]
+	payment.PaymentDate = args[6]
+	payment.TradeID = args[7]
+	payment.NewPaymentDate = args[8]
+
+	for i := 9; i < len(args); i += 2 { //create and append each invoice this payment covers
+		if len(args[i]) <= 0 {
+			return nil, argError(CodeRequired, i+1, "argument "+strconv.Itoa(i+1)+" must be a non-empty invoice id")
+		}
+		part, err := ParseMoney(args[i+1], payment.Currency)
+		if err != nil {
+			return nil, argError(codeOf(err, CodeInvalidArgument), i+2, "argument "+strconv.Itoa(i+2)+" must be a decimal amount: "+err.Error())
+		}
+		payment.Allocations = append(payment.Allocations, Allocation{PaymentID: payment.PaymentID, InvoiceID: args[i], Amount: part})
+	}
+
+	err = recordPayment(stub, payment)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end create payment multi")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Payments For Invoice - list the payments that settled an invoice
+// ============================================================================================================================
+func (t *SimpleChaincode) payments_for_invoice(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting invoice id")
+	}
+
+	inv, err := getInvoice(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	payments := inv.Payments
+	if payments == nil {
+		payments = []Allocation{}
+	}
+	return json.Marshal(payments)
+}
+
+// ============================================================================================================================
+// Invoices For Payment - list the invoices a payment covered
+// ============================================================================================================================
+func (t *SimpleChaincode) invoices_for_payment(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting payment id")
+	}
+
+	payment, err := getPayment(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	allocations := payment.Allocations
+	if allocations == nil && payment.InvoiceID != "" { //payment stored before allocations were tracked
+		allocations = []Allocation{{PaymentID: payment.PaymentID, InvoiceID: payment.InvoiceID, Amount: payment.Amount, AppliedAmount: payment.Amount}}
+	}
+	if allocations == nil {
+		allocations = []Allocation{}
+	}
+	return json.Marshal(allocations)
+}
@@ -0,0 +1,63 @@
+//go:build tools
+// +build tools
+
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The peer image only needs the chaincode. Built with -tags tools the same binary also runs the tools that work
+// without a peer:
+//
+//	go build -tags tools -o chaincode_finished ./finished
+//	chaincode_finished gateway -ledger ledger.json     serve the REST API against a local ledger file
+//	chaincode_finished erpctl invoice list             the command line client, also run as a link named erpctl
+func init() {
+	runTool = runToolCommand
+}
+
+// runToolCommand - run the tool named by the command line, false if it names none and the chaincode should start
+func runToolCommand(args []string) bool {
+	if filepath.Base(args[0]) == "erpctl" {
+		erpctlMain(args[1:])
+		return true
+	}
+	if len(args) < 2 {
+		return false
+	}
+	switch args[1] {
+	case "erpctl":
+		erpctlMain(args[2:])
+	case "gateway":
+		err := runGateway(args[2:])
+		if err != nil {
+			fmt.Printf("Error running gateway: %s\n", err)
+			os.Exit(1)
+		}
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,935 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Trades are a marketplace for receivables. The holder of an invoice asks to sell its part of it at a discount
+// on what is still outstanding, financiers bid for any invoice due within a tenor at a discount. Each side of the
+// book is kept best first, the highest discount ask and the lowest discount bid, the oldest first at one discount.
+// A new order is matched against the other side in that order at the discount of the order it meets, and may be
+// filled in part by several. A buyer becomes the holder of the face value it bought and collects its share of
+// every payment settled against the invoice from then on.
+
+// sides of the book, stored in AnOpenTrade.Side
+const (
+	SideAsk = "ask"
+	SideBid = "bid"
+)
+
+// DepthLevel is the total of the open orders on one side of the book at one discount and tenor
+type DepthLevel struct {
+	Currency  string `json:"currency"`
+	Discount  string `json:"discount"`
+	Tenor     int    `json:"tenor"`     //days to the due date of the invoices asked, most days to it the bids take
+	FaceValue Money  `json:"facevalue"` //offered or wanted
+	Price     Money  `json:"price"`
+	Orders    int    `json:"orders"`
+}
+
+// TradeDepth is the order book summed by discount and tenor, each side best first
+type TradeDepth struct {
+	AsOf string       `json:"asof"` //the day ask tenors are counted from
+	Asks []DepthLevel `json:"asks"`
+	Bids []DepthLevel `json:"bids"`
+}
+
+// ============================================================================================================================
+// invoiceOwner - the largest holder of an invoice, invoices stored before they had an owner belong to their vendor
+// ============================================================================================================================
+func invoiceOwner(inv Invoice) string {
+	if inv.Owner != "" {
+		return inv.Owner
+	}
+	return inv.VendorID
+}
+
+// outstanding - what is left to pay on an invoice, invoices stored before balances were tracked owe their amount
+func outstanding(inv Invoice) Money {
+	if inv.PaidAmount.IsZero() && inv.OutstandingAmount.IsZero() {
+		return inv.InvoiceAmount
+	}
+	return inv.OutstandingAmount
+}
+
+// ============================================================================================================================
+// checkTradable - an error unless the invoice is issued and not yet fully paid, the only invoices that can be sold
+// ============================================================================================================================
+func checkTradable(inv Invoice) error {
+	if inv.Status != StatusIssued && inv.Status != StatusAcknowledged && inv.Status != StatusPartiallyPaid {
+		return newError(CodeRejected, "invoiceid", "Invoice "+inv.InvoiceNumber+" cannot be sold while \""+inv.Status+"\"")
+	}
+	if outstanding(inv).Sign() <= 0 {
+		return newError(CodeRejected, "invoiceid", "Invoice "+inv.InvoiceNumber+" has nothing outstanding")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// checkAsk - an error unless the seller of an ask still holds exactly the face value offered of a tradable invoice
+// ============================================================================================================================
+func checkAsk(inv Invoice, ask AnOpenTrade) error {
+	held := heldBy(inv, ask.User)
+	if held.IsZero() {
+		return newError(CodeRejected, "", "Invoice "+inv.InvoiceNumber+" no longer belongs to seller "+ask.User)
+	}
+	err := checkTradable(inv)
+	if err != nil {
+		return err
+	}
+	if held.Cmp(ask.FaceValue) != 0 {
+		return newError(CodeRejected, "", "Seller "+ask.User+" holds "+held.String()+" of invoice "+inv.InvoiceNumber+", trade "+tradeID(ask)+" is for "+ask.FaceValue.String())
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// parseDiscount - a discount in percent, from 0 up to but not including 100, with at most 4 decimals
+// ============================================================================================================================
+func parseDiscount(s string) (Money, error) {
+	discount, err := parseDecimal(s)
+	if err != nil {
+		return discount, newError(CodeInvalidArgument, "discount", "Discount \""+s+"\" is not a decimal number")
+	}
+	if discount.Sign() < 0 || discount.Cmp(Money{100, 0}) >= 0 || discount.scale > 4 {
+		return discount, newError(CodeOutOfRange, "discount", "Discount must be a percentage from 0 up to 100, with at most 4 decimals")
+	}
+	return discount, nil
+}
+
+// discountOf - a discount stored on an order or a sale as a number, orders stored without one are at no discount
+func discountOf(s string) Money {
+	discount, _ := parseDecimal(s)
+	return discount
+}
+
+// ============================================================================================================================
+// discountPrice - the face value less a discount in percent, rounded half away from zero to the minor units of currency
+// ============================================================================================================================
+func discountPrice(face Money, discount Money, currency string) (Money, error) {
+	hundred, err := Money{100, 0}.rescale(discount.scale)
+	if err != nil {
+		return Money{}, err
+	}
+	factor := Money{hundred.minor - discount.minor, discount.scale + 2} //(100 - discount) / 100
+	return face.Convert(Rate{factor}, currency)
+}
+
+// ============================================================================================================================
+// tenorDays - the days from asof to a due date, an invoice already due has a tenor of 0
+// ============================================================================================================================
+func tenorDays(due string, asof string) int {
+	dueDay, err := dateKey(due)
+	if err != nil {
+		return 0
+	}
+	asofDay, err := dateKey(asof)
+	if err != nil {
+		return 0
+	}
+	from, _ := time.Parse("2006-01-02", asofDay)
+	to, _ := time.Parse("2006-01-02", dueDay)
+	days := int(to.Sub(from).Hours() / 24)
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+// ============================================================================================================================
+// tradeID - the id of an open trade, trades opened before they had one go by their timestamp
+// ============================================================================================================================
+func tradeID(trade AnOpenTrade) string {
+	if trade.ID != "" {
+		return trade.ID
+	}
+	return strconv.FormatInt(trade.Timestamp, 10)
+}
+
+// findTrade - the index of a trade in one side of the book, -1 if it is not there
+func findTrade(book []AnOpenTrade, id string) int {
+	for i := range book {
+		if tradeID(book[i]) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// ============================================================================================================================
+// insertOrder - put an order into its side of the book behind every order as good as it, price then time priority
+// ============================================================================================================================
+func insertOrder(book []AnOpenTrade, order AnOpenTrade) []AnOpenTrade {
+	discount := discountOf(order.Discount)
+	i := 0
+	for i < len(book) {
+		cmp := discount.Cmp(discountOf(book[i].Discount))
+		if (order.Side == SideBid && cmp < 0) || (order.Side != SideBid && cmp > 0) {
+			break
+		}
+		i++
+	}
+	book = append(book, AnOpenTrade{})
+	copy(book[i+1:], book[i:])
+	book[i] = order
+	return book
+}
+
+// reduceOrder - take face value filled off an order, repricing what is left of it
+func reduceOrder(order *AnOpenTrade, face Money) error {
+	var err error
+	order.FaceValue, err = order.FaceValue.Sub(face)
+	if err != nil {
+		return err
+	}
+	order.Filled, err = order.Filled.Add(face)
+	if err != nil {
+		return err
+	}
+	order.Price, err = discountPrice(order.FaceValue, discountOf(order.Discount), order.Currency)
+	return err
+}
+
+// minMoney - the smaller of two amounts
+func minMoney(a Money, b Money) Money {
+	if a.Cmp(b) < 0 {
+		return a
+	}
+	return b
+}
+
+// ============================================================================================================================
+// Get Trades - read the open trades
+// ============================================================================================================================
+func getTrades(stub shim.ChaincodeStubInterface) (AllTrades, error) {
+	var trades AllTrades
+	tradesAsBytes, err := stub.GetState(openTradesStr)
+	if err != nil {
+		return trades, newError(CodeInternal, "", "Failed to get opentrades")
+	}
+	json.Unmarshal(tradesAsBytes, &trades) //un stringify it aka JSON.parse()
+	return trades, nil
+}
+
+// allOrders - the asks then the bids of the book
+func allOrders(trades AllTrades) []AnOpenTrade {
+	return append(append([]AnOpenTrade{}, trades.OpenTrades...), trades.Bids...)
+}
+
+// ============================================================================================================================
+// fillTrade - sell face value of the invoice of an ask to a buyer at a discount. The invoice is written, the sale
+// posted and the ask reduced by what was sold, the caller writes the book.
+// ============================================================================================================================
+func fillTrade(stub shim.ChaincodeStubInterface, inv *Invoice, ask *AnOpenTrade, buyer string, face Money, discount string, bidID string) error {
+	var err error
+	purchase := Purchase{}
+	purchase.TradeID = tradeID(*ask)
+	purchase.Seller = ask.User
+	purchase.Buyer = buyer
+	purchase.FaceValue = face
+	purchase.Discount = discount
+	purchase.Price, err = discountPrice(face, discountOf(discount), ask.Currency)
+	if err != nil {
+		return err
+	}
+	purchase.Timestamp, err = txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+	purchase.BidID = bidID
+	percent := facePercent(*inv, ask.User, face)
+	purchase.Percent = formatPercent(percent)
+	fmt.Println("! " + buyer + " buys " + face.String() + " of invoice " + inv.InvoiceNumber + " from " + ask.User + ", " + purchase.Percent + " percent")
+
+	previous := invoiceOwner(*inv)
+	err = transferPercent(inv, ask.User, buyer, percent)
+	if err != nil {
+		return err
+	}
+	inv.Purchases = append(inv.Purchases, purchase)
+	err = putInvoice(stub, *inv)
+	if err != nil {
+		return err
+	}
+	err = postTrade(stub, *inv, purchase)
+	if err != nil {
+		return err
+	}
+	err = reduceOrder(ask, face)
+	if err != nil {
+		return err
+	}
+	if rest := heldBy(*inv, ask.User); rest.Cmp(ask.FaceValue) != 0 { //the percentage sold is rounded, the ask is for what the seller has left
+		ask.FaceValue = rest
+		ask.Price, err = discountPrice(rest, discountOf(ask.Discount), ask.Currency)
+		if err != nil {
+			return err
+		}
+	}
+	if ask.FaceValue.IsZero() { //sold out, the listing becomes a sale
+		err = encumber(stub, *inv, EncumbranceSold, buyer, purchase.TradeID)
+		if err != nil {
+			return err
+		}
+	}
+
+	filled := *ask
+	emitEvent(stub, Event{Name: EventTradePerformed, TradeID: purchase.TradeID, InvoiceID: filled.InvoiceID, Trade: &filled, Purchase: &purchase})
+	if owner := invoiceOwner(*inv); owner != previous {
+		emitEvent(stub, Event{Name: EventInvoiceOwnerChanged, InvoiceID: filled.InvoiceID, PreviousOwner: previous, NewOwner: owner})
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// matchAsk - fill a new ask from the best bids that take it, each at the discount of the bid
+// ============================================================================================================================
+func matchAsk(stub shim.ChaincodeStubInterface, trades *AllTrades, inv *Invoice, ask *AnOpenTrade, asof string) error {
+	discount := discountOf(ask.Discount)
+	tenor := tenorDays(inv.PaymentDate, asof)
+	i := 0
+	for i < len(trades.Bids) && ask.FaceValue.Sign() > 0 {
+		bid := trades.Bids[i]
+		if discountOf(bid.Discount).Cmp(discount) > 0 { //every bid from here on wants more discount than is asked
+			break
+		}
+		if bid.Currency != ask.Currency || bid.User == ask.User || (bid.Tenor > 0 && tenor > bid.Tenor) || isExpired(bid, ask.Timestamp) {
+			i++ //expired bids are left for the sweep, the ask was opened in this transaction
+			continue
+		}
+		face := minMoney(ask.FaceValue, bid.FaceValue)
+		err := fillTrade(stub, inv, ask, bid.User, face, bid.Discount, tradeID(bid))
+		if err != nil {
+			return err
+		}
+		err = reduceOrder(&bid, face)
+		if err != nil {
+			return err
+		}
+		if bid.FaceValue.IsZero() {
+			trades.Bids = append(trades.Bids[:i], trades.Bids[i+1:]...) //filled, remove the bid
+			err = closeTrade(stub, bid, ClosedFilled)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		trades.Bids[i] = bid
+		i++
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// matchBid - fill a new bid from the best asks it takes, each at the discount of the ask
+// ============================================================================================================================
+func matchBid(stub shim.ChaincodeStubInterface, trades *AllTrades, bid *AnOpenTrade, asof string) error {
+	discount := discountOf(bid.Discount)
+	i := 0
+	for i < len(trades.OpenTrades) && bid.FaceValue.Sign() > 0 {
+		ask := trades.OpenTrades[i]
+		if discountOf(ask.Discount).Cmp(discount) < 0 { //every ask from here on gives less discount than is bid
+			break
+		}
+		if ask.Currency != bid.Currency || ask.User == bid.User || isExpired(ask, bid.Timestamp) {
+			i++ //expired asks are left for the sweep, the bid was placed in this transaction
+			continue
+		}
+		inv, err := getInvoice(stub, ask.InvoiceID)
+		if err != nil || checkAsk(inv, ask) != nil || (bid.Tenor > 0 && tenorDays(inv.PaymentDate, asof) > bid.Tenor) {
+			i++ //stale listings are left for clean up
+			continue
+		}
+		if _, err = checkEncumbrance(stub, inv, tradeID(ask)); err != nil {
+			i++
+			continue
+		}
+		face := minMoney(ask.FaceValue, bid.FaceValue)
+		err = fillTrade(stub, &inv, &ask, bid.User, face, ask.Discount, tradeID(*bid))
+		if err != nil {
+			return err
+		}
+		err = reduceOrder(bid, face)
+		if err != nil {
+			return err
+		}
+		if ask.FaceValue.IsZero() {
+			trades.OpenTrades = append(trades.OpenTrades[:i], trades.OpenTrades[i+1:]...) //sold out, remove the ask
+			err = closeTrade(stub, ask, ClosedFilled)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		trades.OpenTrades[i] = ask
+		i++
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Open Trade - ask to sell the part of an invoice the caller holds at a discount, filled at once by any bids that take it
+// ============================================================================================================================
+func (t *SimpleChaincode) open_trade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0						1		2
+	// "invoice~V1~INV-001", "2.5", "72h"
+	if len(args) != 2 && len(args) != 3 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting invoice id, discount and optional expiry")
+	}
+
+	fmt.Println("- start open trade")
+	discount, err := parseDiscount(args[1])
+	if err != nil {
+		return nil, err
+	}
+	inv, err := getInvoice(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	//only a holder of an invoice can sell it, an admin sells for the owner of a whole invoice
+	caller, err := getIdentity(stub)
+	if err != nil {
+		return nil, err
+	}
+	seller := caller.ID
+	if caller.Role == RoleAdmin && len(capTable(inv)) == 1 {
+		seller = invoiceOwner(inv)
+	}
+	if heldBy(inv, seller).IsZero() {
+		return nil, newError(CodePermissionDenied, "invoiceid", "Invoice "+inv.InvoiceNumber+" belongs to "+holderNames(inv)+", not "+caller.ID)
+	}
+	err = checkTradable(inv)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	trades, err := getTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, trade := range trades.OpenTrades {
+		if trade.InvoiceID == args[0] && isExpired(trade, now) {
+			return nil, newError(CodeAlreadyExists, "invoiceid", "Invoice "+inv.InvoiceNumber+" is still listed in trade "+tradeID(trade)+", which expired, use expire_trades first")
+		}
+		if trade.InvoiceID == args[0] {
+			return nil, newError(CodeAlreadyExists, "invoiceid", "Invoice "+inv.InvoiceNumber+" is already listed in trade "+tradeID(trade))
+		}
+	}
+	_, err = checkEncumbrance(stub, inv, "") //not pledged, sold or listed under another key
+	if err != nil {
+		return nil, err
+	}
+
+	open := AnOpenTrade{}
+	open.ID = stub.GetTxID() //the tx id is unique and the same on every peer
+	open.Side = SideAsk
+	open.User = seller
+	open.Timestamp = now
+	expiry := ""
+	if len(args) == 3 {
+		expiry = args[2]
+	}
+	open.Expires, err = parseExpiry(expiry, open.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	open.InvoiceID = args[0]
+	open.DueDate = inv.PaymentDate
+	open.FaceValue = heldBy(inv, seller)
+	open.Filled = ZeroMoney(inv.Currency)
+	open.Currency = inv.Currency
+	open.Discount = discount.String()
+	open.Price, err = discountPrice(open.FaceValue, discount, inv.Currency)
+	if err != nil {
+		return nil, err
+	}
+	err = encumber(stub, inv, EncumbranceListed, seller, tradeID(open))
+	if err != nil {
+		return nil, err
+	}
+	opened := open
+	emitEvent(stub, Event{Name: EventTradeOpened, TradeID: tradeID(open), InvoiceID: open.InvoiceID, Trade: &opened})
+
+	asof, err := txDate(stub)
+	if err != nil {
+		return nil, err
+	}
+	err = matchAsk(stub, &trades, &inv, &open, asof)
+	if err != nil {
+		return nil, err
+	}
+	if open.FaceValue.Sign() > 0 {
+		trades.OpenTrades = insertOrder(trades.OpenTrades, open) //the rest waits in the book
+	} else {
+		err = closeTrade(stub, open, ClosedFilled)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = putTrades(stub, trades) //rewrite open orders
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end open trade")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Place Bid - a financier bids for face value of invoices due within a tenor at a discount, filled at once by any
+// asks it takes and left in the book for the rest
+// ============================================================================================================================
+func (t *SimpleChaincode) place_bid(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0		1		2			3		4		5
+	// "F1", "USD", "500.00", "3", "90", "2026-12-31"
+	if len(args) != 5 && len(args) != 6 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting financier, currency, face value, discount, tenor and optional expiry")
+	}
+
+	fmt.Println("- start place bid")
+	buyer := args[0]
+	err := atArgument(checkKeyPart("financier", buyer), 1)
+	if err != nil {
+		return nil, err
+	}
+	caller, err := getIdentity(stub)
+	if err != nil {
+		return nil, err
+	}
+	if caller.Role == RoleFinancier && caller.ID != buyer {
+		return nil, newError(CodePermissionDenied, "financier", "Financier "+caller.ID+" cannot bid for "+buyer)
+	}
+	err = checkCurrency("currency", args[1])
+	if err != nil {
+		return nil, err
+	}
+	face, err := ParseMoney(args[2], args[1])
+	if err != nil {
+		return nil, newError(codeOf(err, CodeInvalidArgument), "facevalue", "Face value \""+args[2]+"\" is not an amount of "+args[1])
+	}
+	err = checkPositive("facevalue", face)
+	if err != nil {
+		return nil, err
+	}
+	discount, err := parseDiscount(args[3])
+	if err != nil {
+		return nil, err
+	}
+	tenor, err := strconv.Atoi(args[4])
+	if err != nil || tenor < 0 {
+		return nil, newError(CodeOutOfRange, "tenor", "Tenor must be a whole number of days, 0 for any")
+	}
+
+	bid := AnOpenTrade{}
+	bid.ID = stub.GetTxID()
+	bid.Side = SideBid
+	bid.User = buyer
+	bid.Timestamp, err = txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	expiry := ""
+	if len(args) == 6 {
+		expiry = args[5]
+	}
+	bid.Expires, err = parseExpiry(expiry, bid.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	bid.Tenor = tenor
+	bid.FaceValue = face
+	bid.Filled = ZeroMoney(args[1])
+	bid.Currency = args[1]
+	bid.Discount = discount.String()
+	bid.Price, err = discountPrice(face, discount, args[1])
+	if err != nil {
+		return nil, err
+	}
+	placed := bid
+	emitEvent(stub, Event{Name: EventTradeOpened, TradeID: tradeID(bid), Trade: &placed})
+
+	trades, err := getTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+	asof, err := txDate(stub)
+	if err != nil {
+		return nil, err
+	}
+	err = matchBid(stub, &trades, &bid, asof)
+	if err != nil {
+		return nil, err
+	}
+	if bid.FaceValue.Sign() > 0 {
+		trades.Bids = insertOrder(trades.Bids, bid)
+	} else {
+		err = closeTrade(stub, bid, ClosedFilled)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = putTrades(stub, trades) //rewrite open orders
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end place bid")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Perform Trade - a financier buys off an ask, all of it or some of its face value, and collects that much of every
+// later payment
+// ============================================================================================================================
+func (t *SimpleChaincode) perform_trade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0			1		2
+	// "trade id", "F1", "40.00"
+	if len(args) != 2 && len(args) != 3 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting trade id, financier and optional face value")
+	}
+
+	fmt.Println("- start perform trade")
+	buyer := args[1]
+	err := atArgument(checkKeyPart("financier", buyer), 2)
+	if err != nil {
+		return nil, err
+	}
+	caller, err := getIdentity(stub)
+	if err != nil {
+		return nil, err
+	}
+	if caller.Role == RoleFinancier && caller.ID != buyer {
+		return nil, newError(CodePermissionDenied, "financier", "Financier "+caller.ID+" cannot buy for "+buyer)
+	}
+
+	trades, err := getTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+	i := findTrade(trades.OpenTrades, args[0])
+	if i < 0 {
+		return nil, newError(CodeNotFound, "id", "Trade does not exist: "+args[0])
+	}
+	trade := trades.OpenTrades[i]
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	if isExpired(trade, now) {
+		return nil, newError(CodeExpired, "id", "Trade "+args[0]+" expired at "+formatTimestamp(trade.Expires))
+	}
+	if buyer == trade.User {
+		return nil, newError(CodeInvalidArgument, "financier", "Financier "+buyer+" is the seller of trade "+args[0])
+	}
+	face := trade.FaceValue
+	if len(args) == 3 {
+		face, err = ParseMoney(args[2], trade.Currency)
+		if err != nil {
+			return nil, newError(codeOf(err, CodeInvalidArgument), "facevalue", "Face value \""+args[2]+"\" is not an amount of "+trade.Currency)
+		}
+		if face.Sign() <= 0 || face.Cmp(trade.FaceValue) > 0 {
+			return nil, newError(CodeOutOfRange, "facevalue", "Face value must be more than 0 and at most the "+trade.FaceValue.String()+" offered in trade "+args[0])
+		}
+	}
+
+	//the invoice must still be what was listed
+	inv, err := getInvoice(stub, trade.InvoiceID)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAsk(inv, trade)
+	if err != nil {
+		return nil, err
+	}
+	_, err = checkEncumbrance(stub, inv, tradeID(trade))
+	if err != nil {
+		return nil, err
+	}
+
+	err = fillTrade(stub, &inv, &trade, buyer, face, trade.Discount, "")
+	if err != nil {
+		return nil, err
+	}
+	if trade.FaceValue.IsZero() {
+		trades.OpenTrades = append(trades.OpenTrades[:i], trades.OpenTrades[i+1:]...) //remove trade
+		err = closeTrade(stub, trade, ClosedFilled)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		trades.OpenTrades[i] = trade //the rest stays in the book
+	}
+	err = putTrades(stub, trades) //rewrite open orders
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end perform trade")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Remove Open Trade - the seller takes a listing down, or the financier a bid
+// ============================================================================================================================
+func (t *SimpleChaincode) remove_trade(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0
+	//[data.id]
+	if len(args) < 1 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting 1")
+	}
+
+	fmt.Println("- start remove trade")
+	caller, err := getIdentity(stub)
+	if err != nil {
+		return nil, err
+	}
+	trades, err := getTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, book := range []*[]AnOpenTrade{&trades.OpenTrades, &trades.Bids} { //look for the trade
+		i := findTrade(*book, args[0])
+		if i < 0 {
+			continue
+		}
+		fmt.Println("found the trade")
+		removed := (*book)[i]
+		if caller.Role != RoleAdmin && caller.ID != removed.User {
+			return nil, newError(CodePermissionDenied, "id", "Trade "+args[0]+" was opened by "+removed.User+", not "+caller.ID)
+		}
+		*book = append((*book)[:i], (*book)[i+1:]...) //remove this trade
+		err = putTrades(stub, trades)                 //rewrite open orders
+		if err != nil {
+			return nil, err
+		}
+		if removed.Side != SideBid { //the invoice may be financed again
+			if inv, e := getInvoice(stub, removed.InvoiceID); e == nil {
+				err = releaseEncumbrance(stub, inv, tradeID(removed))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		err = closeTrade(stub, removed, ClosedRemoved)
+		if err != nil {
+			return nil, err
+		}
+		emitEvent(stub, Event{Name: EventTradeRemoved, TradeID: tradeID(removed), InvoiceID: removed.InvoiceID, Trade: &removed})
+
+		fmt.Println("- end remove trade")
+		return nil, nil
+	}
+	return nil, newError(CodeNotFound, "id", "Trade "+args[0]+" does not exist")
+}
+
+// ============================================================================================================================
+// Put Trades - rewrite the open trades, recording the history of every trade opened, changed or closed
+// ============================================================================================================================
+func putTrades(stub shim.ChaincodeStubInterface, trades AllTrades) error {
+	old, err := getTrades(stub)
+	if err != nil {
+		return err
+	}
+
+	before := map[string][]byte{}
+	for _, trade := range allOrders(old) {
+		before[tradeID(trade)], _ = json.Marshal(trade)
+	}
+	for _, trade := range allOrders(trades) { //opened or changed
+		id := tradeID(trade)
+		tradeAsBytes, _ := json.Marshal(trade)
+		if string(before[id]) != string(tradeAsBytes) {
+			err = recordHistory(stub, makeKey(tradeType, id), tradeAsBytes)
+			if err != nil {
+				return err
+			}
+		}
+		delete(before, id)
+	}
+	for _, trade := range allOrders(old) { //closed, in their old order
+		if _, gone := before[tradeID(trade)]; gone {
+			err = recordHistory(stub, makeKey(tradeType, tradeID(trade)), nil)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	jsonAsBytes, _ := json.Marshal(trades)
+	return stub.PutState(openTradesStr, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// Clean Up Open Trades - sweep out expired orders, then take down listings that can no longer be bought as listed:
+// the seller no longer holds what it offered, because the invoice changed hands or was paid since, or the invoice
+// can no longer be sold
+// ============================================================================================================================
+func cleanTrades(stub shim.ChaincodeStubInterface) (err error) {
+	var cleaned []Event
+	fmt.Println("- start clean trades")
+
+	_, err = expireTrades(stub)
+	if err != nil {
+		return err
+	}
+	trades, err := getTrades(stub)
+	if err != nil {
+		return err
+	}
+
+	kept := []AnOpenTrade{}
+	released := map[string]Invoice{} //by trade id, the listings whose invoice can be financed again
+	for _, trade := range trades.OpenTrades {
+		inv, e := getInvoice(stub, trade.InvoiceID)
+		if e == nil && checkAsk(inv, trade) == nil {
+			kept = append(kept, trade)
+			continue
+		}
+		fmt.Println("! trade " + tradeID(trade) + " is no longer valid, removing trade")
+		if e == nil {
+			released[tradeID(trade)] = inv
+		}
+		removed := trade
+		cleaned = append(cleaned, Event{Name: EventTradeCleaned, TradeID: tradeID(removed), InvoiceID: removed.InvoiceID, Trade: &removed, Closed: true})
+	}
+
+	if len(cleaned) > 0 {
+		fmt.Println("! saving open trade changes")
+		err = putTrades(stub, AllTrades{OpenTrades: kept, Bids: trades.Bids}) //rewrite open orders, bids hold no invoice
+		if err != nil {
+			return err
+		}
+		for _, event := range cleaned {
+			if inv, ok := released[event.TradeID]; ok {
+				err = releaseEncumbrance(stub, inv, event.TradeID)
+				if err != nil {
+					return err
+				}
+			}
+			err = closeTrade(stub, *event.Trade, ClosedCleaned)
+			if err != nil {
+				return err
+			}
+		}
+		for _, event := range cleaned {
+			emitEvent(stub, event)
+		}
+	} else {
+		fmt.Println("! all open trades are fine")
+	}
+
+	fmt.Println("- end clean trades")
+	return nil
+}
+
+// ============================================================================================================================
+// depthLevels - one side of the book summed by currency, discount and tenor, in the order of the book, leaving
+// out orders expired by now
+// ============================================================================================================================
+func depthLevels(book []AnOpenTrade, currency string, asof string, now int64) ([]DepthLevel, error) {
+	var err error
+	levels := []DepthLevel{}
+	for _, order := range book {
+		if (currency != "" && order.Currency != currency) || isExpired(order, now) {
+			continue
+		}
+		tenor := order.Tenor
+		if order.Side != SideBid {
+			tenor = tenorDays(order.DueDate, asof)
+		}
+		discount := discountOf(order.Discount)
+		i := 0
+		for i < len(levels) && (levels[i].Currency != order.Currency || levels[i].Tenor != tenor || discountOf(levels[i].Discount).Cmp(discount) != 0) {
+			i++
+		}
+		if i == len(levels) {
+			levels = append(levels, DepthLevel{Currency: order.Currency, Discount: order.Discount, Tenor: tenor, FaceValue: ZeroMoney(order.Currency), Price: ZeroMoney(order.Currency)})
+		}
+		levels[i].FaceValue, err = levels[i].FaceValue.Add(order.FaceValue)
+		if err != nil {
+			return nil, err
+		}
+		levels[i].Price, err = levels[i].Price.Add(order.Price)
+		if err != nil {
+			return nil, err
+		}
+		levels[i].Orders++
+	}
+	return levels, nil
+}
+
+// ============================================================================================================================
+// Trade Depth - the open asks and bids summed by discount and tenor, best first, for one currency or all of them
+// ============================================================================================================================
+func (t *SimpleChaincode) trade_depth(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	//	0		1
+	// "USD", "2026-10-01"
+	if len(args) > 2 {
+		return nil, newError(CodeInvalidArgument, "", "Incorrect number of arguments. Expecting optional currency and date")
+	}
+	currency := ""
+	if len(args) > 0 && args[0] != "" {
+		currency = args[0]
+		err := checkCurrency("currency", currency)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	depth := TradeDepth{}
+	if len(args) > 1 && args[1] != "" {
+		depth.AsOf, err = dateKey(args[1])
+		err = atArgument(err, 2)
+	} else {
+		depth.AsOf, err = txDate(stub)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	trades, err := getTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+	depth.Asks, err = depthLevels(trades.OpenTrades, currency, depth.AsOf, now)
+	if err != nil {
+		return nil, err
+	}
+	depth.Bids, err = depthLevels(trades.Bids, currency, depth.AsOf, now)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(depth)
+}
@@ -0,0 +1,456 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// usd - a USD amount for building ledger records by hand
+func usd(s string) Money {
+	m, _ := ParseMoney(s, "USD")
+	return m
+}
+
+func TestOpenTrade(t *testing.T) {
+	inv1 := invoiceKey("V1", "INV-1")
+	runInvokeCases(t, "open_trade", setupTradeLedger, []invokeCase{
+		{name: "owner lists", role: RoleVendor, id: "V1", args: []string{inv1, "2.5"}, check: func(t *testing.T, stub *mockStub) {
+			trades := readTrades(t, stub)
+			if len(trades.OpenTrades) != 1 {
+				t.Fatalf("owner lists: %d open trades", len(trades.OpenTrades))
+			}
+			open := trades.OpenTrades[0]
+			if open.User != "V1" || open.InvoiceID != inv1 || open.FaceValue.String() != "100.00" || open.Discount != "2.5" || open.Price.String() != "97.50" {
+				t.Errorf("owner lists: stored %+v", open)
+			}
+		}},
+		{name: "price rounded to cents", role: RoleVendor, id: "V1", args: []string{inv1, "0.125"}, check: func(t *testing.T, stub *mockStub) {
+			if open := readTrades(t, stub).OpenTrades[0]; open.Price.String() != "99.88" {
+				t.Errorf("price rounded to cents: %s, want 99.88", open.Price)
+			}
+		}},
+		{name: "by an admin", role: RoleAdmin, id: "A1", args: []string{inv1, "0"}, check: func(t *testing.T, stub *mockStub) {
+			if open := readTrades(t, stub).OpenTrades[0]; open.User != "V1" || open.Price.String() != "100.00" {
+				t.Errorf("by an admin: stored %+v, want sold by V1 at face value", open)
+			}
+		}},
+		{name: "not the owner", role: RoleVendor, id: "V2", args: []string{inv1, "2.5"}, wantErr: "belongs to V1"},
+		{name: "discount of 100", role: RoleVendor, id: "V1", args: []string{inv1, "100"}, wantErr: "from 0 up to 100"},
+		{name: "negative discount", role: RoleVendor, id: "V1", args: []string{inv1, "-1"}, wantErr: "from 0 up to 100"},
+		{name: "discount not a number", role: RoleVendor, id: "V1", args: []string{inv1, "x"}, wantErr: "not a decimal number"},
+		{name: "unknown invoice", role: RoleVendor, id: "V1", args: []string{invoiceKey("V1", "INV-404"), "2.5"}, wantErr: "does not exist"},
+		{name: "too few arguments", role: RoleVendor, id: "V1", args: []string{inv1}, wantErr: "Incorrect number"},
+		{name: "by a customer", role: RoleCustomer, id: "C1", args: []string{inv1, "2.5"}, wantErr: "not allowed"},
+	})
+
+	//an invoice is listed once, and only while it can be collected
+	stub := newMockStub()
+	setupTradeLedger(t, stub)
+	openTrade(t, stub)
+	if _, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "open_trade", inv1, "1"); errorOf(err).Code != CodeAlreadyExists {
+		t.Errorf("listing twice: %v", err)
+	}
+	draft := invoiceArgs("V1", "C1", "INV-3", "30.00", "steel", "4")
+	draft[9] = StatusDraft
+	mustInvoke(t, stub, RoleVendor, "V1", "create_invoice", draft...)
+	if _, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "open_trade", invoiceKey("V1", "INV-3"), "1"); !errorMatches(err, "cannot be sold") {
+		t.Errorf("listing a draft: %v", err)
+	}
+}
+
+func TestPerformTrade(t *testing.T) {
+	inv1 := invoiceKey("V1", "INV-1")
+	stub := newMockStub()
+	setupTradeLedger(t, stub)
+	id := openTrade(t, stub)
+
+	cases := []struct {
+		name    string
+		role    string
+		id      string
+		args    []string
+		wantErr string
+	}{
+		{"by a vendor", RoleVendor, "V2", []string{id, "V2"}, "not allowed"},
+		{"for another financier", RoleFinancier, "F1", []string{id, "F2"}, "cannot buy for F2"},
+		{"by the seller", RoleAdmin, "A1", []string{id, "V1"}, "is the seller"},
+		{"unknown trade", RoleFinancier, "F1", []string{"1", "F1"}, "does not exist"},
+		{"too few arguments", RoleFinancier, "F1", []string{id}, "Incorrect number"},
+	}
+	for _, tc := range cases {
+		_, err := stub.as(tc.role, tc.id).mockInvoke(new(SimpleChaincode), "perform_trade", tc.args...)
+		if !errorMatches(err, tc.wantErr) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+
+	//the financier buys the right to collect INV-1 for 97.50
+	mustInvoke(t, stub, RoleFinancier, "F1", "perform_trade", id, "F1")
+	inv := readInvoice(t, stub, "V1", "INV-1")
+	if inv.Owner != "F1" || len(inv.Purchases) != 1 || inv.Purchases[0].Seller != "V1" || inv.Purchases[0].Price.String() != "97.50" {
+		t.Errorf("invoice after the sale: owner %q, purchases %+v", inv.Owner, inv.Purchases)
+	}
+	if trades := readTrades(t, stub); len(trades.OpenTrades) != 0 {
+		t.Errorf("trade still open after the sale %+v", trades.OpenTrades)
+	}
+	journal := queryJournal(t, stub, "2026-10-01", "2026-10-31")
+	wants := []struct{ entity, account, balance string }{
+		{"V1", "1200", "0.00"}, {"V1", "1000", "97.50"}, {"V1", "5200", "2.50"},
+		{"F1", "1200", "100.00"}, {"F1", "1000", "-97.50"}, {"F1", "4200", "-2.50"},
+	}
+	for _, want := range wants {
+		if got := balance(journal, want.entity, want.account); got != want.balance {
+			t.Errorf("after the sale %s %s is %s, want %s", want.entity, want.account, got, want.balance)
+		}
+	}
+	if !journal.Balanced {
+		t.Errorf("journal does not balance after the sale %+v", journal.Totals)
+	}
+
+	//payments now go to the financier
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", paymentArgs("P1", "40.00", "2026-10-20")...)
+	mustInvoke(t, stub, RoleBanker, "B1", "confirm_payment", "P1")
+	if inv = readInvoice(t, stub, "V1", "INV-1"); len(inv.Payments) != 1 || inv.Payments[0].Payee != "F1" {
+		t.Errorf("payment allocations %+v, want paid to F1", inv.Payments)
+	}
+	journal = queryJournal(t, stub, "2026-10-01", "2026-10-31")
+	if balance(journal, "F1", "1200") != "60.00" || balance(journal, "F1", "1000") != "-57.50" || balance(journal, "V1", "1000") != "97.50" {
+		t.Errorf("after the payment F1 receivable %s cash %s, V1 cash %s", balance(journal, "F1", "1200"), balance(journal, "F1", "1000"), balance(journal, "V1", "1000"))
+	}
+
+	//the financier may sell it on, the vendor can no longer sell or cancel it
+	if _, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "open_trade", inv1, "1"); !errorMatches(err, "belongs to F1") {
+		t.Errorf("vendor listing a sold invoice: %v", err)
+	}
+	if _, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "cancel_invoice", inv1); !errorMatches(err, "is held by F1") {
+		t.Errorf("vendor cancelling a sold invoice: %v", err)
+	}
+	mustInvoke(t, stub, RoleFinancier, "F1", "open_trade", inv1, "1")
+	if open := readTrades(t, stub).OpenTrades[0]; open.User != "F1" || open.FaceValue.String() != "60.00" || open.Price.String() != "59.40" {
+		t.Errorf("resale listing %+v", open)
+	}
+}
+
+func TestRemoveTrade(t *testing.T) {
+	cases := []struct {
+		name       string
+		role       string
+		id         string
+		args       func(id string) []string
+		wantErr    string
+		wantTrades int
+	}{
+		{"open trade", RoleVendor, "V1", func(id string) []string { return []string{id} }, "", 0},
+		{"by an admin", RoleAdmin, "A1", func(id string) []string { return []string{id} }, "", 0},
+		{"by another vendor", RoleVendor, "V2", func(id string) []string { return []string{id} }, "opened by V1", 1},
+		{"unknown trade", RoleVendor, "V1", func(id string) []string { return []string{"1"} }, "Trade 1 does not exist", 1},
+		{"no id", RoleVendor, "V1", func(id string) []string { return []string{} }, "Expecting 1", 1},
+	}
+	for _, tc := range cases {
+		stub := newMockStub()
+		setupTradeLedger(t, stub)
+		id := openTrade(t, stub)
+
+		_, err := stub.as(tc.role, tc.id).mockInvoke(new(SimpleChaincode), "remove_trade", tc.args(id)...)
+		if !errorMatches(err, tc.wantErr) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+			continue
+		}
+		if strings.Contains(tc.wantErr, "does not exist") && errorOf(err).Code != CodeNotFound {
+			t.Errorf("%s: got %v, want code %s", tc.name, err, CodeNotFound)
+		}
+		if n := len(readTrades(t, stub).OpenTrades); n != tc.wantTrades {
+			t.Errorf("%s: %d open trades, want %d", tc.name, n, tc.wantTrades)
+		}
+	}
+}
+
+func TestTradeIDs(t *testing.T) {
+	stub := newMockStub()
+	setupTradeLedger(t, stub)
+	first := openTrade(t, stub)
+	firstTx, firstTime := stub.txID, stub.txTime
+	mustInvoke(t, stub, RoleVendor, "V2", "open_trade", invoiceKey("V2", "INV-2"), "1")
+	second := readTrades(t, stub).OpenTrades[1].ID
+
+	if first != firstTx {
+		t.Errorf("trade id %q, want the transaction id %q", first, firstTx)
+	}
+	if first == second {
+		t.Errorf("two trades share the id %q", first)
+	}
+	trades := readTrades(t, stub)
+	if want := firstTime.UnixNano() / 1000000; trades.OpenTrades[0].Timestamp != want {
+		t.Errorf("trade timestamp %d, want the transaction timestamp %d", trades.OpenTrades[0].Timestamp, want)
+	}
+
+	//trades opened before they had an id are still found by their timestamp
+	trades.OpenTrades[0].ID = ""
+	tradesAsBytes, _ := json.Marshal(trades)
+	stub.state[openTradesStr] = string(tradesAsBytes)
+	mustInvoke(t, stub, RoleVendor, "V1", "remove_trade", strconv.FormatInt(trades.OpenTrades[0].Timestamp, 10))
+	if trades = readTrades(t, stub); len(trades.OpenTrades) != 1 || trades.OpenTrades[0].ID != second {
+		t.Errorf("removing a trade by its timestamp left %+v", trades.OpenTrades)
+	}
+}
+
+func TestCleanTrades(t *testing.T) {
+	inv1 := invoiceKey("V1", "INV-1")
+	listed := AnOpenTrade{ID: "tx1", User: "V1", InvoiceID: inv1, FaceValue: usd("100.00"), Currency: "USD", Discount: "2", Price: usd("98.00")}
+	cases := []struct {
+		name   string
+		trades []AnOpenTrade
+		want   []AnOpenTrade
+	}{
+		{"invoice as listed", []AnOpenTrade{listed}, []AnOpenTrade{listed}},
+		{"part paid since",
+			[]AnOpenTrade{{ID: "tx0", User: "V1", InvoiceID: inv1, FaceValue: usd("90.00"), Currency: "USD", Discount: "2", Price: usd("88.20")}, listed},
+			[]AnOpenTrade{listed}},
+		{"seller does not own the invoice",
+			[]AnOpenTrade{{ID: "tx1", User: "V2", InvoiceID: inv1, FaceValue: usd("100.00"), Currency: "USD", Discount: "2", Price: usd("98.00")}},
+			[]AnOpenTrade{}},
+		{"invoice gone",
+			[]AnOpenTrade{{ID: "tx1", User: "V3", InvoiceID: invoiceKey("V3", "INV-9"), FaceValue: usd("100.00"), Currency: "USD", Discount: "2", Price: usd("98.00")}},
+			[]AnOpenTrade{}},
+		{"trade from before listings", //material swaps left over from earlier versions
+			[]AnOpenTrade{{User: "V1", Timestamp: 1}},
+			[]AnOpenTrade{}},
+	}
+	for _, tc := range cases {
+		stub := newMockStub()
+		setupTradeLedger(t, stub)
+		tradesAsBytes, _ := json.Marshal(AllTrades{OpenTrades: tc.trades})
+		stub.state[openTradesStr] = string(tradesAsBytes)
+
+		err := cleanTrades(stub)
+		takeEvents(stub) //called outside Invoke, nothing sends its events
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		got, _ := json.Marshal(readTrades(t, stub))
+		want, _ := json.Marshal(AllTrades{OpenTrades: tc.want})
+		if string(got) != string(want) {
+			t.Errorf("%s: open trades %s, want %s", tc.name, got, want)
+		}
+	}
+}
+
+// queryDepth - the order book summed by discount and tenor
+func queryDepth(t *testing.T, stub *mockStub, args ...string) TradeDepth {
+	var depth TradeDepth
+	res, err := stub.as(RoleFinancier, "F1").mockQuery(new(SimpleChaincode), "trade_depth", args...)
+	if err != nil {
+		t.Fatalf("trade_depth: %v", err)
+	}
+	err = json.Unmarshal(res, &depth)
+	if err != nil {
+		t.Fatalf("trade_depth: %v", err)
+	}
+	return depth
+}
+
+func TestPlaceBid(t *testing.T) {
+	runInvokeCases(t, "place_bid", setupTradeLedger, []invokeCase{
+		{name: "financier bids", role: RoleFinancier, id: "F1", args: []string{"F1", "USD", "500", "3", "90"}, check: func(t *testing.T, stub *mockStub) {
+			bids := readTrades(t, stub).Bids
+			if len(bids) != 1 || bids[0].Side != SideBid || bids[0].User != "F1" || bids[0].FaceValue.String() != "500.00" || bids[0].Price.String() != "485.00" || bids[0].Tenor != 90 {
+				t.Errorf("financier bids: stored %+v", bids)
+			}
+		}},
+		{name: "for another financier", role: RoleFinancier, id: "F1", args: []string{"F2", "USD", "500", "3", "90"}, wantErr: "cannot bid for F2"},
+		{name: "by an admin", role: RoleAdmin, id: "A1", args: []string{"F2", "USD", "500", "3", "0"}},
+		{name: "nothing wanted", role: RoleFinancier, id: "F1", args: []string{"F1", "USD", "0", "3", "90"}, wantErr: "greater than zero"},
+		{name: "too many decimals", role: RoleFinancier, id: "F1", args: []string{"F1", "USD", "1.001", "3", "90"}, wantErr: "not an amount of USD"},
+		{name: "discount of 100", role: RoleFinancier, id: "F1", args: []string{"F1", "USD", "500", "100", "90"}, wantErr: "from 0 up to 100"},
+		{name: "negative tenor", role: RoleFinancier, id: "F1", args: []string{"F1", "USD", "500", "3", "-1"}, wantErr: "whole number of days"},
+		{name: "already expired", role: RoleFinancier, id: "F1", args: []string{"F1", "USD", "500", "3", "90", "2026-09-30"}, wantErr: "not after the time of the transaction"},
+		{name: "by a vendor", role: RoleVendor, id: "V1", args: []string{"V1", "USD", "500", "3", "90"}, wantErr: "not allowed"},
+	})
+}
+
+func TestOrderBook(t *testing.T) {
+	inv1 := invoiceKey("V1", "INV-1") //100.00 due 2026-11-01, 31 days out
+	stub := newMockStub()
+	setupTradeLedger(t, stub)
+
+	mustInvoke(t, stub, RoleFinancier, "F1", "place_bid", "F1", "USD", "60", "3", "90")
+	mustInvoke(t, stub, RoleFinancier, "F2", "place_bid", "F2", "USD", "30", "2", "90")
+	mustInvoke(t, stub, RoleFinancier, "F3", "place_bid", "F3", "USD", "100", "2", "10")
+	mustInvoke(t, stub, RoleFinancier, "F4", "place_bid", "F4", "USD", "40", "2.00", "0")
+	bids := readTrades(t, stub).Bids
+	if len(bids) != 4 || bids[0].User != "F2" || bids[1].User != "F3" || bids[2].User != "F4" || bids[3].User != "F1" {
+		t.Fatalf("bids %+v, want the lowest discount first, then the oldest", bids)
+	}
+
+	//the ask at 2.5 fills F2 and F4 at their 2, skips F3 whose tenor is too short, and stops at F1's 3
+	mustInvoke(t, stub, RoleVendor, "V1", "open_trade", inv1, "2.5")
+	_, payload := lastEvent(t, stub)
+	wantNames := []string{EventTradeOpened, EventTradePerformed, EventTradePerformed, EventInvoiceOwnerChanged}
+	if names := eventNames(payload); !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("events %v, want the listing, two fills and F4 becoming the largest holder", names)
+	}
+	inv := readInvoice(t, stub, "V1", "INV-1")
+	if len(inv.Purchases) != 2 || inv.Purchases[0].Buyer != "F2" || inv.Purchases[0].Price.String() != "29.40" || inv.Purchases[1].Buyer != "F4" || inv.Purchases[1].Price.String() != "39.20" || inv.Purchases[1].BidID != bids[2].ID {
+		t.Errorf("purchases %+v", inv.Purchases)
+	}
+	wantTable := []Share{{Holder: "V1", Percent: "30"}, {Holder: "F2", Percent: "30"}, {Holder: "F4", Percent: "40"}}
+	if inv.Owner != "F4" || !reflect.DeepEqual(inv.CapTable, wantTable) || inv.Purchases[1].Percent != "40" {
+		t.Errorf("owner %s cap table %+v", inv.Owner, inv.CapTable)
+	}
+	trades := readTrades(t, stub)
+	if len(trades.OpenTrades) != 1 || trades.OpenTrades[0].FaceValue.String() != "30.00" || trades.OpenTrades[0].Filled.String() != "70.00" || trades.OpenTrades[0].Price.String() != "29.25" {
+		t.Errorf("ask left in the book %+v", trades.OpenTrades)
+	}
+	if len(trades.Bids) != 2 || trades.Bids[0].User != "F3" || trades.Bids[1].User != "F1" {
+		t.Errorf("bids left in the book %+v", trades.Bids)
+	}
+
+	depth := queryDepth(t, stub, "USD")
+	wantAsks := []DepthLevel{{Currency: "USD", Discount: "2.5", Tenor: 31, FaceValue: usd("30.00"), Price: usd("29.25"), Orders: 1}}
+	wantBids := []DepthLevel{
+		{Currency: "USD", Discount: "2", Tenor: 10, FaceValue: usd("100.00"), Price: usd("98.00"), Orders: 1},
+		{Currency: "USD", Discount: "3", Tenor: 90, FaceValue: usd("60.00"), Price: usd("58.20"), Orders: 1},
+	}
+	got, _ := json.Marshal(depth)
+	want, _ := json.Marshal(TradeDepth{AsOf: "2026-10-01", Asks: wantAsks, Bids: wantBids})
+	if string(got) != string(want) {
+		t.Errorf("depth %s, want %s", got, want)
+	}
+	if depth = queryDepth(t, stub, "", "2026-10-31"); depth.AsOf != "2026-10-31" || depth.Asks[0].Tenor != 1 {
+		t.Errorf("depth a month later %+v", depth)
+	}
+
+	//a bid at 2.5 buys the rest at the ask's discount, what it does not fill waits behind F3
+	mustInvoke(t, stub, RoleFinancier, "F5", "place_bid", "F5", "USD", "50", "2.5", "0")
+	trades = readTrades(t, stub)
+	if len(trades.OpenTrades) != 0 || len(trades.Bids) != 3 || trades.Bids[1].User != "F5" || trades.Bids[1].FaceValue.String() != "20.00" || trades.Bids[1].Filled.String() != "30.00" {
+		t.Errorf("book after F5's bid: asks %+v bids %+v", trades.OpenTrades, trades.Bids)
+	}
+	inv = readInvoice(t, stub, "V1", "INV-1")
+	wantTable = []Share{{Holder: "F2", Percent: "30"}, {Holder: "F4", Percent: "40"}, {Holder: "F5", Percent: "30"}}
+	if inv.Owner != "F4" || !reflect.DeepEqual(inv.CapTable, wantTable) || heldBy(inv, "F5").String() != "30.00" {
+		t.Errorf("cap table after the ask sold out %+v", inv.CapTable)
+	}
+	if enc := queryEncumbrance(t, stub, inv1); enc.Status != EncumbranceSold || enc.Holder != "F5" {
+		t.Errorf("encumbrance after the ask sold out %+v", enc)
+	}
+
+	//payments are shared by percentage, the cents left over go to the largest remainders
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", paymentArgs("P1", "33.33", "2026-10-20")...)
+	mustInvoke(t, stub, RoleBanker, "B1", "confirm_payment", "P1")
+	inv = readInvoice(t, stub, "V1", "INV-1")
+	wantShares := []Collection{{Holder: "F2", Amount: usd("10.00")}, {Holder: "F4", Amount: usd("13.33")}, {Holder: "F5", Amount: usd("10.00")}}
+	if shares := inv.Payments[0].Shares; !reflect.DeepEqual(shares, wantShares) || inv.Payments[0].Payee != "" {
+		t.Errorf("payment shares %+v", shares)
+	}
+	if heldBy(inv, "F2").String() != "20.00" || heldBy(inv, "F4").String() != "26.67" || heldBy(inv, "F5").String() != "20.00" {
+		t.Errorf("held after the payment %s, %s, %s", heldBy(inv, "F2"), heldBy(inv, "F4"), heldBy(inv, "F5"))
+	}
+	journal := queryJournal(t, stub, "2026-10-01", "2026-10-31")
+	if balance(journal, "F4", "1200") != "26.67" || balance(journal, "F4", "1000") != "-25.87" || balance(journal, "V1", "1200") != "0.00" || !journal.Balanced {
+		t.Errorf("after the payment F4 receivable %s cash %s, V1 receivable %s", balance(journal, "F4", "1200"), balance(journal, "F4", "1000"), balance(journal, "V1", "1200"))
+	}
+}
+
+func TestPartialFill(t *testing.T) {
+	inv1 := invoiceKey("V1", "INV-1")
+	stub := newMockStub()
+	setupTradeLedger(t, stub)
+	id := openTrade(t, stub)
+
+	cases := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"nothing", []string{id, "F1", "0"}, "more than 0"},
+		{"more than offered", []string{id, "F1", "100.01"}, "at most the 100.00"},
+		{"not an amount", []string{id, "F1", "x"}, "not an amount of USD"},
+	}
+	for _, tc := range cases {
+		_, err := stub.as(RoleFinancier, "F1").mockInvoke(new(SimpleChaincode), "perform_trade", tc.args...)
+		if !errorMatches(err, tc.wantErr) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+
+	//F1 buys 40.00 of the face value, the rest stays listed
+	mustInvoke(t, stub, RoleFinancier, "F1", "perform_trade", id, "F1", "40")
+	if _, payload := lastEvent(t, stub); len(payload.Events) != 1 || payload.Events[0].Purchase == nil || payload.Events[0].Purchase.Price.String() != "39.00" {
+		t.Errorf("partial fill events %+v, want the fill alone", payload.Events)
+	}
+	if open := readTrades(t, stub).OpenTrades; len(open) != 1 || open[0].FaceValue.String() != "60.00" || open[0].Price.String() != "58.50" {
+		t.Errorf("ask after a partial fill %+v", open)
+	}
+	if enc := queryEncumbrance(t, stub, inv1); enc.Status != EncumbranceListed || enc.Reference != id {
+		t.Errorf("encumbrance after a partial fill %+v, want still listed", enc)
+	}
+
+	//F2 takes the rest, the invoice is held in pieces and the vendor is out
+	mustInvoke(t, stub, RoleFinancier, "F2", "perform_trade", id, "F2")
+	inv := readInvoice(t, stub, "V1", "INV-1")
+	if wantTable := []Share{{Holder: "F1", Percent: "40"}, {Holder: "F2", Percent: "60"}}; inv.Owner != "F2" || !reflect.DeepEqual(inv.CapTable, wantTable) {
+		t.Errorf("owner %s cap table %+v", inv.Owner, inv.CapTable)
+	}
+	if _, err := stub.as(RoleVendor, "V1").mockInvoke(new(SimpleChaincode), "cancel_invoice", inv1); !errorMatches(err, "is held by F1, F2") {
+		t.Errorf("vendor cancelling an invoice sold in pieces: %v", err)
+	}
+	if _, err := stub.as(RoleFinancier, "F1").mockInvoke(new(SimpleChaincode), "pledge_invoice", inv1, "B1"); !errorMatches(err, "held in pieces") {
+		t.Errorf("pledging a piece: %v", err)
+	}
+
+	//a holder sells its piece on, when one buyer has it all the invoice is whole again
+	mustInvoke(t, stub, RoleFinancier, "F1", "open_trade", inv1, "1")
+	resale := readTrades(t, stub).OpenTrades[0]
+	if resale.User != "F1" || resale.FaceValue.String() != "40.00" {
+		t.Errorf("resale of a piece %+v", resale)
+	}
+	mustInvoke(t, stub, RoleFinancier, "F2", "perform_trade", resale.ID, "F2")
+	if inv = readInvoice(t, stub, "V1", "INV-1"); inv.Owner != "F2" || !reflect.DeepEqual(inv.CapTable, []Share{{Holder: "F2", Percent: "100"}}) {
+		t.Errorf("owner %s cap table %+v, want F2 alone", inv.Owner, inv.CapTable)
+	}
+	if _, payload := lastEvent(t, stub); len(payload.Events) != 1 {
+		t.Errorf("events %v, want the fill alone, F2 already held the most", eventNames(payload))
+	}
+}
+
+func TestCleanTradesFailureFailsInvoke(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub)
+	openTrade(t, stub)
+	stub.failKeys = map[string]bool{openTradesStr: true} //taking down the listing of a disputed invoice fails
+
+	_, err := stub.as(RoleCustomer, "C1").mockInvoke(new(SimpleChaincode), "dispute_invoice", invoiceKey("V1", "INV-1"), "short delivery")
+	if !errorMatches(err, "Failed to write "+openTradesStr) {
+		t.Fatalf("dispute_invoice: got %v, want the failed clean up", err)
+	}
+	if inv := readInvoice(t, stub, "V1", "INV-1"); inv.Status == StatusDisputed {
+		t.Errorf("invoice disputed although its listing could not be taken down")
+	}
+	if trades := readTrades(t, stub); len(trades.OpenTrades) != 1 {
+		t.Errorf("open trades %+v, want the listing kept", trades.OpenTrades)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// The rules every invoice, account and payment must meet before it is written. Each failure is a
+// ChaincodeError naming the JSON field at fault, the first one found is returned.
+
+// maxQuantity bounds Invoice.Quantity, well inside an int on every platform
+const maxQuantity = 1000000000
+
+// ============================================================================================================================
+// checkRequired - a required field must not be empty
+// ============================================================================================================================
+func checkRequired(field string, value string) error {
+	if len(value) == 0 {
+		return newError(CodeRequired, field, "Field \""+field+"\" must be a non-empty string")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// checkDate - a date field must be an ISO 8601 calendar date, YYYY-MM-DD
+// ============================================================================================================================
+func checkDate(field string, value string) error {
+	if len(value) == 0 {
+		return checkRequired(field, value)
+	}
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return newError(CodeInvalidDate, field, "Field \""+field+"\" must be an ISO 8601 date (YYYY-MM-DD), not \""+value+"\"")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// checkCurrency - a currency field must be an ISO 4217 code we know the minor units of
+// ============================================================================================================================
+func checkCurrency(field string, value string) error {
+	if len(value) == 0 {
+		return checkRequired(field, value)
+	}
+	if _, err := currencyDigits(value); err != nil {
+		return newError(CodeInvalidCurrency, field, "Unknown currency \""+value+"\" in field \""+field+"\", expecting an ISO 4217 code")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// checkPositive - an amount field must be greater than zero
+// ============================================================================================================================
+func checkPositive(field string, amount Money) error {
+	if amount.Sign() <= 0 {
+		return newError(CodeOutOfRange, field, "Field \""+field+"\" must be greater than zero")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// checkRange - a whole number field must lie between min and max, both included
+// ============================================================================================================================
+func checkRange(field string, value int, min int, max int) error {
+	if value < min || value > max {
+		return newError(CodeOutOfRange, field, "Field \""+field+"\" must be between "+strconv.Itoa(min)+" and "+strconv.Itoa(max))
+	}
+	return nil
+}
+
+// firstError - the first of the checks that failed, nil if they all passed
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// validateInvoice - check a new invoice before it is written
+// ============================================================================================================================
+func validateInvoice(inv Invoice) error {
+	err := firstError(
+		checkRequired("vendorid", inv.VendorID),
+		checkRequired("customerid", inv.CustomerID),
+		checkRequired("invoicenumber", inv.InvoiceNumber),
+		checkCurrency("currency", inv.Currency),
+		checkPositive("invoiceamount", inv.InvoiceAmount),
+		checkRequired("material", inv.Material),
+		checkRange("quantity", inv.Quantity, 1, maxQuantity),
+		checkRequired("tradeid", inv.TradeID),
+		checkDate("paymentdate", inv.PaymentDate),
+		checkDate("newpaymentdate", inv.NewPaymentDate),
+	)
+	if err != nil {
+		return err
+	}
+	if inv.Status != StatusDraft && inv.Status != StatusIssued {
+		return newError(CodeInvalidArgument, "status", "Field \"status\" must be the initial status \""+StatusDraft+"\" or \""+StatusIssued+"\"")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// validateAccount - check a new account before it is written
+// ============================================================================================================================
+func validateAccount(account Account) error {
+	return firstError(
+		checkRequired("id", account.ID),
+		checkRequired("accountname", account.AccountName),
+		checkRequired("accounttype", account.AccountType),
+		checkRange("bankaccountnumber", account.BankAccountNumber, 1, int(^uint(0)>>1)),
+		checkRequired("bankerid", account.BankerID),
+	)
+}
+
+// ============================================================================================================================
+// validatePayment - check a new payment before it is written, its payment date already filled in
+// ============================================================================================================================
+func validatePayment(payment Payment) error {
+	err := firstError(
+		checkRequired("paymentId", payment.PaymentID),
+		checkRequired("vendorid", payment.VendorID),
+		checkRequired("customerid", payment.CustomerID),
+		checkCurrency("currency", payment.Currency),
+		checkPositive("amount", payment.Amount),
+		checkRequired("bankerid", payment.BankerID),
+		checkDate("paymentdate", payment.PaymentDate),
+	)
+	if err != nil {
+		return err
+	}
+	if len(payment.NewPaymentDate) > 0 {
+		err = checkDate("newpaymentdate", payment.NewPaymentDate)
+		if err != nil {
+			return err
+		}
+	}
+	if len(payment.Allocations) == 0 {
+		return newError(CodeRequired, "allocations", "Payment "+payment.PaymentID+" does not cover any invoice")
+	}
+	for i, alloc := range payment.Allocations {
+		field := "allocations[" + strconv.Itoa(i) + "]."
+		err = firstError(
+			checkRequired(field+"invoiceid", alloc.InvoiceID),
+			checkPositive(field+"amount", alloc.Amount),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	invoice := func(change func(args []string)) []string {
+		a := invoiceArgs("V1", "C1", "INV-7", "10.00", "tin", "1")
+		change(a)
+		return a
+	}
+	payment := func(change func(args []string)) []string {
+		a := []string{"P1", "V1", "C1", invoiceKey("V1", "INV-1"), "40.00", "USD", "B1", "", "T1", ""}
+		change(a)
+		return a
+	}
+	cases := []struct {
+		name      string
+		role      string
+		id        string
+		function  string
+		args      []string
+		wantCode  string
+		wantField string
+	}{
+		{"payment date", RoleVendor, "V1", "create_invoice", invoice(func(a []string) { a[8] = "next week" }), CodeInvalidDate, "paymentdate"},
+		{"currency", RoleVendor, "V1", "create_invoice", invoice(func(a []string) { a[4] = "XYZ" }), CodeInvalidCurrency, "currency"},
+		{"quantity", RoleVendor, "V1", "create_invoice", invoice(func(a []string) { a[6] = "0" }), CodeOutOfRange, "quantity"},
+		{"positional argument", RoleVendor, "V1", "create_invoice", invoice(func(a []string) { a[0] = "" }), CodeRequired, "vendorid"},
+		{"argument count", RoleVendor, "V1", "create_invoice", []string{"V1"}, CodeInvalidArgument, ""},
+		{"duplicate", RoleVendor, "V1", "create_invoice", invoice(func(a []string) { a[2] = "INV-1" }), CodeAlreadyExists, "invoicenumber"},
+		{"another vendor", RoleVendor, "V2", "create_invoice", invoice(func(a []string) {}), CodePermissionDenied, ""},
+		{"bank account number", RoleBanker, "B1", "create_account", []string{"C2", "Customer Two", "customer", "2 Main St", "0", "555-0102", "B1"}, CodeOutOfRange, "bankaccountnumber"},
+		{"account name", RoleBanker, "B1", "create_account", []string{"C2", "", "customer", "2 Main St", "67890", "555-0102", "B1"}, CodeRequired, "accountname"},
+		{"payment date format", RoleCustomer, "C1", "create_payment", payment(func(a []string) { a[7] = "01/10/2026" }), CodeInvalidDate, "paymentdate"},
+		{"payment amount", RoleCustomer, "C1", "create_payment", payment(func(a []string) { a[4] = "0.00" }), CodeOutOfRange, "amount"},
+		{"overpayment", RoleCustomer, "C1", "create_payment", payment(func(a []string) { a[4] = "150.00" }), CodeOutOfRange, "amount"},
+		{"unknown payment currency", RoleCustomer, "C1", "create_payment", payment(func(a []string) { a[5] = "XYZ" }), CodeInvalidCurrency, "currency"},
+		{"negative fx rate", RoleAdmin, "A1", "set_fx_rate", []string{"EUR", "USD", "-1", "2026-10-01"}, CodeOutOfRange, "rate"},
+		{"fx rate in an unknown currency", RoleAdmin, "A1", "set_fx_rate", []string{"XYZ", "USD", "1.1", "2026-10-01"}, CodeInvalidCurrency, "from"},
+		{"unknown invoice", RoleCustomer, "C1", "create_payment", payment(func(a []string) { a[3] = invoiceKey("V1", "INV-404") }), CodeNotFound, ""},
+		{"wrong role", RoleVendor, "V1", "create_account", []string{"C2", "Customer Two", "customer", "2 Main St", "67890", "555-0102", "B1"}, CodePermissionDenied, ""},
+		{"unknown function", RoleAdmin, "A1", "fly", nil, CodeUnknownFunction, ""},
+		{"named field", RoleVendor, "V1", "create_invoice", []string{`{"vendorid": "V1", "customerid": "C1", "invoicenumber": "INV-7", "invoiceamount": "10.00",
+			"currency": "USD", "material": "tin", "quantity": 0, "tradeid": "T1", "paymentdate": "2026-11-01", "status": "issued", "newpaymentdate": "2026-11-01"}`}, CodeOutOfRange, "quantity"},
+		{"named missing field", RoleBanker, "B1", "confirm_payment", []string{`{}`}, CodeRequired, "paymentId"},
+	}
+	for _, tc := range cases {
+		stub := newMockStub()
+		setupLedger(t, stub)
+		_, err := stub.as(tc.role, tc.id).mockInvoke(new(SimpleChaincode), tc.function, tc.args...)
+		if err == nil {
+			t.Errorf("%s: no error", tc.name)
+			continue
+		}
+		e := errorOf(err)
+		if e.Code != tc.wantCode || e.Field != tc.wantField || e.Message == "" {
+			t.Errorf("%s: got %s, want code %q field %q", tc.name, err, tc.wantCode, tc.wantField)
+		}
+	}
+
+	//queries answer with the same envelope
+	stub := newMockStub()
+	setupLedger(t, stub)
+	_, err := stub.mockQuery(new(SimpleChaincode), "payments_for_invoice", invoiceKey("V1", "INV-404"))
+	if e := errorOf(err); e.Code != CodeNotFound {
+		t.Errorf("query of an unknown invoice: got %v, want code %q", err, CodeNotFound)
+	}
+	_, err = stub.mockQuery(new(SimpleChaincode), "get_fx_rate", `{"from": "USD", "to": "EUR", "date": "tomorrow"}`)
+	if e := errorOf(err); e.Code != CodeInvalidDate || e.Field != "date" {
+		t.Errorf("query with a bad date: got %v, want code %q", err, CodeInvalidDate)
+	}
+	_, err = stub.mockQuery(new(SimpleChaincode), "get_fx_rate", "USD", "EUR", "2026-13-45")
+	if e := errorOf(err); e.Code != CodeInvalidDate || e.Field != "date" {
+		t.Errorf("query with an impossible date: got %v, want code %q field %q", err, CodeInvalidDate, "date")
+	}
+	_, err = stub.mockQuery(new(SimpleChaincode), "list_invoices", `{"token": "not a token"}`)
+	if e := errorOf(err); e.Code != CodeInvalidArgument || e.Field != "token" {
+		t.Errorf("list with a bad token: got %v, want code %q field %q", err, CodeInvalidArgument, "token")
+	}
+}
+
+func TestValidatePayment(t *testing.T) {
+	valid := func() Payment {
+		return Payment{PaymentID: "P1", VendorID: "V1", CustomerID: "C1", Currency: "USD", Amount: Money{4000, 2}, BankerID: "B1", PaymentDate: "2026-10-01",
+			Allocations: []Allocation{{InvoiceID: invoiceKey("V1", "INV-1"), Amount: Money{4000, 2}}}}
+	}
+	if err := validatePayment(valid()); err != nil {
+		t.Fatalf("valid payment: %v", err)
+	}
+	cases := []struct {
+		name      string
+		change    func(p *Payment)
+		wantCode  string
+		wantField string
+	}{
+		{"no customer", func(p *Payment) { p.CustomerID = "" }, CodeRequired, "customerid"},
+		{"currency", func(p *Payment) { p.Currency = "usd" }, CodeInvalidCurrency, "currency"},
+		{"negative amount", func(p *Payment) { p.Amount = Money{-1, 2} }, CodeOutOfRange, "amount"},
+		{"new payment date", func(p *Payment) { p.NewPaymentDate = "2026-02-30" }, CodeInvalidDate, "newpaymentdate"},
+		{"no allocations", func(p *Payment) { p.Allocations = nil }, CodeRequired, "allocations"},
+		{"allocation amount", func(p *Payment) { p.Allocations[0].Amount = Money{0, 2} }, CodeOutOfRange, "allocations[0].amount"},
+	}
+	for _, tc := range cases {
+		p := valid()
+		tc.change(&p)
+		err := validatePayment(p)
+		e, ok := err.(*ChaincodeError)
+		if !ok || e.Code != tc.wantCode || e.Field != tc.wantField {
+			t.Errorf("%s: got %v, want code %q field %q", tc.name, err, tc.wantCode, tc.wantField)
+		}
+	}
+}
+
+func TestConfirmPaymentByAnotherBanker(t *testing.T) {
+	stub := newMockStub()
+	setupLedger(t, stub)
+	mustInvoke(t, stub, RoleCustomer, "C1", "create_payment", paymentArgs("P1", "40.00", "2026-10-02")...)
+
+	_, err := stub.as(RoleBanker, "B2").mockInvoke(new(SimpleChaincode), "confirm_payment", "P1")
+	if e := errorOf(err); e.Code != CodePermissionDenied || e.Field != "paymentId" || !strings.Contains(e.Message, "Only banker B1") {
+		t.Errorf("confirm_payment by B2: got %v, want code %q field %q", err, CodePermissionDenied, "paymentId")
+	}
+}